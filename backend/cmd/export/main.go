@@ -0,0 +1,95 @@
+// Command export writes rated companion replies as JSONL fine-tuning data, split into
+// train.jsonl and validation.jsonl. History is anonymized and system prompts are rebuilt
+// from the companion revision each reply was generated with.
+//
+//	go run ./cmd/export -format anthropic -rating up -from 2025-01-01 -out ./dataset
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/joho/godotenv"
+
+	"nectar-ai-companion/internal/db"
+	"nectar-ai-companion/internal/services"
+)
+
+func main() {
+	format := flag.String("format", services.DatasetFormatOpenAI, "output format: openai or anthropic")
+	rating := flag.String("rating", "up", "feedback to export: up, down or any")
+	companionID := flag.String("companion", "", "only export replies of this companion ID")
+	from := flag.String("from", "", "only export replies created at or after this date (YYYY-MM-DD or RFC 3339)")
+	to := flag.String("to", "", "only export replies created before this date (YYYY-MM-DD or RFC 3339)")
+	validation := flag.Float64("validation", 0.1, "share of conversations in the validation set")
+	outDir := flag.String("out", "dataset", "directory to write train.jsonl and validation.jsonl to")
+	flag.Parse()
+
+	if !services.ValidDatasetFormat(*format) {
+		log.Fatalf("Unknown format %q: use openai or anthropic", *format)
+	}
+	if *validation < 0 || *validation > 1 {
+		log.Fatalf("Validation share must be between 0 and 1")
+	}
+
+	filter := services.DatasetFilter{CompanionID: *companionID}
+	switch *rating {
+	case "up", "down":
+		filter.Rating = *rating
+	case "any":
+	default:
+		log.Fatalf("Unknown rating %q: use up, down or any", *rating)
+	}
+	var err error
+	if *from != "" {
+		if filter.From, err = services.ParseDatasetTime(*from); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *to != "" {
+		if filter.To, err = services.ParseDatasetTime(*to); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	database, err := db.Initialize()
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		log.Fatalf("Failed to create output directory: %v", err)
+	}
+	files := map[string]*os.File{}
+	counts := map[string]int{}
+	for _, split := range []string{services.DatasetSplitTrain, services.DatasetSplitValidation} {
+		f, err := os.Create(filepath.Join(*outDir, split+".jsonl"))
+		if err != nil {
+			log.Fatalf("Failed to create %s file: %v", split, err)
+		}
+		defer f.Close()
+		files[split] = f
+	}
+
+	err = services.NewDatasetService(database).Export(filter, func(example services.DatasetExample) error {
+		split := services.DatasetSplit(example.ConversationID, *validation)
+		written, err := services.WriteDatasetRecord(files[split], *format, example)
+		if written {
+			counts[split]++
+		}
+		return err
+	})
+	if err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+
+	log.Printf("Wrote %d training and %d validation examples to %s",
+		counts[services.DatasetSplitTrain], counts[services.DatasetSplitValidation], *outDir)
+}
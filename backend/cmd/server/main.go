@@ -10,6 +10,7 @@ import (
 
 	"nectar-ai-companion/internal/api"
 	"nectar-ai-companion/internal/db"
+	"nectar-ai-companion/internal/services"
 	"nectar-ai-companion/internal/websocket"
 )
 
@@ -35,6 +36,9 @@ func main() {
 	hub := websocket.NewHub()
 	go hub.Run()
 
+	// Aggregate companion stats and trending scores in the background
+	go services.NewStatsService(database).Run(nil)
+
 	// Initialize Gin router
 	router := gin.Default()
 
@@ -0,0 +1,335 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/services"
+)
+
+// maxImageUploadSize limits user image uploads to 10MB
+const maxImageUploadSize = 10 << 20
+
+// imageExtensions maps accepted image MIME types to file extensions
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+var errInvalidAttachment = errors.New("invalid attachment")
+
+// dbExecer is satisfied by *sql.DB and *sql.Tx
+type dbExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// dbQueryRower is satisfied by *sql.DB and *sql.Tx
+type dbQueryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// UploadAttachment stores an image uploaded by the user so it can be attached to their next message
+func (h *Handlers) UploadAttachment(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	data, mimeType, err := readImageUpload(c, "file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	uid := userID.(string)
+	att, err := h.storeMedia("image", "attachments/"+uid, data, mimeType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	att.UserID = &uid
+
+	if err := insertAttachment(h.db, att); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{Data: att})
+}
+
+// readImageUpload reads a multipart image field and validates its type from the content
+func readImageUpload(c *gin.Context, field string) ([]byte, string, error) {
+	file, header, err := c.Request.FormFile(field)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s is required", field)
+	}
+	defer file.Close()
+
+	if header.Size > maxImageUploadSize {
+		return nil, "", fmt.Errorf("image must be smaller than %dMB", maxImageUploadSize>>20)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImageUploadSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read upload: %w", err)
+	}
+	if len(data) > maxImageUploadSize {
+		return nil, "", fmt.Errorf("image must be smaller than %dMB", maxImageUploadSize>>20)
+	}
+
+	mimeType := http.DetectContentType(data)
+	if _, ok := imageExtensions[mimeType]; !ok {
+		return nil, "", fmt.Errorf("unsupported image type: %s", mimeType)
+	}
+
+	return data, mimeType, nil
+}
+
+// storeMedia writes media to storage under prefix and describes it as an attachment
+func (h *Handlers) storeMedia(kind string, prefix string, data []byte, mimeType string) (*models.Attachment, error) {
+	ext, ok := imageExtensions[mimeType]
+	if !ok {
+		ext = audioExtensions[mimeType]
+	}
+	key := fmt.Sprintf("%s/%s%s", strings.Trim(prefix, "/"), uuid.New().String(), ext)
+
+	url, err := h.storage.Put(key, mimeType, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(len(data))
+	att := &models.Attachment{
+		ID:         uuid.New().String(),
+		Kind:       kind,
+		URL:        url,
+		StorageKey: &key,
+		MimeType:   &mimeType,
+		SizeBytes:  &size,
+		CreatedAt:  time.Now(),
+	}
+
+	if kind == "image" {
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			att.Width = &cfg.Width
+			att.Height = &cfg.Height
+		}
+	}
+
+	return att, nil
+}
+
+// storeGeneratedImage converts an image pipeline result into an attachment.
+// Data URLs are decoded into storage; remote URLs are referenced as-is.
+func (h *Handlers) storeGeneratedImage(imageURL string) (*models.Attachment, error) {
+	if strings.HasPrefix(imageURL, "data:") {
+		data, mimeType, err := decodeImageDataURL(imageURL)
+		if err != nil {
+			return nil, err
+		}
+		return h.storeMedia("image", "generated", data, mimeType)
+	}
+
+	return &models.Attachment{
+		ID:        uuid.New().String(),
+		Kind:      "image",
+		URL:       imageURL,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// decodeImageDataURL decodes a base64 image data URL, validating its type from the content
+func decodeImageDataURL(dataURL string) ([]byte, string, error) {
+	comma := strings.Index(dataURL, ",")
+	if !strings.HasPrefix(dataURL, "data:") || comma < 0 || !strings.Contains(dataURL[:comma], ";base64") {
+		return nil, "", fmt.Errorf("image must be a base64 data URL")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(dataURL[comma+1:])
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid image data: %w", err)
+	}
+	if len(data) > maxImageUploadSize {
+		return nil, "", fmt.Errorf("image must be smaller than %dMB", maxImageUploadSize>>20)
+	}
+
+	mimeType := http.DetectContentType(data)
+	if _, ok := imageExtensions[mimeType]; !ok {
+		return nil, "", fmt.Errorf("unsupported image type: %s", mimeType)
+	}
+
+	return data, mimeType, nil
+}
+
+// promptImage loads a stored image attachment for a vision prompt
+func (h *Handlers) promptImage(att models.Attachment) (*services.ClaudeImage, error) {
+	if att.Kind != "image" || att.StorageKey == nil || att.MimeType == nil {
+		return nil, fmt.Errorf("attachment is not a stored image")
+	}
+
+	rc, err := h.storage.Open(*att.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxImageUploadSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return &services.ClaudeImage{MediaType: *att.MimeType, Data: data}, nil
+}
+
+// insertAttachment saves an attachment row
+func insertAttachment(db dbExecer, att *models.Attachment) error {
+	_, err := db.Exec(
+		`INSERT INTO message_attachments (id, message_id, user_id, kind, url, storage_key, mime_type, width, height, size_bytes, duration_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		att.ID, att.MessageID, att.UserID, att.Kind, att.URL, att.StorageKey,
+		att.MimeType, att.Width, att.Height, att.SizeBytes, att.DurationMs,
+	)
+	return err
+}
+
+// linkAttachments attaches the user's pending uploads to a message. IDs that are malformed or
+// not the user's pending uploads give errInvalidAttachment; repeated IDs are attached once.
+func linkAttachments(db dbExecer, messageID string, userID string, attachmentIDs []string) error {
+	if len(attachmentIDs) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(attachmentIDs))
+	ids := make([]string, 0, len(attachmentIDs))
+	for _, id := range attachmentIDs {
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			return errInvalidAttachment
+		}
+		if id = parsed.String(); !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	result, err := db.Exec(
+		`UPDATE message_attachments SET message_id = $1
+		WHERE id = ANY($2) AND user_id = $3 AND message_id IS NULL`,
+		messageID, pq.Array(ids), userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	linked, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if int(linked) != len(ids) {
+		return errInvalidAttachment
+	}
+	return nil
+}
+
+// attachmentColumns lists the attachment columns read by scanAttachment
+const attachmentColumns = `id, message_id, user_id, kind, url, storage_key, mime_type, width, height, size_bytes, duration_ms, created_at`
+
+// scanAttachment scans a row selected with attachmentColumns, followed by any extra columns
+func scanAttachment(row rowScanner, att *models.Attachment, extra ...interface{}) error {
+	dest := []interface{}{
+		&att.ID, &att.MessageID, &att.UserID, &att.Kind, &att.URL, &att.StorageKey,
+		&att.MimeType, &att.Width, &att.Height, &att.SizeBytes, &att.DurationMs, &att.CreatedAt,
+	}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// loadAttachments fetches the attachments of the given messages, keyed by message ID.
+// Attachments of earlier versions of a message are left out.
+func (h *Handlers) loadAttachments(messageIDs []string) (map[string][]models.Attachment, error) {
+	result := make(map[string][]models.Attachment)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	rows, err := h.db.Query(
+		`SELECT `+attachmentColumns+`
+		FROM message_attachments WHERE message_id = ANY($1) AND revision_id IS NULL
+		ORDER BY created_at ASC`,
+		pq.Array(messageIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var att models.Attachment
+		if err := scanAttachment(rows, &att); err != nil {
+			continue
+		}
+		result[*att.MessageID] = append(result[*att.MessageID], att)
+	}
+
+	return result, nil
+}
+
+// loadRevisionAttachments fetches the attachments of the given message revisions, keyed by revision ID
+func (h *Handlers) loadRevisionAttachments(revisionIDs []string) (map[string][]models.Attachment, error) {
+	result := make(map[string][]models.Attachment)
+	if len(revisionIDs) == 0 {
+		return result, nil
+	}
+
+	rows, err := h.db.Query(
+		`SELECT `+attachmentColumns+`, revision_id
+		FROM message_attachments WHERE revision_id = ANY($1)
+		ORDER BY created_at ASC`,
+		pq.Array(revisionIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var att models.Attachment
+		var revisionID string
+		if err := scanAttachment(rows, &att, &revisionID); err != nil {
+			continue
+		}
+		result[revisionID] = append(result[revisionID], att)
+	}
+
+	return result, nil
+}
+
+// setAttachments assigns attachments to a message and mirrors the first image into ImageURL
+func setAttachments(msg *models.Message, attachments []models.Attachment) {
+	msg.Attachments = attachments
+	for _, att := range attachments {
+		if att.Kind == "image" {
+			url := att.URL
+			msg.ImageURL = &url
+			return
+		}
+	}
+}
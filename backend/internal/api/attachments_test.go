@@ -0,0 +1,16 @@
+package api
+
+import "testing"
+
+func TestLinkAttachmentsRejectsMalformedIDs(t *testing.T) {
+	ids := [][]string{
+		{"not-a-uuid"},
+		{"0b6f7a54-6d2a-4a52-9a4e-3f7f1c2d9e10", "'; DROP TABLE messages; --"},
+	}
+	for _, attachmentIDs := range ids {
+		// Malformed IDs are rejected before the database is touched
+		if err := linkAttachments(nil, "message-1", "user-1", attachmentIDs); err != errInvalidAttachment {
+			t.Errorf("linkAttachments(%q) = %v, want errInvalidAttachment", attachmentIDs, err)
+		}
+	}
+}
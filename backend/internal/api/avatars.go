@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/services"
+)
+
+// UploadUserAvatar sets the user's avatar from a multipart image upload
+func (h *Handlers) UploadUserAvatar(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	urls, ok := h.uploadAvatar(c, "users/"+userID.(string))
+	if !ok {
+		return
+	}
+
+	if _, err := h.db.Exec(`UPDATE users SET avatar_url = $2 WHERE id = $1`, userID, urls.Full); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: urls})
+}
+
+// UploadCompanionAvatar sets a companion's avatar from a multipart image upload, recording a revision
+func (h *Handlers) UploadCompanionAvatar(c *gin.Context) {
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	urls, ok := h.uploadAvatar(c, "companions/"+comp.ID)
+	if !ok {
+		return
+	}
+
+	comp.AvatarURL = urls.Full
+	if err := h.saveCompanion(comp, viewerID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: models.CompanionAvatarResponse{Companion: comp, Avatar: urls}})
+}
+
+// uploadAvatar reads the "file" field, renders the avatar sizes and stores them under avatars/prefix.
+// It writes the error response and returns false if the upload fails.
+func (h *Handlers) uploadAvatar(c *gin.Context, prefix string) (*models.AvatarURLs, bool) {
+	data, _, err := readImageUpload(c, "file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return nil, false
+	}
+
+	variants, err := services.RenderAvatar(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return nil, false
+	}
+
+	urls, err := h.storeAvatar(prefix, variants)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return nil, false
+	}
+	return urls, true
+}
+
+// storeAvatar writes the rendered sizes of one avatar next to each other, so any size's URL
+// can be derived from another by swapping the file name
+func (h *Handlers) storeAvatar(prefix string, variants []services.AvatarVariant) (*models.AvatarURLs, error) {
+	dir := fmt.Sprintf("avatars/%s/%s", strings.Trim(prefix, "/"), uuid.New().String())
+
+	urls := &models.AvatarURLs{}
+	for _, v := range variants {
+		key := dir + "/" + v.Name + imageExtensions[v.MimeType]
+		u, err := h.storage.Put(key, v.MimeType, bytes.NewReader(v.Data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to store %s avatar: %w", v.Name, err)
+		}
+		switch v.Name {
+		case "thumb":
+			urls.Thumb = u
+		case "card":
+			urls.Card = u
+		case "full":
+			urls.Full = u
+		}
+	}
+	return urls, nil
+}
+
+// validAvatarURL reports whether an avatar URL set through the API is empty, an absolute
+// http(s) URL or a path to stored media
+func (h *Handlers) validAvatarURL(raw string) bool {
+	if raw == "" {
+		return true
+	}
+	if strings.HasPrefix(raw, h.storage.URL("")) {
+		return !strings.Contains(raw, "..")
+	}
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
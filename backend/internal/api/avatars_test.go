@@ -0,0 +1,32 @@
+package api
+
+import (
+	"testing"
+
+	"nectar-ai-companion/internal/storage"
+)
+
+func TestValidAvatarURL(t *testing.T) {
+	h := &Handlers{storage: storage.NewLocalStorage(t.TempDir(), "/media")}
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"", true},
+		{"https://cdn.example.com/a.jpg", true},
+		{"http://cdn.example.com/a.jpg", true},
+		{"/media/avatars/companions/1/x/full.jpg", true},
+		{"/media/../secrets", false},
+		{"/other/a.jpg", false},
+		{"javascript:alert(1)", false},
+		{"data:image/png;base64,AAAA", false},
+		{"https:///a.jpg", false},
+		{"cdn.example.com/a.jpg", false},
+	}
+
+	for _, tt := range tests {
+		if got := h.validAvatarURL(tt.url); got != tt.want {
+			t.Errorf("validAvatarURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/websocket"
+)
+
+// broadcastBranch tells the conversation's clients which branch is now active
+func (h *Handlers) broadcastBranch(conversationID, leafID string) {
+	h.wsHub.BroadcastEvent(conversationID, websocket.EventBranchSwitched, models.BranchSwitched{
+		ConversationID: conversationID,
+		ActiveLeafID:   leafID,
+	})
+}
+
+// ListMessageSiblings lists a message and its alternatives: the messages with the same parent,
+// such as regenerated replies and edits made as branches
+func (h *Handlers) ListMessageSiblings(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	msg, conv, ok := h.ownedMessage(c, userID.(string), c.Param("id"))
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(
+		`SELECT `+messageColumns+` FROM messages
+		WHERE conversation_id = $1 AND parent_id IS NOT DISTINCT FROM $2 AND deleted_at IS NULL
+		ORDER BY created_at ASC`,
+		conv.ID, msg.ParentID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	result := models.MessageSiblings{Siblings: []models.Message{}, ActiveIndex: -1}
+	var ids []string
+	for rows.Next() {
+		var sibling models.Message
+		if err := scanMessage(rows, &sibling); err != nil {
+			continue
+		}
+		result.Siblings = append(result.Siblings, sibling)
+		ids = append(ids, sibling.ID)
+	}
+
+	attachments, err := h.loadAttachments(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	for i := range result.Siblings {
+		setAttachments(&result.Siblings[i], attachments[result.Siblings[i].ID])
+	}
+	if err := h.setReactions(result.Siblings, conv.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	// The active branch passes through at most one of the siblings
+	if conv.ActiveLeafID != nil {
+		var activeID string
+		err := h.db.QueryRow(
+			messagePathCTE+` SELECT id FROM path WHERE parent_id IS NOT DISTINCT FROM $3 LIMIT 1`,
+			*conv.ActiveLeafID, maxPathDepth, msg.ParentID,
+		).Scan(&activeID)
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+		for i, sibling := range result.Siblings {
+			if sibling.ID == activeID {
+				result.ActiveIndex = i
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: result})
+}
+
+// SwitchBranch makes the branch through a message the active one. The conversation continues
+// from the newest message after it, so switching to an alternative reply keeps what followed it.
+func (h *Handlers) SwitchBranch(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.SwitchBranchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	conv, ok := h.ownedConversation(c, userID.(string), c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var leafID string
+	err := h.db.QueryRow(
+		`WITH RECURSIVE subtree AS (
+			SELECT id, created_at FROM messages WHERE id = $1 AND conversation_id = $2 AND deleted_at IS NULL
+			UNION ALL
+			SELECT m.id, m.created_at FROM messages m JOIN subtree s ON m.parent_id = s.id
+			WHERE m.deleted_at IS NULL
+		)
+		SELECT id FROM subtree ORDER BY created_at DESC LIMIT 1`,
+		req.MessageID, conv.ID,
+	).Scan(&leafID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	if err := setActiveLeaf(h.db, conv.ID, leafID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	conv.ActiveLeafID = &leafID
+
+	h.broadcastBranch(conv.ID, leafID)
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: conv})
+}
+
+// ForkConversation starts a new thread with a copy of the active path up to a message,
+// leaving the original thread as it is. The title defaults to the original's.
+func (h *Handlers) ForkConversation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.ForkConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	msg, source, ok := h.ownedMessage(c, userID.(string), c.Param("id"))
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(
+		messagePathCTE+` SELECT `+messageColumns+` FROM path WHERE deleted_at IS NULL ORDER BY depth DESC`,
+		msg.ID, maxPathDepth,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	var path []models.Message
+	for rows.Next() {
+		var m models.Message
+		if err := scanMessage(rows, &m); err != nil {
+			rows.Close()
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+		path = append(path, m)
+	}
+	rows.Close()
+
+	conv := &models.Conversation{
+		ID:                  uuid.New().String(),
+		UserID:              source.UserID,
+		CompanionID:         source.CompanionID,
+		Title:               source.Title,
+		CompanionRevisionID: source.CompanionRevisionID,
+		PersonaID:           source.PersonaID,
+	}
+	if title := strings.TrimSpace(req.Title); title != "" {
+		conv.Title = title
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// The fork keeps the companion revision and persona the original chats with
+	if err := tx.QueryRow(
+		`INSERT INTO conversations (id, user_id, companion_id, title, companion_revision_id, persona_id)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at`,
+		conv.ID, conv.UserID, conv.CompanionID, conv.Title, conv.CompanionRevisionID, conv.PersonaID,
+	).Scan(&conv.CreatedAt); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	// Copy the path with new IDs, keeping its timestamps, current attachments and the context
+	// replies were generated with, which training exports read
+	var parentID *string
+	for _, m := range path {
+		id := uuid.New().String()
+		if _, err := tx.Exec(
+			`INSERT INTO messages (id, conversation_id, parent_id, sender, content, metadata,
+				delivered_at, read_at, edited_at, created_at, prompt_context)
+			SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, prompt_context FROM messages WHERE id = $11`,
+			id, conv.ID, parentID, m.Sender, m.Content, m.Metadata, m.DeliveredAt, m.ReadAt, m.EditedAt, m.CreatedAt, m.ID,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO message_attachments (message_id, user_id, kind, url, storage_key, mime_type,
+				width, height, size_bytes, duration_ms, created_at)
+			SELECT $2, user_id, kind, url, storage_key, mime_type, width, height, size_bytes, duration_ms, created_at
+			FROM message_attachments WHERE message_id = $1 AND revision_id IS NULL`,
+			m.ID, id,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+		parentID = &id
+	}
+
+	if parentID != nil {
+		if err := setActiveLeaf(tx, conv.ID, *parentID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+		conv.ActiveLeafID = parentID
+	}
+
+	// The copied history has already been seen
+	if _, err := tx.Exec(
+		`INSERT INTO conversation_reads (user_id, conversation_id, last_read_at) VALUES ($1, $2, $3)`,
+		conv.UserID, conv.ID, time.Now(),
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{Data: conv})
+}
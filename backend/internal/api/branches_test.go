@@ -0,0 +1,41 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSwitchBranchValidation(t *testing.T) {
+	h := NewHandlers(nil, nil)
+	router := setupTestRouter()
+	router.PUT("/api/chat/conversations/:id/branch", func(c *gin.Context) {
+		c.Set("userID", "user-1")
+		h.SwitchBranch(c)
+	})
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"Missing message", `{}`},
+		{"Empty message", `{"messageId":""}`},
+		{"Malformed", `{"messageId":`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("PUT", "/api/chat/conversations/1/branch", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,463 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/services"
+	"nectar-ai-companion/internal/storage"
+)
+
+// cardExtensionKey namespaces companion fields with no card equivalent inside data.extensions
+const cardExtensionKey = "nectar"
+
+// defaultCardAge is used for imported characters when the card and request give no age
+const defaultCardAge = 25
+
+// cardCompanionFields round-trips companion fields that Character Card V2 has no field for
+type cardCompanionFields struct {
+	Category           string                 `json:"category,omitempty"`
+	Age                int                    `json:"age,omitempty"`
+	Personality        *models.Personality    `json:"personality,omitempty"`
+	Interests          []string               `json:"interests,omitempty"`
+	CommunicationStyle string                 `json:"communicationStyle,omitempty"`
+	Appearance         map[string]string      `json:"appearance,omitempty"`
+	Voice              *services.VoiceProfile `json:"voice,omitempty"`
+}
+
+// companionCard exports a companion as a Character Card V2, with its lorebook as the character_book
+func companionCard(comp *models.Companion, lorebook []models.LorebookEntry) (*services.CharacterCard, error) {
+	data := services.CharacterCardData{
+		Name:        comp.Name,
+		Description: comp.Bio,
+		Tags:        comp.Tags,
+		Extra:       map[string]json.RawMessage{},
+	}
+	if comp.Scenario != nil {
+		data.Scenario = *comp.Scenario
+	}
+	if comp.Greeting != nil {
+		data.FirstMes = *comp.Greeting
+	}
+	if summary, ok := comp.PersonalityJSON["summary"].(string); ok {
+		data.Personality = summary
+	}
+
+	// Restore the fields kept from the original card
+	for key, value := range comp.CardExtensions {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal card field %s: %w", key, err)
+		}
+		data.Extra[key] = raw
+	}
+	if err := setCharacterBook(&data, lorebook); err != nil {
+		return nil, err
+	}
+
+	fields := cardCompanionFields{
+		Category:           comp.Category,
+		Age:                comp.Age,
+		Personality:        personalitySliders(comp.PersonalityJSON),
+		Interests:          comp.Interests,
+		CommunicationStyle: comp.CommunicationStyle,
+		Appearance:         map[string]string{},
+	}
+	for k, v := range comp.AppearanceJSON {
+		if s, ok := v.(string); ok {
+			fields.Appearance[k] = s
+		}
+	}
+	if voice := voiceProfile(comp.VoiceJSON); voice != (services.VoiceProfile{}) {
+		fields.Voice = &voice
+	}
+	if err := data.SetExtension(cardExtensionKey, fields); err != nil {
+		return nil, fmt.Errorf("failed to write card extension: %w", err)
+	}
+
+	return services.NewCharacterCard(data), nil
+}
+
+// setCharacterBook writes the lorebook as the card's character_book entries,
+// keeping the other fields of a book kept from the original card
+func setCharacterBook(data *services.CharacterCardData, lorebook []models.LorebookEntry) error {
+	book := map[string]interface{}{}
+	raw, kept := data.Extra["character_book"]
+	if kept {
+		json.Unmarshal(raw, &book)
+	}
+	if !kept && len(lorebook) == 0 {
+		return nil
+	}
+
+	if _, ok := book["extensions"]; !ok {
+		book["extensions"] = map[string]interface{}{}
+	}
+	book["entries"] = services.CharacterBookEntries(loreEntries(lorebook))
+
+	out, err := json.Marshal(book)
+	if err != nil {
+		return fmt.Errorf("failed to marshal character book: %w", err)
+	}
+	data.Extra["character_book"] = out
+	return nil
+}
+
+// cardLorebook reads the lorebook entries from a card's character_book
+func cardLorebook(card *services.CharacterCard) []models.LorebookEntry {
+	var lorebook []models.LorebookEntry
+	for _, lore := range services.LoreFromCharacterBook(card.Data.Extra["character_book"]) {
+		keywords := normalizeKeywords(lore.Keywords)
+		if len(keywords) == 0 && !lore.AlwaysOn {
+			continue
+		}
+		lorebook = append(lorebook, models.LorebookEntry{
+			Keywords: keywords,
+			Content:  strings.TrimSpace(lore.Content),
+			Priority: lore.Priority,
+			AlwaysOn: lore.AlwaysOn,
+		})
+	}
+	return lorebook
+}
+
+// personalitySliders reads the trait sliders stored in personality_json
+func personalitySliders(j models.JSONB) *models.Personality {
+	trait := func(key string) int {
+		v, _ := j[key].(float64)
+		return int(v)
+	}
+	return &models.Personality{
+		Friendliness: trait("friendliness"),
+		Humor:        trait("humor"),
+		Intelligence: trait("intelligence"),
+		Romantic:     trait("romantic"),
+		Flirty:       trait("flirty"),
+	}
+}
+
+// cardCategory guesses a category for cards from other apps, which have none
+func cardCategory(tags []string) string {
+	for _, tag := range tags {
+		switch strings.ToLower(strings.TrimSpace(tag)) {
+		case "anime", "manga", "waifu", "husbando":
+			return "anime"
+		case "male", "man", "guy", "boy", "boyfriend":
+			return "guys"
+		}
+	}
+	return "girls"
+}
+
+// cardCompanionRequest maps a card onto a companion request.
+// Fields from the request override the guesses made for cards without our extension.
+// It also returns the card fields with no companion column, for the card_extensions column.
+func cardCompanionRequest(card *services.CharacterCard, category string, age int) (companionRequest, models.JSONB) {
+	data := card.Data
+	req := companionRequest{
+		Name:     strings.TrimSpace(data.Name),
+		Bio:      data.Description,
+		Tags:     data.Tags,
+		Greeting: data.FirstMes,
+		Scenario: data.Scenario,
+	}
+
+	var fields cardCompanionFields
+	if data.Extension(cardExtensionKey, &fields) {
+		req.Category = fields.Category
+		req.Age = fields.Age
+		if fields.Personality != nil {
+			req.Personality = *fields.Personality
+		}
+		req.Interests = fields.Interests
+		req.CommunicationStyle = fields.CommunicationStyle
+		req.Appearance = fields.Appearance
+		req.Voice = fields.Voice
+	}
+
+	if category != "" {
+		req.Category = category
+	} else if req.Category == "" {
+		req.Category = cardCategory(data.Tags)
+	}
+	if age != 0 {
+		req.Age = age
+	} else if req.Age == 0 {
+		req.Age = defaultCardAge
+	}
+
+	extensions := models.JSONB{}
+	for key, raw := range data.Extra {
+		var value interface{}
+		if json.Unmarshal(raw, &value) == nil {
+			extensions[key] = value
+		}
+	}
+	// Our own extension is rebuilt from the companion on export
+	if ext, ok := extensions["extensions"].(map[string]interface{}); ok {
+		delete(ext, cardExtensionKey)
+	}
+	// Book entries become the lorebook, which is exported in their place
+	if book, ok := extensions["character_book"].(map[string]interface{}); ok {
+		delete(book, "entries")
+	}
+
+	return req, extensions
+}
+
+// readCardUpload reads a card from the multipart "file" field or the raw request body
+func readCardUpload(c *gin.Context) ([]byte, error) {
+	var r io.Reader = c.Request.Body
+	if file, _, err := c.Request.FormFile("file"); err == nil {
+		defer file.Close()
+		r = file
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxImageUploadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	if len(data) > maxImageUploadSize {
+		return nil, fmt.Errorf("card must be smaller than %dMB", maxImageUploadSize>>20)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("card file is required")
+	}
+	return data, nil
+}
+
+// ImportCompanion creates a companion from a Character Card V2 JSON or PNG.
+// Optional category, age and visibility fields (form or query) fill in what the card lacks.
+func (h *Handlers) ImportCompanion(c *gin.Context) {
+	raw, err := readCardUpload(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	card, err := services.ParseCharacterCard(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	age, _ := strconv.Atoi(c.Request.FormValue("age"))
+	req, extensions := cardCompanionRequest(card, c.Request.FormValue("category"), age)
+	req.Visibility = c.Request.FormValue("visibility")
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	// Cards from other apps carry free-form tags; keep the ones we manage
+	patch := req.patch()
+	if !h.checkCompanionPatch(c, &patch, true) {
+		return
+	}
+
+	comp, ok := h.newCompanion(c, req.Visibility)
+	if !ok {
+		return
+	}
+	applyCompanionPatch(comp, patch)
+	if card.Data.Personality != "" {
+		comp.PersonalityJSON["summary"] = card.Data.Personality
+	}
+	comp.CardExtensions = extensions
+
+	// PNG cards double as the character's portrait, rendered like an uploaded avatar so the
+	// stored image is sized and drops the card's text chunks. The companion has no ID yet,
+	// so imported avatars share a folder.
+	if bytes.HasPrefix(raw, []byte("\x89PNG")) {
+		if variants, err := services.RenderAvatar(raw); err == nil {
+			if urls, err := h.storeAvatar("companions/imported", variants); err == nil {
+				comp.AvatarURL = urls.Full
+			}
+		}
+	}
+
+	if err := h.insertCompanion(comp, cardLorebook(card)...); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{Data: comp})
+}
+
+// ExportCompanion downloads a companion as a Character Card V2, as JSON or (format=png) embedded in its portrait
+func (h *Handlers) ExportCompanion(c *gin.Context) {
+	comp, err := h.loadCompanion(c.Param("id"))
+	if err == sql.ErrNoRows || (err == nil && !h.canViewCompanion(viewerID(c), comp)) {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "companion not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	lorebook, err := h.loadLorebook(comp.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	card, err := companionCard(comp, lorebook)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, comp.ID))
+		c.JSON(http.StatusOK, card)
+	case "png":
+		out, err := services.EmbedCardPNG(h.avatarPNG(comp.ID, comp.AvatarURL), card)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.png"`, comp.ID))
+		c.Data(http.StatusOK, "image/png", out)
+	default:
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "format must be json or png"})
+	}
+}
+
+// avatarPNG loads a companion portrait as PNG, falling back to a plain card when it is unavailable.
+// Converted portraits are cached until the companion's avatar changes.
+func (h *Handlers) avatarPNG(companionID, avatarURL string) []byte {
+	if data, ok := h.cardPortraits.get(companionID, avatarURL); ok {
+		return data
+	}
+
+	data, err := h.readAvatar(avatarURL)
+	if err == nil {
+		if !bytes.HasPrefix(data, []byte("\x89PNG")) {
+			data, err = services.RenderPortraitPNG(data)
+		}
+		if err == nil {
+			h.cardPortraits.put(companionID, avatarURL, data)
+			return data
+		}
+	}
+
+	// Plain pink card in the usual 2:3 portrait ratio
+	img := image.NewRGBA(image.Rect(0, 0, 400, 600))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.RGBA{R: 236, G: 72, B: 153, A: 255}}, image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// portraitCache keeps each companion's card portrait, tagged with the avatar URL it was made from
+type portraitCache struct {
+	mu      sync.Mutex
+	entries map[string]portraitCacheEntry
+}
+
+type portraitCacheEntry struct {
+	avatarURL string
+	data      []byte
+}
+
+func newPortraitCache() *portraitCache {
+	return &portraitCache{entries: make(map[string]portraitCacheEntry)}
+}
+
+// get returns the companion's portrait if it was made from avatarURL
+func (c *portraitCache) get(companionID, avatarURL string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[companionID]
+	if !ok || entry.avatarURL != avatarURL {
+		return nil, false
+	}
+	return entry.data, true
+}
+
+// put stores the companion's portrait made from avatarURL
+func (c *portraitCache) put(companionID, avatarURL string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[companionID] = portraitCacheEntry{avatarURL: avatarURL, data: data}
+}
+
+// avatarClient fetches remote avatars. Avatar URLs are user-supplied, so it only connects to
+// public addresses; the check runs on the address dialed, covering redirects and DNS changes.
+var avatarClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: 5 * time.Second, Control: refuseNonPublicAddress}).DialContext,
+	},
+}
+
+// refuseNonPublicAddress is a net.Dialer control function that rejects addresses that are not
+// publicly routable
+func refuseNonPublicAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("avatar host %s is not a public address", host)
+	}
+	return nil
+}
+
+// isPublicIP reports whether ip is outside the loopback, private, link-local and other
+// special-purpose ranges
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which net.IP.IsPrivate leaves out
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// readAvatar reads an avatar from local media storage or over HTTP from a public host
+func (h *Handlers) readAvatar(avatarURL string) ([]byte, error) {
+	if local, ok := h.storage.(*storage.LocalStorage); ok && strings.HasPrefix(avatarURL, local.BasePath()+"/") {
+		rc, err := h.storage.Open(strings.TrimPrefix(avatarURL, local.BasePath()+"/"))
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(io.LimitReader(rc, maxImageUploadSize))
+	}
+
+	if !strings.HasPrefix(avatarURL, "http://") && !strings.HasPrefix(avatarURL, "https://") {
+		return nil, fmt.Errorf("avatar is not reachable from the server")
+	}
+
+	resp, err := avatarClient.Get(avatarURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("avatar request failed: status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxImageUploadSize))
+}
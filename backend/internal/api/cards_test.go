@@ -0,0 +1,166 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/services"
+)
+
+func TestCardCompanionRequestFromForeignCard(t *testing.T) {
+	card, err := services.ParseCharacterCard([]byte(`{
+		"spec": "chara_card_v2",
+		"spec_version": "2.0",
+		"data": {"name": "Kaito", "description": "Quiet swordsman.", "first_mes": "...", "tags": ["Anime"], "mes_example": "<START>"}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseCharacterCard returned error: %v", err)
+	}
+
+	req, extensions := cardCompanionRequest(card, "", 0)
+	if req.Name != "Kaito" || req.Bio != "Quiet swordsman." || req.Greeting != "..." {
+		t.Errorf("fields not mapped: %+v", req)
+	}
+	if req.Category != "anime" || req.Age != defaultCardAge {
+		t.Errorf("Category/Age = %q/%d, want anime/%d", req.Category, req.Age, defaultCardAge)
+	}
+	if extensions["mes_example"] != "<START>" {
+		t.Errorf("unknown fields not kept: %v", extensions)
+	}
+
+	req, _ = cardCompanionRequest(card, "guys", 30)
+	if req.Category != "guys" || req.Age != 30 {
+		t.Errorf("request values should override guesses, got %q/%d", req.Category, req.Age)
+	}
+}
+
+func TestCompanionCardRoundTrip(t *testing.T) {
+	greeting := "Hey you!"
+	comp := &models.Companion{
+		Name:               "Mia Chen",
+		Category:           "girls",
+		Bio:                "Artist from SF.",
+		Age:                24,
+		Tags:               []string{"Creative"},
+		Greeting:           &greeting,
+		PersonalityJSON:    models.JSONB{"humor": float64(80), "summary": "witty and warm"},
+		CommunicationStyle: "playful",
+		AppearanceJSON:     models.JSONB{"hairColor": "black"},
+		VoiceJSON:          models.JSONB{"voiceId": "nova"},
+		CardExtensions:     models.JSONB{"mes_example": "<START>"},
+	}
+
+	card, err := companionCard(comp, nil)
+	if err != nil {
+		t.Fatalf("companionCard returned error: %v", err)
+	}
+	if card.Data.Description != "Artist from SF." || card.Data.FirstMes != "Hey you!" || card.Data.Personality != "witty and warm" {
+		t.Errorf("fields not exported: %+v", card.Data)
+	}
+
+	req, extensions := cardCompanionRequest(card, "", 0)
+	if req.Category != "girls" || req.Age != 24 || req.Personality.Humor != 80 || req.CommunicationStyle != "playful" {
+		t.Errorf("companion fields lost in round trip: %+v", req)
+	}
+	if req.Appearance["hairColor"] != "black" || req.Voice == nil || req.Voice.VoiceID != "nova" {
+		t.Errorf("appearance/voice lost in round trip: %+v", req)
+	}
+	if extensions["mes_example"] != "<START>" {
+		t.Errorf("card extensions lost in round trip: %v", extensions)
+	}
+	if ext, ok := extensions["extensions"].(map[string]interface{}); ok {
+		if _, found := ext[cardExtensionKey]; found {
+			t.Error("our own extension should not be stored in card_extensions")
+		}
+	}
+}
+
+func TestCompanionCardLorebookRoundTrip(t *testing.T) {
+	comp := &models.Companion{
+		Name:           "Seraphina",
+		Category:       "girls",
+		Age:            25,
+		CardExtensions: models.JSONB{"character_book": map[string]interface{}{"name": "Forest", "scan_depth": float64(3)}},
+	}
+	lorebook := []models.LorebookEntry{
+		{Keywords: []string{"glade"}, Content: "A hidden clearing.", Priority: 5},
+		{Content: "Magic is real.", AlwaysOn: true},
+	}
+
+	card, err := companionCard(comp, lorebook)
+	if err != nil {
+		t.Fatalf("companionCard returned error: %v", err)
+	}
+
+	imported := cardLorebook(card)
+	if len(imported) != 2 {
+		t.Fatalf("cardLorebook returned %d entries, want 2", len(imported))
+	}
+	if imported[0].Content != "A hidden clearing." || imported[0].Priority != 5 || imported[0].Keywords[0] != "glade" {
+		t.Errorf("keyword entry lost in round trip: %+v", imported[0])
+	}
+	if !imported[1].AlwaysOn {
+		t.Errorf("always-on entry lost in round trip: %+v", imported[1])
+	}
+
+	_, extensions := cardCompanionRequest(card, "", 0)
+	book, ok := extensions["character_book"].(map[string]interface{})
+	if !ok || book["name"] != "Forest" {
+		t.Fatalf("book fields lost in round trip: %v", extensions["character_book"])
+	}
+	if _, found := book["entries"]; found {
+		t.Error("book entries should become the lorebook, not stay in card_extensions")
+	}
+}
+
+func TestCompanionCardWithoutLorebook(t *testing.T) {
+	card, err := companionCard(&models.Companion{Name: "Mia"}, nil)
+	if err != nil {
+		t.Fatalf("companionCard returned error: %v", err)
+	}
+	if _, ok := card.Data.Extra["character_book"]; ok {
+		t.Error("companions without a lorebook should export no character_book")
+	}
+}
+
+func TestReadAvatarRefusesInternalHosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+
+	h := NewHandlers(nil, nil)
+	if data, err := h.readAvatar(server.URL + "/avatar.png"); err == nil {
+		t.Errorf("readAvatar on a loopback host returned %q, want an error", data)
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:4700::6810:85e5", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
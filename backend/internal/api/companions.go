@@ -0,0 +1,319 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/services"
+)
+
+// companionRequest is the body for creating or replacing a companion
+type companionRequest struct {
+	Name               string                 `json:"name" binding:"required"`
+	Category           string                 `json:"category" binding:"required"` // Checked against the categories table
+	Bio                string                 `json:"bio"`
+	AvatarURL          string                 `json:"avatarUrl"`
+	Personality        models.Personality     `json:"personality"`
+	Tags               []string               `json:"tags"`
+	Age                int                    `json:"age" binding:"required,min=18,max=100"`
+	Greeting           string                 `json:"greeting"`
+	Scenario           string                 `json:"scenario"`
+	CommunicationStyle string                 `json:"communicationStyle"`
+	Interests          []string               `json:"interests"`
+	Appearance         map[string]string      `json:"appearance"`
+	Voice              *services.VoiceProfile `json:"voice"`
+	Visibility         string                 `json:"visibility" binding:"omitempty,oneof=private unlisted public"`
+}
+
+// companionPatch is the body for partially updating a companion; nil fields are left unchanged
+type companionPatch struct {
+	Name               *string                `json:"name" binding:"omitempty,min=1"`
+	Category           *string                `json:"category" binding:"omitempty,min=1"`
+	Bio                *string                `json:"bio"`
+	AvatarURL          *string                `json:"avatarUrl"`
+	Personality        *models.Personality    `json:"personality"`
+	Tags               []string               `json:"tags"`
+	Age                *int                   `json:"age" binding:"omitempty,min=18,max=100"`
+	Greeting           *string                `json:"greeting"`
+	Scenario           *string                `json:"scenario"`
+	CommunicationStyle *string                `json:"communicationStyle"`
+	Interests          []string               `json:"interests"`
+	Appearance         map[string]string      `json:"appearance"`
+	Voice              *services.VoiceProfile `json:"voice"`
+	Visibility         *string                `json:"visibility" binding:"omitempty,oneof=private unlisted public"`
+}
+
+// patch converts a full request into a patch that sets every field.
+// Omitted lists and appearance are cleared; an omitted visibility is left unchanged.
+func (r companionRequest) patch() companionPatch {
+	p := companionPatch{
+		Name:               &r.Name,
+		Category:           &r.Category,
+		Bio:                &r.Bio,
+		AvatarURL:          &r.AvatarURL,
+		Personality:        &r.Personality,
+		Tags:               r.Tags,
+		Age:                &r.Age,
+		Greeting:           &r.Greeting,
+		Scenario:           &r.Scenario,
+		CommunicationStyle: &r.CommunicationStyle,
+		Interests:          r.Interests,
+		Appearance:         r.Appearance,
+		Voice:              r.Voice,
+	}
+	if p.Tags == nil {
+		p.Tags = []string{}
+	}
+	if p.Interests == nil {
+		p.Interests = []string{}
+	}
+	if p.Appearance == nil {
+		p.Appearance = map[string]string{}
+	}
+	if p.Voice == nil {
+		p.Voice = &services.VoiceProfile{}
+	}
+	if r.Visibility != "" {
+		p.Visibility = &r.Visibility
+	}
+	return p
+}
+
+// applyCompanionPatch copies the set fields of a patch onto a companion
+func applyCompanionPatch(comp *models.Companion, p companionPatch) {
+	if p.Name != nil {
+		comp.Name = *p.Name
+	}
+	if p.Category != nil {
+		comp.Category = *p.Category
+	}
+	if p.Bio != nil {
+		comp.Bio = *p.Bio
+	}
+	if p.AvatarURL != nil {
+		comp.AvatarURL = *p.AvatarURL
+	}
+	if p.Personality != nil {
+		personality := models.JSONB{
+			"friendliness": p.Personality.Friendliness,
+			"humor":        p.Personality.Humor,
+			"intelligence": p.Personality.Intelligence,
+			"romantic":     p.Personality.Romantic,
+			"flirty":       p.Personality.Flirty,
+		}
+		// Keep the free-text personality imported from character cards
+		if summary, ok := comp.PersonalityJSON["summary"]; ok {
+			personality["summary"] = summary
+		}
+		comp.PersonalityJSON = personality
+	}
+	if p.Tags != nil {
+		comp.Tags = p.Tags
+	}
+	if p.Age != nil {
+		comp.Age = *p.Age
+	}
+	if p.Greeting != nil {
+		comp.Greeting = optionalString(*p.Greeting)
+	}
+	if p.Scenario != nil {
+		comp.Scenario = optionalString(*p.Scenario)
+	}
+	if p.CommunicationStyle != nil {
+		comp.CommunicationStyle = *p.CommunicationStyle
+		if comp.CommunicationStyle == "" {
+			comp.CommunicationStyle = "friendly"
+		}
+	}
+	if p.Interests != nil {
+		comp.Interests = p.Interests
+	}
+	if p.Appearance != nil {
+		comp.AppearanceJSON = models.JSONB{}
+		for k, v := range p.Appearance {
+			comp.AppearanceJSON[k] = v
+		}
+	}
+	if p.Voice != nil {
+		comp.VoiceJSON = voiceJSON(*p.Voice)
+	}
+	if p.Visibility != nil {
+		comp.Visibility = *p.Visibility
+	}
+}
+
+// optionalString maps an empty string to a NULL column
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// viewerID returns the signed-in user's ID, or "" for guests
+func viewerID(c *gin.Context) string {
+	if userID, exists := c.Get("userID"); exists {
+		return userID.(string)
+	}
+	return ""
+}
+
+// canManageCompanion reports whether a user may edit or delete a companion: its owner or an admin
+func (h *Handlers) canManageCompanion(userID string, comp *models.Companion) bool {
+	if userID == "" {
+		return false
+	}
+	if comp.CreatedBy != nil && *comp.CreatedBy == userID {
+		return true
+	}
+	admin, err := h.authService.IsAdmin(userID)
+	return err == nil && admin
+}
+
+// canViewCompanion reports whether a user may open a companion.
+// Unlisted companions are reachable by ID; private ones only by their owner and admins.
+func (h *Handlers) canViewCompanion(userID string, comp *models.Companion) bool {
+	return comp.Visibility != "private" || h.canManageCompanion(userID, comp)
+}
+
+// manageableCompanion loads the companion in the :id param and checks the user may manage it.
+// It writes the error response and returns nil if not.
+func (h *Handlers) manageableCompanion(c *gin.Context) *models.Companion {
+	comp, err := h.loadCompanion(c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "companion not found"})
+		return nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return nil
+	}
+
+	userID := viewerID(c)
+	if !h.canManageCompanion(userID, comp) {
+		// Don't reveal private companions to other users
+		if !h.canViewCompanion(userID, comp) {
+			c.JSON(http.StatusNotFound, models.APIResponse{Error: "companion not found"})
+			return nil
+		}
+		c.JSON(http.StatusForbidden, models.APIResponse{Error: "only the owner or an admin can change this companion"})
+		return nil
+	}
+
+	return comp
+}
+
+// checkCompanionPatch validates the fields of a patch that need more than binding rules:
+// the avatar URL, then the category and tags (see checkTaxonomy).
+// It writes the error response and returns false if the patch is invalid.
+func (h *Handlers) checkCompanionPatch(c *gin.Context, p *companionPatch, dropUnknownTags bool) bool {
+	if p.AvatarURL != nil && !h.validAvatarURL(*p.AvatarURL) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "avatarUrl must be an http(s) URL or an uploaded avatar"})
+		return false
+	}
+	return h.checkTaxonomy(c, p, dropUnknownTags)
+}
+
+// saveCompanion writes the editable fields of a companion and snapshots them as a new revision
+func (h *Handlers) saveCompanion(comp *models.Companion, editedBy string) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec(
+		`UPDATE companions SET name = $2, category = $3, bio = $4, avatar_url = $5, personality_json = $6,
+			tags = $7, age = $8, greeting = $9, scenario = $10, communication_style = $11, interests = $12,
+			appearance_json = $13, voice_json = $14, visibility = $15, updated_at = $16
+		WHERE id = $1`,
+		comp.ID, comp.Name, comp.Category, comp.Bio, comp.AvatarURL, comp.PersonalityJSON,
+		pq.Array(comp.Tags), comp.Age, comp.Greeting, comp.Scenario, comp.CommunicationStyle, pq.Array(comp.Interests),
+		comp.AppearanceJSON, comp.VoiceJSON, comp.Visibility, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := insertRevision(tx, comp, optionalString(editedBy)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	comp.UpdatedAt = &now
+	return nil
+}
+
+// ReplaceCompanion replaces all editable fields of a companion (PUT)
+func (h *Handlers) ReplaceCompanion(c *gin.Context) {
+	var req companionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	patch := req.patch()
+	if !h.checkCompanionPatch(c, &patch, false) {
+		return
+	}
+	applyCompanionPatch(comp, patch)
+	if err := h.saveCompanion(comp, viewerID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: comp})
+}
+
+// UpdateCompanion changes only the fields present in the body (PATCH)
+func (h *Handlers) UpdateCompanion(c *gin.Context) {
+	var req companionPatch
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	if !h.checkCompanionPatch(c, &req, false) {
+		return
+	}
+	applyCompanionPatch(comp, req)
+	if err := h.saveCompanion(comp, viewerID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: comp})
+}
+
+// DeleteCompanion removes a companion along with its stories and conversations
+func (h *Handlers) DeleteCompanion(c *gin.Context) {
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	if _, err := h.db.Exec(`DELETE FROM companions WHERE id = $1`, comp.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "companion deleted"})
+}
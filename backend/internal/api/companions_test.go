@@ -0,0 +1,64 @@
+package api
+
+import (
+	"testing"
+
+	"nectar-ai-companion/internal/models"
+)
+
+func TestApplyCompanionPatchLeavesUnsetFields(t *testing.T) {
+	greeting := "Hi there"
+	comp := models.Companion{
+		Name:               "Mia",
+		Category:           "girls",
+		Age:                24,
+		Tags:               []string{"Caring"},
+		Greeting:           &greeting,
+		CommunicationStyle: "playful",
+		Visibility:         "public",
+	}
+
+	name := "Mia Chen"
+	empty := ""
+	private := "private"
+	applyCompanionPatch(&comp, companionPatch{Name: &name, Greeting: &empty, Visibility: &private})
+
+	if comp.Name != "Mia Chen" {
+		t.Errorf("Name = %q, want Mia Chen", comp.Name)
+	}
+	if comp.Greeting != nil {
+		t.Errorf("Greeting = %q, want cleared", *comp.Greeting)
+	}
+	if comp.Visibility != "private" {
+		t.Errorf("Visibility = %q, want private", comp.Visibility)
+	}
+	if comp.Category != "girls" || comp.Age != 24 || len(comp.Tags) != 1 || comp.CommunicationStyle != "playful" {
+		t.Errorf("unset fields changed: %+v", comp)
+	}
+}
+
+func TestCompanionRequestPatchReplacesEverything(t *testing.T) {
+	comp := models.Companion{
+		Tags:               []string{"Caring"},
+		Interests:          []string{"Art"},
+		AppearanceJSON:     models.JSONB{"hairColor": "black"},
+		CommunicationStyle: "playful",
+		Visibility:         "unlisted",
+	}
+
+	req := companionRequest{Name: "Kai", Category: "guys", Age: 27}
+	applyCompanionPatch(&comp, req.patch())
+
+	if comp.Name != "Kai" || comp.Category != "guys" || comp.Age != 27 {
+		t.Errorf("required fields not applied: %+v", comp)
+	}
+	if len(comp.Tags) != 0 || len(comp.Interests) != 0 || len(comp.AppearanceJSON) != 0 {
+		t.Errorf("omitted lists should be cleared: %+v", comp)
+	}
+	if comp.CommunicationStyle != "friendly" {
+		t.Errorf("CommunicationStyle = %q, want friendly default", comp.CommunicationStyle)
+	}
+	if comp.Visibility != "unlisted" {
+		t.Errorf("Visibility = %q, omitted visibility should be kept", comp.Visibility)
+	}
+}
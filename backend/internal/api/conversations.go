@@ -0,0 +1,450 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nectar-ai-companion/internal/models"
+)
+
+// conversationColumns lists the conversation columns read by scanConversation
+const conversationColumns = `id, user_id, companion_id, title, companion_revision_id, persona_id, active_leaf_id, archived_at, created_at`
+
+// scanConversation scans a row selected with conversationColumns
+func scanConversation(row rowScanner, conv *models.Conversation) error {
+	return row.Scan(&conv.ID, &conv.UserID, &conv.CompanionID, &conv.Title, &conv.CompanionRevisionID,
+		&conv.PersonaID, &conv.ActiveLeafID, &conv.ArchivedAt, &conv.CreatedAt)
+}
+
+// loadConversation fetches one of the user's conversations, returning sql.ErrNoRows if it does not exist
+func (h *Handlers) loadConversation(userID, conversationID string) (*models.Conversation, error) {
+	var conv models.Conversation
+	row := h.db.QueryRow(
+		`SELECT `+conversationColumns+` FROM conversations WHERE id = $1 AND user_id = $2`,
+		conversationID, userID,
+	)
+	if err := scanConversation(row, &conv); err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// ownedConversation loads one of the user's conversations, writing the error response itself if it can't
+func (h *Handlers) ownedConversation(c *gin.Context, userID, conversationID string) (*models.Conversation, bool) {
+	conv, err := h.loadConversation(userID, conversationID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "conversation not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return nil, false
+	}
+	return conv, true
+}
+
+// requestedPersona checks that a persona picked in a request is the user's own, writing the
+// error response itself if it isn't. An empty ID gives nil, which chats as the default persona.
+func (h *Handlers) requestedPersona(c *gin.Context, userID, personaID string) (*string, bool) {
+	if personaID == "" {
+		return nil, true
+	}
+	p, err := h.loadPersona(userID, personaID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "persona not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return nil, false
+	}
+	return &p.ID, true
+}
+
+// insertConversation creates a conversation, pinned to the companion's current revision
+// unless followLatest is set
+func (h *Handlers) insertConversation(conv *models.Conversation, followLatest bool) error {
+	conv.ID = uuid.New().String()
+	return h.db.QueryRow(
+		`INSERT INTO conversations (id, user_id, companion_id, title, companion_revision_id, persona_id)
+		VALUES ($1, $2, $3, $4, CASE WHEN $5 THEN NULL ELSE
+			(SELECT id FROM companion_revisions WHERE companion_id = $3 ORDER BY revision DESC LIMIT 1) END, $6)
+		RETURNING companion_revision_id, created_at`,
+		conv.ID, conv.UserID, conv.CompanionID, conv.Title, followLatest, conv.PersonaID,
+	).Scan(&conv.CompanionRevisionID, &conv.CreatedAt)
+}
+
+// inboxPreviewLength caps the characters of the last message shown in the inbox
+const inboxPreviewLength = 120
+
+// ListConversations is the user's inbox: their threads with companion, and the last message and
+// unread count of each thread's active branch, most recently active first. Filter with companionId,
+// include archived threads with archived=true, and page with limit and the nextCursor of the previous page.
+func (h *Handlers) ListConversations(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	where := []string{"conv.user_id = $1"}
+	args := []interface{}{userID}
+	if companionID := c.Query("companionId"); companionID != "" {
+		args = append(args, companionID)
+		where = append(where, "conv.companion_id = $"+strconv.Itoa(len(args)))
+	}
+	if c.Query("archived") != "true" {
+		where = append(where, "conv.archived_at IS NULL")
+	}
+
+	cursorFilter := ""
+	if cursor := c.Query("cursor"); cursor != "" {
+		at, id, err := decodeInboxCursor(cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{Error: "invalid cursor"})
+			return
+		}
+		args = append(args, at, id)
+		cursorFilter = fmt.Sprintf("WHERE (inbox.activity_at, inbox.id) < ($%d, $%d::uuid)", len(args)-1, len(args))
+	}
+	args = append(args, limit+1)
+
+	rows, err := h.db.Query(
+		`SELECT * FROM (
+			SELECT `+prefixColumns("conv", conversationColumns)+`,
+				comp.name, COALESCE(comp.avatar_url, ''), last.sender, last.content,
+				COALESCE(last.created_at, conv.created_at) AS activity_at,
+				(WITH RECURSIVE path AS (
+					SELECT id, parent_id, sender, created_at, deleted_at FROM messages WHERE id = conv.active_leaf_id
+					UNION ALL
+					SELECT m.id, m.parent_id, m.sender, m.created_at, m.deleted_at
+					FROM messages m JOIN path ON m.id = path.parent_id
+					WHERE r.last_read_at IS NULL OR path.created_at > r.last_read_at
+				)
+				SELECT COUNT(*) FROM path WHERE sender = 'ai' AND deleted_at IS NULL
+					AND (r.last_read_at IS NULL OR created_at > r.last_read_at)) AS unread
+			FROM conversations conv
+			JOIN companions comp ON comp.id = conv.companion_id
+			LEFT JOIN conversation_reads r ON r.conversation_id = conv.id AND r.user_id = conv.user_id
+			LEFT JOIN LATERAL (
+				WITH RECURSIVE path AS (
+					SELECT id, parent_id, sender, content, created_at, deleted_at FROM messages WHERE id = conv.active_leaf_id
+					UNION ALL
+					SELECT m.id, m.parent_id, m.sender, m.content, m.created_at, m.deleted_at
+					FROM messages m JOIN path ON m.id = path.parent_id
+					WHERE path.deleted_at IS NOT NULL
+				)
+				SELECT sender, content, created_at FROM path WHERE deleted_at IS NULL LIMIT 1
+			) last ON TRUE
+			WHERE `+strings.Join(where, " AND ")+`
+		) inbox `+cursorFilter+`
+		ORDER BY inbox.activity_at DESC, inbox.id DESC
+		LIMIT $`+strconv.Itoa(len(args)),
+		args...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	entries := []models.ConversationSummary{}
+	for rows.Next() {
+		var e models.ConversationSummary
+		var sender, content sql.NullString
+		if err := rows.Scan(&e.ID, &e.UserID, &e.CompanionID, &e.Title, &e.CompanionRevisionID, &e.PersonaID,
+			&e.ActiveLeafID, &e.ArchivedAt, &e.CreatedAt, &e.Companion.Name, &e.Companion.AvatarURL, &sender, &content,
+			&e.LastActivityAt, &e.UnreadCount); err != nil {
+			continue
+		}
+		e.Companion.ID = e.CompanionID
+		if sender.Valid {
+			e.LastMessage = &models.MessagePreview{Sender: sender.String, Preview: messagePreview(content.String)}
+		}
+		entries = append(entries, e)
+	}
+
+	var next string
+	if len(entries) > limit {
+		entries = entries[:limit]
+		last := entries[limit-1]
+		next = encodeInboxCursor(last.LastActivityAt, last.ID)
+	}
+
+	c.JSON(http.StatusOK, models.CursorResponse{Data: entries, NextCursor: next})
+}
+
+// prefixColumns qualifies a comma-separated column list with a table alias
+func prefixColumns(alias, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, col := range parts {
+		parts[i] = alias + "." + strings.TrimSpace(col)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// messagePreview shortens a message for lists; image-only messages read as a photo
+func messagePreview(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	if content == "" {
+		return photoPlaceholder
+	}
+	if runes := []rune(content); len(runes) > inboxPreviewLength {
+		return strings.TrimSpace(string(runes[:inboxPreviewLength])) + "…"
+	}
+	return content
+}
+
+// encodeInboxCursor encodes the position after an inbox entry
+func encodeInboxCursor(activityAt time.Time, conversationID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(activityAt.UTC().Format(time.RFC3339Nano) + "|" + conversationID))
+}
+
+// decodeInboxCursor reads a cursor made by encodeInboxCursor
+func decodeInboxCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, "", fmt.Errorf("malformed cursor")
+	}
+	activityAt, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return time.Time{}, "", err
+	}
+	return activityAt, id, nil
+}
+
+// CreateConversation starts a new thread with a companion
+func (h *Handlers) CreateConversation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.CreateConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	comp, err := h.loadCompanion(req.CompanionID)
+	if err == sql.ErrNoRows || (err == nil && !h.canViewCompanion(userID.(string), comp)) {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "companion not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	personaID, ok := h.requestedPersona(c, userID.(string), req.PersonaID)
+	if !ok {
+		return
+	}
+
+	conv := models.Conversation{
+		UserID:      userID.(string),
+		CompanionID: comp.ID,
+		Title:       strings.TrimSpace(req.Title),
+		PersonaID:   personaID,
+	}
+	if err := h.insertConversation(&conv, req.FollowLatest); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{Data: conv})
+}
+
+// UpdateConversation renames, archives or unarchives one of the user's threads
+func (h *Handlers) UpdateConversation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.UpdateConversationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	conv, ok := h.ownedConversation(c, userID.(string), c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if req.Title != nil {
+		conv.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.Archived != nil {
+		switch {
+		case *req.Archived && conv.ArchivedAt == nil:
+			now := time.Now()
+			conv.ArchivedAt = &now
+		case !*req.Archived:
+			conv.ArchivedAt = nil
+		}
+	}
+
+	_, err := h.db.Exec(
+		`UPDATE conversations SET title = $2, archived_at = $3 WHERE id = $1`,
+		conv.ID, conv.Title, conv.ArchivedAt,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: conv})
+}
+
+// DeleteConversation deletes one of the user's threads with its messages
+func (h *Handlers) DeleteConversation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	result, err := h.db.Exec(`DELETE FROM conversations WHERE id = $1 AND user_id = $2`, c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "conversation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "conversation deleted"})
+}
+
+// GetConversationMessages returns the history of one of the user's threads
+func (h *Handlers) GetConversationMessages(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	conv, ok := h.ownedConversation(c, userID.(string), c.Param("id"))
+	if !ok {
+		return
+	}
+
+	// Loading a thread delivers its replies to the user; the history is returned either way
+	if _, err := h.markDelivered(conv.ID); err != nil {
+		log.Printf("Failed to mark messages delivered in conversation %s: %v", conv.ID, err)
+	}
+
+	h.writeChatHistory(c, conv)
+}
+
+// historyPage reads the page and pageSize query parameters of a history request
+func historyPage(c *gin.Context) (page, pageSize int) {
+	page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ = strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 50
+	}
+	return page, pageSize
+}
+
+// writeChatHistory writes a page of a conversation's messages with their attachments, oldest first.
+// Only the active branch is shown unless branches=all asks for every message.
+func (h *Handlers) writeChatHistory(c *gin.Context, conv *models.Conversation) {
+	page, pageSize := historyPage(c)
+	offset := (page - 1) * pageSize
+
+	// Get messages
+	var rows *sql.Rows
+	var err error
+	var total int
+	if conv.ActiveLeafID == nil || c.Query("branches") == "all" {
+		rows, err = h.db.Query(
+			`SELECT `+messageColumns+`
+			FROM messages WHERE conversation_id = $1 AND deleted_at IS NULL
+			ORDER BY created_at ASC LIMIT $2 OFFSET $3`,
+			conv.ID, pageSize, offset,
+		)
+		h.db.QueryRow("SELECT COUNT(*) FROM messages WHERE conversation_id = $1 AND deleted_at IS NULL", conv.ID).Scan(&total)
+	} else {
+		rows, err = h.db.Query(
+			messagePathCTE+` SELECT `+messageColumns+`
+			FROM path WHERE deleted_at IS NULL
+			ORDER BY depth DESC LIMIT $3 OFFSET $4`,
+			*conv.ActiveLeafID, maxPathDepth, pageSize, offset,
+		)
+		h.db.QueryRow(
+			messagePathCTE+` SELECT COUNT(*) FROM path WHERE deleted_at IS NULL`,
+			*conv.ActiveLeafID, maxPathDepth,
+		).Scan(&total)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	messages := []models.Message{}
+	var messageIDs []string
+	for rows.Next() {
+		var msg models.Message
+		if err := scanMessage(rows, &msg); err != nil {
+			continue
+		}
+		messages = append(messages, msg)
+		messageIDs = append(messageIDs, msg.ID)
+	}
+
+	// Attach images, audio and other media
+	attachments, err := h.loadAttachments(messageIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	for i := range messages {
+		setAttachments(&messages[i], attachments[messages[i].ID])
+	}
+	if err := h.setReactions(messages, conv.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	totalPages := (total + pageSize - 1) / pageSize
+
+	c.JSON(http.StatusOK, models.PaginatedResponse{
+		Data:       messages,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: totalPages,
+	})
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"nectar-ai-companion/internal/models"
+)
+
+func TestHistoryPage(t *testing.T) {
+	tests := []struct {
+		query      string
+		page, size int
+	}{
+		{"", 1, 50},
+		{"?page=3&pageSize=20", 3, 20},
+		{"?page=0&pageSize=500", 1, 50},
+		{"?page=abc&pageSize=-1", 1, 50},
+	}
+
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest("GET", "/history"+tt.query, nil)
+		page, size := historyPage(c)
+		if page != tt.page || size != tt.size {
+			t.Errorf("historyPage(%q) = %d, %d; want %d, %d", tt.query, page, size, tt.page, tt.size)
+		}
+	}
+}
+
+func TestUpdateConversationValidation(t *testing.T) {
+	router := setupTestRouter()
+	router.PATCH("/api/chat/conversations/:id", func(c *gin.Context) {
+		var req models.UpdateConversationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "valid"})
+	})
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"Rename", `{"title":"Beach trip"}`, http.StatusOK},
+		{"Archive", `{"archived":true}`, http.StatusOK},
+		{"Clear title", `{"title":""}`, http.StatusOK},
+		{"Long title", `{"title":"` + strings.Repeat("a", 101) + `"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("PATCH", "/api/chat/conversations/1", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestInboxCursorRoundTrip(t *testing.T) {
+	at := time.Date(2025, 3, 1, 12, 30, 45, 123456000, time.FixedZone("CET", 3600))
+	id := "5f0c6a0e-8d2b-4c8e-9a43-2f3c1d1b7e21"
+
+	gotAt, gotID, err := decodeInboxCursor(encodeInboxCursor(at, id))
+	if err != nil {
+		t.Fatalf("decodeInboxCursor: %v", err)
+	}
+	if !gotAt.Equal(at) || gotID != id {
+		t.Errorf("round trip = %v, %q; want %v, %q", gotAt, gotID, at, id)
+	}
+
+	for _, bad := range []string{"not base64!", "bm8tc2VwYXJhdG9y", encodeInboxCursor(at, "not-a-uuid")} {
+		if _, _, err := decodeInboxCursor(bad); err == nil {
+			t.Errorf("decodeInboxCursor(%q) should fail", bad)
+		}
+	}
+}
+
+func TestMessagePreview(t *testing.T) {
+	if got := messagePreview("  Hello\n\nthere  "); got != "Hello there" {
+		t.Errorf("preview = %q", got)
+	}
+	if got := messagePreview(""); got != photoPlaceholder {
+		t.Errorf("empty preview = %q, want the photo placeholder", got)
+	}
+	long := strings.Repeat("é", inboxPreviewLength+10)
+	if got := messagePreview(long); got != strings.Repeat("é", inboxPreviewLength)+"…" {
+		t.Errorf("long preview not cut at %d characters: %q", inboxPreviewLength, got)
+	}
+}
+
+func TestPrefixColumns(t *testing.T) {
+	if got := prefixColumns("conv", "id, user_id,title"); got != "conv.id, conv.user_id, conv.title" {
+		t.Errorf("prefixColumns = %q", got)
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/services"
+)
+
+// defaultValidationRatio is the share of conversations exported as validation data by default
+const defaultValidationRatio = 0.1
+
+// trainingDataQuery is a parsed training data export request
+type trainingDataQuery struct {
+	filter          services.DatasetFilter
+	format          string
+	split           string // train, validation or all
+	validationRatio float64
+}
+
+// parseTrainingDataQuery reads the export options from the query string: format (openai or
+// anthropic), rating (up, down or any; default up), companionId, from, to, split and validation
+func parseTrainingDataQuery(c *gin.Context) (*trainingDataQuery, error) {
+	q := &trainingDataQuery{
+		format:          c.DefaultQuery("format", services.DatasetFormatOpenAI),
+		split:           c.DefaultQuery("split", "all"),
+		validationRatio: defaultValidationRatio,
+	}
+	if !services.ValidDatasetFormat(q.format) {
+		return nil, fmt.Errorf("format must be openai or anthropic")
+	}
+	if q.split != "all" && q.split != services.DatasetSplitTrain && q.split != services.DatasetSplitValidation {
+		return nil, fmt.Errorf("split must be train, validation or all")
+	}
+
+	switch rating := c.DefaultQuery("rating", "up"); rating {
+	case "up", "down":
+		q.filter.Rating = rating
+	case "any":
+	default:
+		return nil, fmt.Errorf("rating must be up, down or any")
+	}
+	q.filter.CompanionID = c.Query("companionId")
+
+	var err error
+	if from := c.Query("from"); from != "" {
+		if q.filter.From, err = services.ParseDatasetTime(from); err != nil {
+			return nil, err
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if q.filter.To, err = services.ParseDatasetTime(to); err != nil {
+			return nil, err
+		}
+	}
+
+	if v := c.Query("validation"); v != "" {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("validation must be a ratio between 0 and 1")
+		}
+		q.validationRatio = ratio
+	}
+	return q, nil
+}
+
+// ExportTrainingData downloads rated companion replies as JSONL fine-tuning data, with
+// anonymized history and the system prompt rebuilt from the companion revision of the time.
+// Conversations are split between train and validation by a stable hash, so the two splits
+// can be downloaded separately.
+func (h *Handlers) ExportTrainingData(c *gin.Context) {
+	q, err := parseTrainingDataQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	// Records are written as they are built; the headers go out with the first one
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="training-%s-%s.jsonl"`, q.format, q.split))
+	err = h.datasetService.Export(q.filter, func(example services.DatasetExample) error {
+		if q.split != "all" && services.DatasetSplit(example.ConversationID, q.validationRatio) != q.split {
+			return nil
+		}
+		_, err := services.WriteDatasetRecord(c.Writer, q.format, example)
+		return err
+	})
+	if err != nil {
+		if c.Writer.Written() {
+			// Too late for an error response: drop the connection so the download fails
+			// instead of ending as if complete
+			log.Printf("Training data export failed: %v", err)
+			if conn, _, err := c.Writer.Hijack(); err == nil {
+				conn.Close()
+			}
+			c.Abort()
+			return
+		}
+		c.Header("Content-Disposition", "")
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseTrainingDataQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr bool
+	}{
+		{"", false},
+		{"?format=anthropic&rating=any&companionId=c1&from=2025-01-01&to=2025-02-01&split=validation&validation=0.2", false},
+		{"?format=csv", true},
+		{"?rating=meh", true},
+		{"?split=test", true},
+		{"?from=yesterday", true},
+		{"?validation=1.5", true},
+	}
+
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request, _ = http.NewRequest("GET", "/api/admin/training-data"+tt.query, nil)
+		q, err := parseTrainingDataQuery(c)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTrainingDataQuery(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if tt.query == "" && (q.format != "openai" || q.filter.Rating != "up" || q.split != "all" || q.validationRatio != 0.1) {
+			t.Errorf("unexpected defaults %+v", q)
+		}
+	}
+}
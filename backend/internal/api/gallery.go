@@ -0,0 +1,416 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/services"
+)
+
+// galleryColumns lists the gallery item columns read by scanGalleryItem
+const galleryColumns = `id, companion_id, url, storage_key, mime_type, width, height, caption, position, unlock_level, source, created_at`
+
+// scanGalleryItem scans a row selected with galleryColumns
+func scanGalleryItem(row rowScanner, item *models.GalleryItem) error {
+	return row.Scan(&item.ID, &item.CompanionID, &item.URL, &item.StorageKey, &item.MimeType, &item.Width, &item.Height,
+		&item.Caption, &item.Position, &item.UnlockLevel, &item.Source, &item.CreatedAt)
+}
+
+// syncGalleryURLs mirrors a companion's unlocked gallery items into companions.gallery_urls
+func syncGalleryURLs(db dbExecer, companionID string) error {
+	_, err := db.Exec(
+		`UPDATE companions SET gallery_urls = ARRAY(
+			SELECT url FROM gallery_items WHERE companion_id = $1 AND unlock_level <= 1 ORDER BY position, created_at
+		) WHERE id = $1`,
+		companionID,
+	)
+	return err
+}
+
+// relationshipLevel returns the level a user has reached with a companion from the messages they
+// sent it, so regenerated replies and deleted messages do not count; guests are level 1
+func (h *Handlers) relationshipLevel(userID, companionID string) (int, error) {
+	if userID == "" {
+		return 1, nil
+	}
+	var messages int
+	err := h.db.QueryRow(
+		`SELECT COUNT(*) FROM messages m JOIN conversations conv ON conv.id = m.conversation_id
+		WHERE conv.user_id = $1 AND conv.companion_id = $2 AND m.sender = 'user' AND m.deleted_at IS NULL`,
+		userID, companionID,
+	).Scan(&messages)
+	if err != nil {
+		return 0, err
+	}
+	return services.RelationshipLevel(messages), nil
+}
+
+// loadGalleryItem fetches one item of a companion's gallery, returning sql.ErrNoRows if it does not exist
+func (h *Handlers) loadGalleryItem(companionID, itemID string) (*models.GalleryItem, error) {
+	var item models.GalleryItem
+	row := h.db.QueryRow(`SELECT `+galleryColumns+` FROM gallery_items WHERE id = $1 AND companion_id = $2`, itemID, companionID)
+	if err := scanGalleryItem(row, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// addGalleryItem appends an item to the end of a companion's gallery
+func (h *Handlers) addGalleryItem(item *models.GalleryItem) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		`INSERT INTO gallery_items (companion_id, url, storage_key, mime_type, width, height, caption, position, unlock_level, source)
+		SELECT $1, $2, $3, $4, $5, $6, $7, COALESCE(MAX(position) + 1, 0), $8, $9 FROM gallery_items WHERE companion_id = $1
+		RETURNING id, position, created_at`,
+		item.CompanionID, item.URL, item.StorageKey, item.MimeType, item.Width, item.Height,
+		item.Caption, item.UnlockLevel, item.Source,
+	).Scan(&item.ID, &item.Position, &item.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if err := syncGalleryURLs(tx, item.CompanionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListGallery lists a companion's gallery in order. Items above the viewer's relationship level
+// are returned without their URL; the owner and admins see everything.
+func (h *Handlers) ListGallery(c *gin.Context) {
+	comp := h.viewableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	viewer := viewerID(c)
+	level := services.MaxRelationshipLevel
+	if !h.canManageCompanion(viewer, comp) {
+		var err error
+		if level, err = h.relationshipLevel(viewer, comp.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	rows, err := h.db.Query(
+		`SELECT `+galleryColumns+` FROM gallery_items WHERE companion_id = $1 ORDER BY position, created_at`,
+		comp.ID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	items := []models.GalleryItem{}
+	for rows.Next() {
+		var item models.GalleryItem
+		if err := scanGalleryItem(rows, &item); err != nil {
+			continue
+		}
+		if item.UnlockLevel > level {
+			item.Locked = true
+			item.URL = ""
+			item.UnlockMessages = services.MessagesForLevel(item.UnlockLevel)
+		}
+		items = append(items, item)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: gin.H{
+		"items":             items,
+		"relationshipLevel": level,
+	}})
+}
+
+// checkUnlockLevel writes a 400 response and returns false if level is not an unlock level:
+// 0 or 1 for open items, up to services.MaxRelationshipLevel for locked ones
+func checkUnlockLevel(c *gin.Context, level int) bool {
+	if level < 0 || level > services.MaxRelationshipLevel {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "unlockLevel must be between 0 and " + strconv.Itoa(services.MaxRelationshipLevel)})
+		return false
+	}
+	return true
+}
+
+// UploadGalleryItem adds an uploaded image (multipart file, optional caption and unlockLevel) to a companion's gallery
+func (h *Handlers) UploadGalleryItem(c *gin.Context) {
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	unlockLevel, _ := strconv.Atoi(c.Request.FormValue("unlockLevel"))
+	if !checkUnlockLevel(c, unlockLevel) {
+		return
+	}
+
+	data, mimeType, err := readImageUpload(c, "file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	att, err := h.storeMedia("image", "gallery/"+comp.ID, data, mimeType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	item := &models.GalleryItem{
+		CompanionID: comp.ID,
+		URL:         att.URL,
+		StorageKey:  att.StorageKey,
+		MimeType:    att.MimeType,
+		Width:       att.Width,
+		Height:      att.Height,
+		Caption:     c.Request.FormValue("caption"),
+		UnlockLevel: unlockLevel,
+		Source:      "upload",
+	}
+	if err := h.addGalleryItem(item); err != nil {
+		h.storage.Delete(*att.StorageKey)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{Data: item})
+}
+
+// GenerateGalleryItem generates an image of the companion through the image pipeline and adds it to the gallery
+func (h *Handlers) GenerateGalleryItem(c *gin.Context) {
+	var req models.GenerateGalleryItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if !checkUnlockLevel(c, req.UnlockLevel) {
+		return
+	}
+
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	if !h.imageGenerationConfigured() {
+		c.JSON(http.StatusServiceUnavailable, models.APIResponse{Error: "Image generation service not configured"})
+		return
+	}
+	if req.PhotoType == "" {
+		req.PhotoType = "portrait"
+	}
+
+	imageURL, provider, err := h.generatePhoto(comp, req.Context, req.PhotoType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: "Failed to generate image: " + err.Error()})
+		return
+	}
+	att, err := h.storeGeneratedImage(imageURL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: "Failed to store image: " + err.Error()})
+		return
+	}
+
+	item := &models.GalleryItem{
+		CompanionID: comp.ID,
+		URL:         att.URL,
+		StorageKey:  att.StorageKey,
+		MimeType:    att.MimeType,
+		Width:       att.Width,
+		Height:      att.Height,
+		Caption:     req.Caption,
+		UnlockLevel: req.UnlockLevel,
+		Source:      "generated",
+	}
+	if err := h.addGalleryItem(item); err != nil {
+		// Remote images were not stored
+		if att.StorageKey != nil {
+			h.storage.Delete(*att.StorageKey)
+		}
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.Header("X-Image-Provider", provider)
+	c.JSON(http.StatusCreated, models.APIResponse{Data: item})
+}
+
+// UpdateGalleryItem changes an item's caption or unlock level
+func (h *Handlers) UpdateGalleryItem(c *gin.Context) {
+	var req models.UpdateGalleryItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if req.UnlockLevel != nil && !checkUnlockLevel(c, *req.UnlockLevel) {
+		return
+	}
+
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	item, err := h.loadGalleryItem(comp.ID, c.Param("itemId"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "gallery item not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	if req.Caption != nil {
+		item.Caption = *req.Caption
+	}
+	if req.UnlockLevel != nil {
+		item.UnlockLevel = *req.UnlockLevel
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE gallery_items SET caption = $2, unlock_level = $3 WHERE id = $1`, item.ID, item.Caption, item.UnlockLevel)
+	if err == nil {
+		err = syncGalleryURLs(tx, comp.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: item})
+}
+
+// ReorderGallery sets the gallery order; itemIds must list every item of the companion's gallery
+func (h *Handlers) ReorderGallery(c *gin.Context) {
+	var req models.ReorderGalleryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id FROM gallery_items WHERE companion_id = $1 FOR UPDATE`, comp.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	var existing []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			existing = append(existing, id)
+		}
+	}
+	rows.Close()
+	if !sameIDs(existing, req.ItemIDs) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "itemIds must list every gallery item exactly once"})
+		return
+	}
+
+	for position, id := range req.ItemIDs {
+		if _, err := tx.Exec(`UPDATE gallery_items SET position = $2 WHERE id = $1`, id, position); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+	}
+	if err := syncGalleryURLs(tx, comp.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "gallery reordered"})
+}
+
+// sameIDs reports whether ids is a permutation of existing
+func sameIDs(existing, ids []string) bool {
+	if len(existing) != len(ids) {
+		return false
+	}
+	remaining := make(map[string]int, len(existing))
+	for _, id := range existing {
+		remaining[id]++
+	}
+	for _, id := range ids {
+		if remaining[id] == 0 {
+			return false
+		}
+		remaining[id]--
+	}
+	return true
+}
+
+// DeleteGalleryItem removes an item from a companion's gallery along with its stored file
+func (h *Handlers) DeleteGalleryItem(c *gin.Context) {
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var storageKey *string
+	err = tx.QueryRow(
+		`DELETE FROM gallery_items WHERE id = $1 AND companion_id = $2 RETURNING storage_key`,
+		c.Param("itemId"), comp.ID,
+	).Scan(&storageKey)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "gallery item not found"})
+		return
+	}
+	if err == nil {
+		err = syncGalleryURLs(tx, comp.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	// The row is gone either way; a leftover file is harmless
+	if storageKey != nil {
+		h.storage.Delete(*storageKey)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "gallery item deleted"})
+}
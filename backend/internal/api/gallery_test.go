@@ -0,0 +1,70 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSameIDs(t *testing.T) {
+	existing := []string{"a", "b", "c"}
+	tests := []struct {
+		ids  []string
+		want bool
+	}{
+		{[]string{"c", "a", "b"}, true},
+		{[]string{"a", "b"}, false},
+		{[]string{"a", "b", "b"}, false},
+		{[]string{"a", "b", "d"}, false},
+		{[]string{"a", "b", "c", "a"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := sameIDs(existing, tt.ids); got != tt.want {
+			t.Errorf("sameIDs(%v) = %v, want %v", tt.ids, got, tt.want)
+		}
+	}
+	if !sameIDs(nil, []string{}) {
+		t.Error("an empty gallery should accept an empty order")
+	}
+}
+
+func TestGalleryUnlockLevelValidation(t *testing.T) {
+	h := NewHandlers(nil, nil)
+	router := setupTestRouter()
+	router.POST("/api/companions/:id/gallery/generate", func(c *gin.Context) {
+		c.Set("userID", "user-1")
+		h.GenerateGalleryItem(c)
+	})
+	router.PATCH("/api/companions/:id/gallery/:itemId", func(c *gin.Context) {
+		c.Set("userID", "user-1")
+		h.UpdateGalleryItem(c)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"Generate above the highest level", "POST", "/api/companions/1/gallery/generate", `{"unlockLevel":6}`},
+		{"Generate negative", "POST", "/api/companions/1/gallery/generate", `{"unlockLevel":-1}`},
+		{"Update above the highest level", "PATCH", "/api/companions/1/gallery/2", `{"unlockLevel":6}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
@@ -2,7 +2,9 @@ package api
 
 import (
 	"database/sql"
+	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -13,32 +15,49 @@ import (
 
 	"nectar-ai-companion/internal/models"
 	"nectar-ai-companion/internal/services"
+	"nectar-ai-companion/internal/storage"
 	"nectar-ai-companion/internal/websocket"
 )
 
 // Handlers contains all API handlers
 type Handlers struct {
-	db                  *sql.DB
-	authService         *services.AuthService
-	aiService           *services.AIService
-	claudeService       *services.ClaudeService
-	groqService         *services.GroqService
-	falService          *services.FalService
-	huggingFaceService  *services.HuggingFaceService
-	wsHub               *websocket.Hub
+	db                    *sql.DB
+	authService           *services.AuthService
+	aiService             *services.AIService
+	claudeService         *services.ClaudeService
+	groqService           *services.GroqService
+	falService            *services.FalService
+	huggingFaceService    *services.HuggingFaceService
+	voiceProvider         services.VoiceProvider
+	transcriptionProvider services.TranscriptionProvider
+	embeddingProvider     services.EmbeddingProvider
+	knowledgeIndexes      *services.KnowledgeIndexCache
+	datasetService        *services.DatasetService
+	cardPortraits         *portraitCache
+	storage               storage.Storage
+	wsHub                 *websocket.Hub
+	allowGuestCompanions  bool // Lets guests create companions for the demo
 }
 
 // NewHandlers creates a new handlers instance
 func NewHandlers(db *sql.DB, hub *websocket.Hub) *Handlers {
 	return &Handlers{
-		db:                  db,
-		authService:         services.NewAuthService(db),
-		aiService:           services.NewAIService(),
-		claudeService:       services.NewClaudeService(),
-		groqService:         services.NewGroqService(),
-		falService:          services.NewFalService(),
-		huggingFaceService:  services.NewHuggingFaceService(),
-		wsHub:               hub,
+		db:                    db,
+		authService:           services.NewAuthService(db),
+		aiService:             services.NewAIService(),
+		claudeService:         services.NewClaudeService(),
+		groqService:           services.NewGroqService(),
+		falService:            services.NewFalService(),
+		huggingFaceService:    services.NewHuggingFaceService(),
+		voiceProvider:         services.NewVoiceProvider(),
+		transcriptionProvider: services.NewTranscriptionProvider(),
+		embeddingProvider:     services.NewEmbeddingProvider(),
+		knowledgeIndexes:      services.NewKnowledgeIndexCache(),
+		datasetService:        services.NewDatasetService(db),
+		cardPortraits:         newPortraitCache(),
+		storage:               storage.NewFromEnv(),
+		wsHub:                 hub,
+		allowGuestCompanions:  os.Getenv("ALLOW_GUEST_COMPANIONS") == "true",
 	}
 }
 
@@ -120,25 +139,38 @@ func (h *Handlers) ListCompanions(c *gin.Context) {
 
 	offset := (page - 1) * pageSize
 
-	var query string
-	var args []interface{}
+	sort := c.DefaultQuery("sort", "featured")
+	order, ok := companionSortOrders[sort]
+	if !ok {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "unsupported sort: " + sort})
+		return
+	}
 
+	f := &sqlFilter{}
 	if category != "" && category != "all" {
-		query = `SELECT id, name, category, bio, avatar_url, personality_json, tags, age, status,
-			COALESCE(style, 'realistic'), scenario, greeting, COALESCE(appearance_json, '{}'),
-			interests, COALESCE(communication_style, 'friendly'), gallery_urls,
-			COALESCE(is_featured, false), COALESCE(message_count, 0), created_at
-			FROM companions WHERE category = $1 ORDER BY is_featured DESC, created_at DESC LIMIT $2 OFFSET $3`
-		args = []interface{}{category, pageSize, offset}
+		f.add("category = " + f.arg(category))
+	}
+
+	// Guests see public companions; signed-in users also see their own.
+	// mine=true lists only the user's own companions, whatever their visibility.
+	viewer := viewerID(c)
+	if c.Query("mine") == "true" {
+		if viewer == "" {
+			c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+			return
+		}
+		f.add("created_by = " + f.arg(viewer))
 	} else {
-		query = `SELECT id, name, category, bio, avatar_url, personality_json, tags, age, status,
-			COALESCE(style, 'realistic'), scenario, greeting, COALESCE(appearance_json, '{}'),
-			interests, COALESCE(communication_style, 'friendly'), gallery_urls,
-			COALESCE(is_featured, false), COALESCE(message_count, 0), created_at
-			FROM companions ORDER BY is_featured DESC, created_at DESC LIMIT $1 OFFSET $2`
-		args = []interface{}{pageSize, offset}
+		f.addVisibleTo(viewer)
 	}
 
+	where := f.where()
+	countArgs := f.args
+
+	query := `SELECT ` + companionColumns + `
+		FROM companions` + where + ` ORDER BY ` + order + `, id ASC LIMIT ` + f.arg(pageSize) + ` OFFSET ` + f.arg(offset)
+	args := f.args
+
 	rows, err := h.db.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
@@ -149,14 +181,7 @@ func (h *Handlers) ListCompanions(c *gin.Context) {
 	var companions []models.Companion
 	for rows.Next() {
 		var comp models.Companion
-		err := rows.Scan(
-			&comp.ID, &comp.Name, &comp.Category, &comp.Bio,
-			&comp.AvatarURL, &comp.PersonalityJSON, pq.Array(&comp.Tags),
-			&comp.Age, &comp.Status, &comp.Style, &comp.Scenario, &comp.Greeting,
-			&comp.AppearanceJSON, pq.Array(&comp.Interests), &comp.CommunicationStyle,
-			pq.Array(&comp.GalleryURLs), &comp.IsFeatured, &comp.MessageCount, &comp.CreatedAt,
-		)
-		if err != nil {
+		if err := scanCompanion(rows, &comp); err != nil {
 			continue
 		}
 		companions = append(companions, comp)
@@ -164,11 +189,7 @@ func (h *Handlers) ListCompanions(c *gin.Context) {
 
 	// Get total count
 	var total int
-	if category != "" && category != "all" {
-		h.db.QueryRow("SELECT COUNT(*) FROM companions WHERE category = $1", category).Scan(&total)
-	} else {
-		h.db.QueryRow("SELECT COUNT(*) FROM companions").Scan(&total)
-	}
+	h.db.QueryRow("SELECT COUNT(*) FROM companions"+where, countArgs...).Scan(&total)
 
 	totalPages := (total + pageSize - 1) / pageSize
 
@@ -184,22 +205,8 @@ func (h *Handlers) ListCompanions(c *gin.Context) {
 func (h *Handlers) GetCompanion(c *gin.Context) {
 	id := c.Param("id")
 
-	var comp models.Companion
-	err := h.db.QueryRow(
-		`SELECT id, name, category, bio, avatar_url, personality_json, tags, age, status,
-			COALESCE(style, 'realistic'), scenario, greeting, COALESCE(appearance_json, '{}'),
-			interests, COALESCE(communication_style, 'friendly'), gallery_urls,
-			COALESCE(is_featured, false), COALESCE(message_count, 0), created_at
-		FROM companions WHERE id = $1`, id,
-	).Scan(
-		&comp.ID, &comp.Name, &comp.Category, &comp.Bio,
-		&comp.AvatarURL, &comp.PersonalityJSON, pq.Array(&comp.Tags),
-		&comp.Age, &comp.Status, &comp.Style, &comp.Scenario, &comp.Greeting,
-		&comp.AppearanceJSON, pq.Array(&comp.Interests), &comp.CommunicationStyle,
-		pq.Array(&comp.GalleryURLs), &comp.IsFeatured, &comp.MessageCount, &comp.CreatedAt,
-	)
-
-	if err == sql.ErrNoRows {
+	comp, err := h.loadCompanion(id)
+	if err == sql.ErrNoRows || (err == nil && !h.canViewCompanion(viewerID(c), comp)) {
 		c.JSON(http.StatusNotFound, models.APIResponse{Error: "companion not found"})
 		return
 	}
@@ -207,33 +214,73 @@ func (h *Handlers) GetCompanion(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
 		return
 	}
+	comp.Stats, _ = h.loadCompanionStats(comp.ID)
+	if viewer := viewerID(c); viewer != "" {
+		if favorite, err := h.isFavorite(viewer, comp.ID); err == nil {
+			comp.IsFavorite = &favorite
+		}
+	}
 
 	c.JSON(http.StatusOK, models.APIResponse{Data: comp})
 }
 
 func (h *Handlers) CreateCompanion(c *gin.Context) {
-	var req struct {
-		Name               string             `json:"name" binding:"required"`
-		Category           string             `json:"category" binding:"required,oneof=girls guys anime"`
-		Bio                string             `json:"bio"`
-		AvatarURL          string             `json:"avatarUrl"`
-		Personality        models.Personality `json:"personality"`
-		Tags               []string           `json:"tags"`
-		Age                int                `json:"age" binding:"required,min=18,max=100"`
-		Greeting           string             `json:"greeting"`
-		Scenario           string             `json:"scenario"`
-		CommunicationStyle string             `json:"communicationStyle"`
-		Interests          []string           `json:"interests"`
-		Appearance         map[string]string  `json:"appearance"`
-	}
-
+	var req companionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
 		return
 	}
 
+	patch := req.patch()
+	if !h.checkCompanionPatch(c, &patch, false) {
+		return
+	}
+
+	comp, ok := h.newCompanion(c, req.Visibility)
+	if !ok {
+		return
+	}
+	applyCompanionPatch(comp, patch)
+
+	if err := h.insertCompanion(comp); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{Data: comp})
+}
+
+// newCompanion starts a companion owned by the signed-in user.
+// Guests may only create shareable companions, and only when the demo path is enabled;
+// otherwise the error response is written and ok is false.
+func (h *Handlers) newCompanion(c *gin.Context, visibility string) (comp *models.Companion, ok bool) {
+	var createdBy *string
+	if userID, exists := c.Get("userID"); exists {
+		uid := userID.(string)
+		createdBy = &uid
+	} else if !h.allowGuestCompanions {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "sign in to create companions"})
+		return nil, false
+	} else if visibility == "private" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "guest companions cannot be private"})
+		return nil, false
+	}
+
+	return &models.Companion{
+		Status:         "online",
+		Visibility:     "public",
+		VoiceJSON:      models.JSONB{},
+		CardExtensions: models.JSONB{},
+		CreatedBy:      createdBy,
+		CreatedAt:      time.Now(),
+	}, true
+}
+
+// insertCompanion assigns a readable ID from the companion's name and saves it with its first revision
+// and any lorebook entries
+func (h *Handlers) insertCompanion(comp *models.Companion, lorebook ...models.LorebookEntry) error {
 	// Generate readable ID from name
-	id := generateSlug(req.Name)
+	id := generateSlug(comp.Name)
 
 	// Check if ID already exists, append random suffix if so
 	var existingID string
@@ -242,67 +289,55 @@ func (h *Handlers) CreateCompanion(c *gin.Context) {
 		// ID exists, append random suffix
 		id = id + "-" + uuid.New().String()[:8]
 	}
+	comp.ID = id
 
-	// Set defaults
-	if req.CommunicationStyle == "" {
-		req.CommunicationStyle = "friendly"
-	}
-
-	comp := models.Companion{
-		ID:        id,
-		Name:      req.Name,
-		Category:  req.Category,
-		Bio:       req.Bio,
-		AvatarURL: req.AvatarURL,
-		PersonalityJSON: models.JSONB{
-			"friendliness": req.Personality.Friendliness,
-			"humor":        req.Personality.Humor,
-			"intelligence": req.Personality.Intelligence,
-			"romantic":     req.Personality.Romantic,
-			"flirty":       req.Personality.Flirty,
-		},
-		Tags:               req.Tags,
-		Age:                req.Age,
-		Status:             "online",
-		CommunicationStyle: req.CommunicationStyle,
-		Interests:          req.Interests,
-		CreatedAt:          time.Now(),
-	}
-
-	// Handle optional fields
-	if req.Greeting != "" {
-		comp.Greeting = &req.Greeting
-	}
-	if req.Scenario != "" {
-		comp.Scenario = &req.Scenario
-	}
-	if req.Appearance != nil {
-		comp.AppearanceJSON = models.JSONB{}
-		for k, v := range req.Appearance {
-			comp.AppearanceJSON[k] = v
-		}
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	_, err = h.db.Exec(
-		`INSERT INTO companions (id, name, category, bio, avatar_url, personality_json, tags, age, status, greeting, scenario, communication_style, interests, appearance_json)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+	_, err = tx.Exec(
+		`INSERT INTO companions (id, name, category, bio, avatar_url, personality_json, tags, age, status, greeting, scenario, communication_style, interests, appearance_json, voice_json, created_by, visibility, card_extensions)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)`,
 		comp.ID, comp.Name, comp.Category, comp.Bio, comp.AvatarURL,
 		comp.PersonalityJSON, pq.Array(comp.Tags), comp.Age, comp.Status,
 		comp.Greeting, comp.Scenario, comp.CommunicationStyle, pq.Array(comp.Interests), comp.AppearanceJSON,
+		comp.VoiceJSON, comp.CreatedBy, comp.Visibility, comp.CardExtensions,
 	)
-
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
-		return
+		return err
 	}
 
-	c.JSON(http.StatusCreated, models.APIResponse{Data: comp})
+	// The initial persona is revision 1
+	if _, err := insertRevision(tx, comp, comp.CreatedBy); err != nil {
+		return err
+	}
+
+	for i := range lorebook {
+		lorebook[i].CompanionID = comp.ID
+		if err := insertLorebookEntry(tx, &lorebook[i]); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 // generateSlug creates a URL-friendly slug from a name
 func generateSlug(name string) string {
+	slug := slugify(name)
+	// Add prefix
+	if slug == "" {
+		slug = "companion-" + uuid.New().String()[:8]
+	}
+	return slug
+}
+
+// slugify lowercases a name, joins words with hyphens and drops other characters
+func slugify(name string) string {
 	// Convert to lowercase
-	slug := strings.ToLower(name)
+	slug := strings.ToLower(strings.TrimSpace(name))
 	// Replace spaces with hyphens
 	slug = strings.ReplaceAll(slug, " ", "-")
 	// Remove non-alphanumeric characters except hyphens
@@ -318,12 +353,7 @@ func generateSlug(name string) string {
 		slug = strings.ReplaceAll(slug, "--", "-")
 	}
 	// Trim hyphens from start and end
-	slug = strings.Trim(slug, "-")
-	// Add prefix
-	if slug == "" {
-		slug = "companion-" + uuid.New().String()[:8]
-	}
-	return slug
+	return strings.Trim(slug, "-")
 }
 
 // Story Handlers
@@ -436,32 +466,44 @@ func (h *Handlers) StartChat(c *gin.Context) {
 		return
 	}
 
-	// Check if conversation exists
+	comp, err := h.loadCompanion(req.CompanionID)
+	if err == sql.ErrNoRows || (err == nil && !h.canViewCompanion(userID.(string), comp)) {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "companion not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	personaID, ok := h.requestedPersona(c, userID.(string), req.PersonaID)
+	if !ok {
+		return
+	}
+
+	// Resume the latest unarchived thread with the companion
 	var conv models.Conversation
-	err := h.db.QueryRow(
-		`SELECT id, user_id, companion_id, created_at FROM conversations
-		WHERE user_id = $1 AND companion_id = $2`,
+	err = scanConversation(h.db.QueryRow(
+		`SELECT `+conversationColumns+` FROM conversations
+		WHERE user_id = $1 AND companion_id = $2 AND archived_at IS NULL
+		ORDER BY created_at DESC LIMIT 1`,
 		userID, req.CompanionID,
-	).Scan(&conv.ID, &conv.UserID, &conv.CompanionID, &conv.CreatedAt)
+	), &conv)
 
 	if err == sql.ErrNoRows {
-		// Create new conversation
+		// Create new conversation, pinned to the persona it starts with unless asked to follow later edits
 		conv = models.Conversation{
-			ID:          uuid.New().String(),
 			UserID:      userID.(string),
 			CompanionID: req.CompanionID,
-			CreatedAt:   time.Now(),
+			PersonaID:   personaID,
 		}
-
-		_, err = h.db.Exec(
-			`INSERT INTO conversations (id, user_id, companion_id) VALUES ($1, $2, $3)`,
-			conv.ID, conv.UserID, conv.CompanionID,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
-			return
-		}
-	} else if err != nil {
+		err = h.insertConversation(&conv, req.FollowLatest)
+	} else if err == nil && personaID != nil && (conv.PersonaID == nil || *conv.PersonaID != *personaID) {
+		// The resumed thread switches to the persona asked for; without one it keeps its own
+		conv.PersonaID = personaID
+		_, err = h.db.Exec(`UPDATE conversations SET persona_id = $2 WHERE id = $1`, conv.ID, conv.PersonaID)
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
 		return
 	}
@@ -482,151 +524,125 @@ func (h *Handlers) SendMessage(c *gin.Context) {
 		return
 	}
 
-	// Verify conversation belongs to user
-	var companionID string
-	err := h.db.QueryRow(
-		`SELECT companion_id FROM conversations WHERE id = $1 AND user_id = $2`,
-		req.ConversationID, userID,
-	).Scan(&companionID)
+	if strings.TrimSpace(req.Content) == "" && len(req.AttachmentIDs) == 0 && req.Image == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "content or attachments required"})
+		return
+	}
 
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, models.APIResponse{Error: "conversation not found"})
+	// Verify conversation belongs to user
+	conv, ok := h.ownedConversation(c, userID.(string), req.ConversationID)
+	if !ok {
 		return
 	}
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+	if conv.ArchivedAt != nil {
+		c.JSON(http.StatusConflict, models.APIResponse{Error: "conversation is archived"})
 		return
 	}
+	companionID := conv.CompanionID
 
-	// Create user message
+	// Store an inline photo; it is attached to the message with the rest below
+	var inline *models.Attachment
+	if req.Image != "" {
+		data, mimeType, err := decodeImageDataURL(req.Image)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+			return
+		}
+
+		uid := userID.(string)
+		inline, err = h.storeMedia("image", "attachments/"+uid, data, mimeType)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+		inline.UserID = &uid
+	}
+
+	// Create user message; it follows the active leaf, read below
 	userMsg := models.Message{
 		ID:             uuid.New().String(),
-		ConversationID: req.ConversationID,
+		ConversationID: conv.ID,
 		Sender:         "user",
 		Content:        req.Content,
 		CreatedAt:      time.Now(),
 	}
+	// The companion receives messages as soon as they are stored
+	userMsg.DeliveredAt = &userMsg.CreatedAt
 
-	_, err = h.db.Exec(
-		`INSERT INTO messages (id, conversation_id, sender, content) VALUES ($1, $2, $3, $4)`,
-		userMsg.ID, userMsg.ConversationID, userMsg.Sender, userMsg.Content,
-	)
+	tx, err := h.db.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
 		return
 	}
+	committed := false
+	defer func() {
+		tx.Rollback()
+		// The inline photo's file is kept only if its row was
+		if inline != nil && !committed {
+			h.storage.Delete(*inline.StorageKey)
+		}
+	}()
 
-	// Get user's current mood
-	var mood string
-	h.db.QueryRow(
-		`SELECT mood_type FROM moods WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1`,
-		userID,
-	).Scan(&mood)
-	if mood == "" {
-		mood = "romantic"
+	if userMsg.ParentID, err = lockActiveLeaf(tx, conv.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if err := insertMessage(tx, &userMsg); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
 	}
 
-	var aiContent string
-
-	// Try to use Claude if configured
-	if h.claudeService.IsConfigured() {
-		// Fetch companion data
-		var comp models.Companion
-		err := h.db.QueryRow(
-			`SELECT id, name, category, bio, avatar_url, personality_json, tags, age, status,
-				COALESCE(style, 'realistic'), scenario, greeting, COALESCE(appearance_json, '{}'),
-				interests, COALESCE(communication_style, 'friendly'), gallery_urls,
-				COALESCE(is_featured, false), COALESCE(message_count, 0), created_at
-			FROM companions WHERE id = $1`, companionID,
-		).Scan(
-			&comp.ID, &comp.Name, &comp.Category, &comp.Bio,
-			&comp.AvatarURL, &comp.PersonalityJSON, pq.Array(&comp.Tags),
-			&comp.Age, &comp.Status, &comp.Style, &comp.Scenario, &comp.Greeting,
-			&comp.AppearanceJSON, pq.Array(&comp.Interests), &comp.CommunicationStyle,
-			pq.Array(&comp.GalleryURLs), &comp.IsFeatured, &comp.MessageCount, &comp.CreatedAt,
-		)
+	if inline != nil {
+		inline.MessageID = &userMsg.ID
+		if err := insertAttachment(tx, inline); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+	}
 
-		if err == nil {
-			// Build companion context
-			companionCtx := services.CompanionContext{
-				Name:               comp.Name,
-				Age:                comp.Age,
-				Bio:                comp.Bio,
-				Personality:        comp.PersonalityJSON,
-				Tags:               comp.Tags,
-				CommunicationStyle: comp.CommunicationStyle,
-				Interests:          comp.Interests,
-			}
-			if comp.Scenario != nil {
-				companionCtx.Scenario = *comp.Scenario
-			}
-			if comp.Greeting != nil {
-				companionCtx.Greeting = *comp.Greeting
-			}
-
-			// Get recent conversation history
-			rows, err := h.db.Query(
-				`SELECT sender, content FROM messages
-				WHERE conversation_id = $1
-				ORDER BY created_at DESC LIMIT 10`,
-				req.ConversationID,
-			)
-			if err == nil {
-				defer rows.Close()
-				var messages []services.ClaudeMessage
-				for rows.Next() {
-					var sender, content string
-					if err := rows.Scan(&sender, &content); err == nil {
-						role := "user"
-						if sender == "ai" {
-							role = "assistant"
-						}
-						messages = append([]services.ClaudeMessage{{Role: role, Content: content}}, messages...)
-					}
-				}
-
-				// Generate response with Claude
-				response, err := h.claudeService.GenerateResponse(companionCtx, messages, mood)
-				if err == nil {
-					aiContent = response
-				}
-			}
+	// Attach the user's uploaded images
+	if err := linkAttachments(tx, userMsg.ID, userID.(string), req.AttachmentIDs); err != nil {
+		status := http.StatusInternalServerError
+		if err == errInvalidAttachment {
+			status = http.StatusBadRequest
 		}
+		c.JSON(status, models.APIResponse{Error: err.Error()})
+		return
 	}
 
-	// Fallback to simple AI if Claude failed or not configured
-	if aiContent == "" {
-		aiContent = h.aiService.GenerateReply([]string{req.Content}, mood)
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
 	}
+	committed = true
 
-	aiMsg := models.Message{
-		ID:             uuid.New().String(),
-		ConversationID: req.ConversationID,
-		Sender:         "ai",
-		Content:        aiContent,
-		CreatedAt:      time.Now(),
+	if inline != nil || len(req.AttachmentIDs) > 0 {
+		attachments, err := h.loadAttachments([]string{userMsg.ID})
+		if err == nil {
+			setAttachments(&userMsg, attachments[userMsg.ID])
+		}
 	}
 
-	_, err = h.db.Exec(
-		`INSERT INTO messages (id, conversation_id, sender, content) VALUES ($1, $2, $3, $4)`,
-		aiMsg.ID, aiMsg.ConversationID, aiMsg.Sender, aiMsg.Content,
-	)
+	aiMsg, err := h.replyToMessage(userID.(string), companionID, &userMsg, req.Voice)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
 		return
 	}
-
-	// Broadcast to WebSocket clients
-	h.wsHub.BroadcastToConversation(req.ConversationID, &aiMsg)
+	// The reply is returned to the sender, so they have read it
+	if receipt, err := h.markRead(userID.(string), conv.ID, aiMsg.ID); err == nil {
+		aiMsg.DeliveredAt, aiMsg.ReadAt = &receipt.At, &receipt.At
+	}
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Data: models.SendMessageResponse{
 			UserMessage: &userMsg,
-			AIMessage:   &aiMsg,
+			AIMessage:   aiMsg,
 		},
 	})
 }
 
+// GetChatHistory returns the active branch of the user's latest unarchived thread with a companion,
+// or of the thread given by conversationId
 func (h *Handlers) GetChatHistory(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -635,26 +651,26 @@ func (h *Handlers) GetChatHistory(c *gin.Context) {
 	}
 
 	companionID := c.Param("companionId")
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
-
-	if page < 1 {
-		page = 1
-	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 50
-	}
-
-	offset := (page - 1) * pageSize
 
 	// Get conversation
-	var conversationID string
-	err := h.db.QueryRow(
-		`SELECT id FROM conversations WHERE user_id = $1 AND companion_id = $2`,
-		userID, companionID,
-	).Scan(&conversationID)
+	var conv models.Conversation
+	var err error
+	if id := c.Query("conversationId"); id != "" {
+		err = scanConversation(h.db.QueryRow(
+			`SELECT `+conversationColumns+` FROM conversations WHERE id = $1 AND user_id = $2 AND companion_id = $3`,
+			id, userID, companionID,
+		), &conv)
+	} else {
+		err = scanConversation(h.db.QueryRow(
+			`SELECT `+conversationColumns+` FROM conversations
+			WHERE user_id = $1 AND companion_id = $2 AND archived_at IS NULL
+			ORDER BY created_at DESC LIMIT 1`,
+			userID, companionID,
+		), &conv)
+	}
 
 	if err == sql.ErrNoRows {
+		page, pageSize := historyPage(c)
 		c.JSON(http.StatusOK, models.PaginatedResponse{
 			Data:       []models.Message{},
 			Total:      0,
@@ -669,52 +685,26 @@ func (h *Handlers) GetChatHistory(c *gin.Context) {
 		return
 	}
 
-	// Get messages
-	rows, err := h.db.Query(
-		`SELECT id, conversation_id, sender, content, created_at
-		FROM messages WHERE conversation_id = $1
-		ORDER BY created_at ASC LIMIT $2 OFFSET $3`,
-		conversationID, pageSize, offset,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
-		return
-	}
-	defer rows.Close()
-
-	var messages []models.Message
-	for rows.Next() {
-		var msg models.Message
-		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.Sender, &msg.Content, &msg.CreatedAt); err != nil {
-			continue
-		}
-		messages = append(messages, msg)
+	// Loading a thread delivers its replies to the user; the history is returned either way
+	if _, err := h.markDelivered(conv.ID); err != nil {
+		log.Printf("Failed to mark messages delivered in conversation %s: %v", conv.ID, err)
 	}
 
-	// Get total count
-	var total int
-	h.db.QueryRow("SELECT COUNT(*) FROM messages WHERE conversation_id = $1", conversationID).Scan(&total)
-	totalPages := (total + pageSize - 1) / pageSize
-
-	c.JSON(http.StatusOK, models.PaginatedResponse{
-		Data:       messages,
-		Total:      total,
-		Page:       page,
-		PageSize:   pageSize,
-		TotalPages: totalPages,
-	})
+	h.writeChatHistory(c, &conv)
 }
 
 // Public Chat Handler (no auth required for demo)
 func (h *Handlers) PublicChat(c *gin.Context) {
 	var req struct {
-		CompanionID string   `json:"companionId" binding:"required"`
-		Message     string   `json:"message" binding:"required"`
+		CompanionID string `json:"companionId" binding:"required"`
+		Message     string `json:"message"`
+		Image       string `json:"image"` // Optional base64 data URL of a photo from the user
 		History     []struct {
 			Role    string `json:"role"`
 			Content string `json:"content"`
 		} `json:"history"`
-		Mood string `json:"mood"`
+		Mood      string `json:"mood"`
+		PersonaID string `json:"personaId"` // Optional persona of a signed-in viewer; defaults to their default persona
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -722,27 +712,29 @@ func (h *Handlers) PublicChat(c *gin.Context) {
 		return
 	}
 
+	if strings.TrimSpace(req.Message) == "" && req.Image == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "message or image required"})
+		return
+	}
+
+	// Decode the photo the user shared so the companion can see it
+	var userImages []services.ClaudeImage
+	if req.Image != "" {
+		data, mimeType, err := decodeImageDataURL(req.Image)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+			return
+		}
+		userImages = append(userImages, services.ClaudeImage{MediaType: mimeType, Data: data})
+	}
+
 	if req.Mood == "" {
 		req.Mood = "romantic"
 	}
 
 	// Fetch companion data
-	var comp models.Companion
-	err := h.db.QueryRow(
-		`SELECT id, name, category, bio, avatar_url, personality_json, tags, age, status,
-			COALESCE(style, 'realistic'), scenario, greeting, COALESCE(appearance_json, '{}'),
-			interests, COALESCE(communication_style, 'friendly'), gallery_urls,
-			COALESCE(is_featured, false), COALESCE(message_count, 0), created_at
-		FROM companions WHERE id = $1`, req.CompanionID,
-	).Scan(
-		&comp.ID, &comp.Name, &comp.Category, &comp.Bio,
-		&comp.AvatarURL, &comp.PersonalityJSON, pq.Array(&comp.Tags),
-		&comp.Age, &comp.Status, &comp.Style, &comp.Scenario, &comp.Greeting,
-		&comp.AppearanceJSON, pq.Array(&comp.Interests), &comp.CommunicationStyle,
-		pq.Array(&comp.GalleryURLs), &comp.IsFeatured, &comp.MessageCount, &comp.CreatedAt,
-	)
-
-	if err == sql.ErrNoRows {
+	comp, err := h.loadCompanion(req.CompanionID)
+	if err == sql.ErrNoRows || (err == nil && !h.canViewCompanion(viewerID(c), comp)) {
 		c.JSON(http.StatusNotFound, models.APIResponse{Error: "companion not found"})
 		return
 	}
@@ -751,102 +743,60 @@ func (h *Handlers) PublicChat(c *gin.Context) {
 		return
 	}
 
-	var aiContent string
-
-	// Try to use Claude if configured
-	if h.claudeService.IsConfigured() {
-		// Build companion context
-		companionCtx := services.CompanionContext{
-			Name:               comp.Name,
-			Age:                comp.Age,
-			Bio:                comp.Bio,
-			Personality:        comp.PersonalityJSON,
-			Tags:               comp.Tags,
-			CommunicationStyle: comp.CommunicationStyle,
-			Interests:          comp.Interests,
-		}
-		if comp.Scenario != nil {
-			companionCtx.Scenario = *comp.Scenario
+	// Build message history
+	var messages []services.ClaudeMessage
+	for _, h := range req.History {
+		role := h.Role
+		if role == "ai" {
+			role = "assistant"
 		}
-		if comp.Greeting != nil {
-			companionCtx.Greeting = *comp.Greeting
-		}
-
-		// Build message history
-		var messages []services.ClaudeMessage
-		for _, h := range req.History {
-			role := h.Role
-			if role == "ai" {
-				role = "assistant"
-			}
-			messages = append(messages, services.ClaudeMessage{Role: role, Content: h.Content})
-		}
-		// Add current message
-		messages = append(messages, services.ClaudeMessage{Role: "user", Content: req.Message})
-
-		// Generate response with Claude
-		response, err := h.claudeService.GenerateResponse(companionCtx, messages, req.Mood)
-		if err != nil {
-			// Log the error but fall back to simple AI
-			c.Header("X-AI-Fallback", "true")
-			c.Header("X-AI-Error", err.Error())
-		} else {
-			aiContent = response
+		content := h.Content
+		if strings.TrimSpace(content) == "" {
+			content = photoPlaceholder
 		}
+		messages = append(messages, services.ClaudeMessage{Role: role, Content: content})
 	}
+	// Add current message
+	messages = append(messages, services.ClaudeMessage{Role: "user", Content: req.Message, Images: userImages})
 
-	// Try Groq as secondary fallback if Claude failed
-	if aiContent == "" && h.groqService.IsConfigured() {
-		// Build companion context
-		companionCtx := services.CompanionContext{
-			Name:               comp.Name,
-			Age:                comp.Age,
-			Bio:                comp.Bio,
-			Personality:        comp.PersonalityJSON,
-			Tags:               comp.Tags,
-			CommunicationStyle: comp.CommunicationStyle,
-			Interests:          comp.Interests,
-		}
-		if comp.Scenario != nil {
-			companionCtx.Scenario = *comp.Scenario
-		}
-		if comp.Greeting != nil {
-			companionCtx.Greeting = *comp.Greeting
-		}
-
-		// Build message history
-		var messages []services.ClaudeMessage
-		for _, h := range req.History {
-			role := h.Role
-			if role == "ai" {
-				role = "assistant"
-			}
-			messages = append(messages, services.ClaudeMessage{Role: role, Content: h.Content})
-		}
-		messages = append(messages, services.ClaudeMessage{Role: "user", Content: req.Message})
+	companionCtx := companionContext(comp)
+	companionCtx.User = h.promptPersona(viewerID(c), req.PersonaID)
+	companionCtx.Lore = h.companionLore(comp.ID, messages)
+	var citations []models.KnowledgeCitation
+	companionCtx.Knowledge, citations = h.companionKnowledge(comp.ID, req.Message)
 
-		response, err := h.groqService.GenerateResponse(companionCtx, messages, req.Mood)
-		if err == nil {
-			aiContent = response
-			c.Header("X-AI-Provider", "groq")
-		}
+	// Generate response with Claude, falling back to Groq
+	aiContent, provider, aiErr := h.generateReply(companionCtx, messages, req.Mood)
+	if aiErr != nil {
+		// Log the error but fall back to simple AI
+		c.Header("X-AI-Fallback", "true")
+		c.Header("X-AI-Error", aiErr.Error())
 	}
 
 	// Fallback to simple AI if both Claude and Groq failed
 	if aiContent == "" {
 		aiContent = h.aiService.GenerateReply([]string{req.Message}, req.Mood)
-		c.Header("X-AI-Provider", "fallback")
-	} else if c.Writer.Header().Get("X-AI-Provider") == "" {
-		c.Header("X-AI-Provider", "claude")
+		provider = "fallback"
 	}
+	c.Header("X-AI-Provider", provider)
 
-	c.JSON(http.StatusOK, models.APIResponse{
-		Data: map[string]interface{}{
-			"response":    aiContent,
-			"companionId": comp.ID,
-			"companion":   comp.Name,
-		},
-	})
+	// Turn [Photo] replies into a generated image. Anonymous chats have no messages to own a
+	// stored file, so the image is returned as the pipeline gave it, usually a data URL.
+	aiContent, imageURL, _ := h.generatePhotoReply(comp, aiContent)
+
+	data := map[string]interface{}{
+		"response":    aiContent,
+		"companionId": comp.ID,
+		"companion":   comp.Name,
+	}
+	if imageURL != "" {
+		data["imageUrl"] = imageURL
+	}
+	if len(citations) > 0 {
+		data["citations"] = citations
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: data})
 }
 
 // Memory Handlers
@@ -986,28 +936,14 @@ func (h *Handlers) GenerateCompanionPhoto(c *gin.Context) {
 		return
 	}
 
-	if !h.huggingFaceService.IsConfigured() && !h.falService.IsConfigured() {
+	if !h.imageGenerationConfigured() {
 		c.JSON(http.StatusServiceUnavailable, models.APIResponse{Error: "Image generation service not configured"})
 		return
 	}
 
 	// Fetch companion data
-	var comp models.Companion
-	err := h.db.QueryRow(
-		`SELECT id, name, category, bio, avatar_url, personality_json, tags, age, status,
-			COALESCE(style, 'realistic'), scenario, greeting, COALESCE(appearance_json, '{}'),
-			interests, COALESCE(communication_style, 'friendly'), gallery_urls,
-			COALESCE(is_featured, false), COALESCE(message_count, 0), created_at
-		FROM companions WHERE id = $1`, req.CompanionID,
-	).Scan(
-		&comp.ID, &comp.Name, &comp.Category, &comp.Bio,
-		&comp.AvatarURL, &comp.PersonalityJSON, pq.Array(&comp.Tags),
-		&comp.Age, &comp.Status, &comp.Style, &comp.Scenario, &comp.Greeting,
-		&comp.AppearanceJSON, pq.Array(&comp.Interests), &comp.CommunicationStyle,
-		pq.Array(&comp.GalleryURLs), &comp.IsFeatured, &comp.MessageCount, &comp.CreatedAt,
-	)
-
-	if err == sql.ErrNoRows {
+	comp, err := h.loadCompanion(req.CompanionID)
+	if err == sql.ErrNoRows || (err == nil && !h.canViewCompanion(viewerID(c), comp)) {
 		c.JSON(http.StatusNotFound, models.APIResponse{Error: "companion not found"})
 		return
 	}
@@ -1016,69 +952,14 @@ func (h *Handlers) GenerateCompanionPhoto(c *gin.Context) {
 		return
 	}
 
-	// Build appearance from companion data
-	appearance := services.CompanionAppearance{
-		Name:   comp.Name,
-		Age:    comp.Age,
-		Gender: "woman", // Default
-	}
-
-	// Extract appearance details from appearance_json if available
-	if comp.AppearanceJSON != nil {
-		if gender, ok := comp.AppearanceJSON["gender"].(string); ok {
-			appearance.Gender = gender
-		}
-		if ethnicity, ok := comp.AppearanceJSON["ethnicity"].(string); ok {
-			appearance.Ethnicity = ethnicity
-		}
-		if hairColor, ok := comp.AppearanceJSON["hairColor"].(string); ok {
-			appearance.HairColor = hairColor
-		}
-		if hairStyle, ok := comp.AppearanceJSON["hairStyle"].(string); ok {
-			appearance.HairStyle = hairStyle
-		}
-		if eyeColor, ok := comp.AppearanceJSON["eyeColor"].(string); ok {
-			appearance.EyeColor = eyeColor
-		}
-		if bodyType, ok := comp.AppearanceJSON["bodyType"].(string); ok {
-			appearance.BodyType = bodyType
-		}
-		if style, ok := comp.AppearanceJSON["style"].(string); ok {
-			appearance.Style = style
-		}
-	}
-
 	// Set default photo type
 	if req.PhotoType == "" {
 		req.PhotoType = "selfie"
 	}
 
-	var imageURL string
-	var provider string
-
-	// Try Hugging Face first (free)
-	if h.huggingFaceService.IsConfigured() {
-		url, err := h.huggingFaceService.GenerateCompanionPhoto(appearance, req.Context, req.PhotoType)
-		if err == nil {
-			imageURL = url
-			provider = "huggingface"
-		}
-	}
-
-	// Fall back to FAL.ai if Hugging Face failed or not configured
-	if imageURL == "" && h.falService.IsConfigured() {
-		url, err := h.falService.GenerateCompanionPhoto(appearance, req.Context, req.PhotoType)
-		if err == nil {
-			imageURL = url
-			provider = "fal"
-		} else {
-			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: "Failed to generate image: " + err.Error()})
-			return
-		}
-	}
-
-	if imageURL == "" {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: "Failed to generate image with any provider"})
+	imageURL, provider, err := h.generatePhoto(comp, req.Context, req.PhotoType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: "Failed to generate image: " + err.Error()})
 		return
 	}
 
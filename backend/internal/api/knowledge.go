@@ -0,0 +1,344 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/services"
+)
+
+// maxKnowledgeUploadSize limits knowledge documents to 1MB
+const maxKnowledgeUploadSize = 1 << 20
+
+// embeddingBatchSize is how many chunks are embedded per request to the embedding backend
+const embeddingBatchSize = 100
+
+// knowledgeExtensions maps accepted document file extensions to MIME types
+var knowledgeExtensions = map[string]string{
+	".txt":      "text/plain",
+	".md":       "text/markdown",
+	".markdown": "text/markdown",
+}
+
+// knowledgeDocumentColumns lists the document columns read by scanKnowledgeDocument
+const knowledgeDocumentColumns = `id, companion_id, title, filename, mime_type, size_bytes, chunk_count, embedded, created_by, created_at`
+
+// scanKnowledgeDocument scans a row selected with knowledgeDocumentColumns
+func scanKnowledgeDocument(row rowScanner, doc *models.KnowledgeDocument) error {
+	return row.Scan(&doc.ID, &doc.CompanionID, &doc.Title, &doc.Filename, &doc.MimeType, &doc.SizeBytes,
+		&doc.ChunkCount, &doc.Embedded, &doc.CreatedBy, &doc.CreatedAt)
+}
+
+// readKnowledgeUpload reads a multipart text or markdown document and checks it is UTF-8 text
+func readKnowledgeUpload(c *gin.Context, field string) (filename string, mimeType string, text string, err error) {
+	file, header, err := c.Request.FormFile(field)
+	if err != nil {
+		return "", "", "", fmt.Errorf("%s is required", field)
+	}
+	defer file.Close()
+
+	mimeType, ok := knowledgeExtensions[strings.ToLower(filepath.Ext(header.Filename))]
+	if !ok {
+		return "", "", "", fmt.Errorf("documents must be .txt or .md files")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxKnowledgeUploadSize+1))
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to read upload: %w", err)
+	}
+	if len(data) > maxKnowledgeUploadSize {
+		return "", "", "", fmt.Errorf("document must be smaller than %dMB", maxKnowledgeUploadSize>>20)
+	}
+	if !utf8.Valid(data) || !strings.HasPrefix(http.DetectContentType(data), "text/plain") {
+		return "", "", "", fmt.Errorf("document must be UTF-8 text")
+	}
+
+	return filepath.Base(header.Filename), mimeType, string(data), nil
+}
+
+// embedChunks embeds chunk texts in batches, returning nil if no embedding backend is configured
+func (h *Handlers) embedChunks(texts []string) ([][]float64, error) {
+	if !h.embeddingProvider.IsConfigured() {
+		return nil, nil
+	}
+
+	vectors := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		end := start + embeddingBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := h.embeddingProvider.Embed(texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+// knowledgeIndex returns the BM25 index of a companion's knowledge base, or nil if it has no documents.
+// Indexes are cached in memory until the companion's documents change.
+func (h *Handlers) knowledgeIndex(companionID string) (*services.KnowledgeIndex, error) {
+	var count int
+	var version string
+	err := h.db.QueryRow(
+		`SELECT COUNT(*), COUNT(*) || '/' || COALESCE(MAX(created_at)::text, '') FROM knowledge_documents WHERE companion_id = $1`,
+		companionID,
+	).Scan(&count, &version)
+	if err != nil || count == 0 {
+		return nil, err
+	}
+
+	if ix, ok := h.knowledgeIndexes.Get(companionID, version); ok {
+		return ix, nil
+	}
+
+	rows, err := h.db.Query(
+		`SELECT k.id, k.document_id, d.title, k.position, k.content, k.embedding
+		FROM knowledge_chunks k JOIN knowledge_documents d ON d.id = k.document_id
+		WHERE d.companion_id = $1
+		ORDER BY d.created_at, k.position`,
+		companionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []services.KnowledgeChunk
+	for rows.Next() {
+		var chunk services.KnowledgeChunk
+		var embedding pq.Float64Array
+		if err := rows.Scan(&chunk.ID, &chunk.DocumentID, &chunk.DocumentTitle, &chunk.Position, &chunk.Content, &embedding); err != nil {
+			continue
+		}
+		chunk.Embedding = embedding
+		chunks = append(chunks, chunk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ix := services.NewKnowledgeIndex(chunks)
+	h.knowledgeIndexes.Put(companionID, version, ix)
+	return ix, nil
+}
+
+// searchKnowledge retrieves the chunks of a companion's knowledge base that best match the query
+func (h *Handlers) searchKnowledge(companionID, query string, k int) ([]services.KnowledgeHit, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+	ix, err := h.knowledgeIndex(companionID)
+	if err != nil || ix == nil {
+		return nil, err
+	}
+
+	// Semantic matching is a bonus; fall back to BM25 if the backend fails
+	var queryEmbedding []float64
+	if h.embeddingProvider.IsConfigured() {
+		if vectors, err := h.embeddingProvider.Embed([]string{query}); err == nil {
+			queryEmbedding = vectors[0]
+		}
+	}
+
+	return ix.Search(query, queryEmbedding, k), nil
+}
+
+// companionKnowledge retrieves knowledge passages for the prompt and the citations to record with the reply.
+// Failing to search the knowledge base is not fatal to a reply, so errors leave it out.
+func (h *Handlers) companionKnowledge(companionID, query string) ([]string, []models.KnowledgeCitation) {
+	hits, err := h.searchKnowledge(companionID, query, services.KnowledgeTopK)
+	if err != nil || len(hits) == 0 {
+		return nil, nil
+	}
+
+	passages := make([]string, 0, len(hits))
+	citations := make([]models.KnowledgeCitation, 0, len(hits))
+	for _, hit := range hits {
+		passages = append(passages, hit.Chunk.Content)
+		citations = append(citations, knowledgeCitation(hit))
+	}
+	return passages, citations
+}
+
+func knowledgeCitation(hit services.KnowledgeHit) models.KnowledgeCitation {
+	return models.KnowledgeCitation{
+		DocumentID: hit.Chunk.DocumentID,
+		Title:      hit.Chunk.DocumentTitle,
+		ChunkID:    hit.Chunk.ID,
+		Position:   hit.Chunk.Position,
+		Score:      hit.Score,
+	}
+}
+
+// ListKnowledgeDocuments lists the documents in a companion's knowledge base (owner or admin)
+func (h *Handlers) ListKnowledgeDocuments(c *gin.Context) {
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	rows, err := h.db.Query(
+		`SELECT `+knowledgeDocumentColumns+` FROM knowledge_documents WHERE companion_id = $1 ORDER BY created_at`,
+		comp.ID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	docs := []models.KnowledgeDocument{}
+	for rows.Next() {
+		var doc models.KnowledgeDocument
+		if err := scanKnowledgeDocument(rows, &doc); err != nil {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: docs})
+}
+
+// UploadKnowledgeDocument adds a text or markdown document (multipart "file", optional "title")
+// to a companion's knowledge base, chunking it and embedding the chunks if a backend is configured (owner or admin)
+func (h *Handlers) UploadKnowledgeDocument(c *gin.Context) {
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	filename, mimeType, text, err := readKnowledgeUpload(c, "file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	title := strings.TrimSpace(c.Request.FormValue("title"))
+	if title == "" {
+		title = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	if utf8.RuneCountInString(title) > 200 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "title must be at most 200 characters"})
+		return
+	}
+
+	chunks := services.ChunkDocument(text)
+	if len(chunks) == 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "document is empty"})
+		return
+	}
+
+	// Documents stay searchable by keyword if embedding fails
+	embeddings, err := h.embedChunks(chunks)
+	if err != nil {
+		embeddings = nil
+	}
+
+	doc := &models.KnowledgeDocument{
+		CompanionID: comp.ID,
+		Title:       title,
+		Filename:    filename,
+		MimeType:    mimeType,
+		SizeBytes:   len(text),
+		ChunkCount:  len(chunks),
+		Embedded:    embeddings != nil,
+		CreatedBy:   optionalString(viewerID(c)),
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		`INSERT INTO knowledge_documents (companion_id, title, filename, mime_type, content, size_bytes, chunk_count, embedded, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at`,
+		doc.CompanionID, doc.Title, doc.Filename, doc.MimeType, text, doc.SizeBytes, doc.ChunkCount, doc.Embedded, doc.CreatedBy,
+	).Scan(&doc.ID, &doc.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	for i, chunk := range chunks {
+		var embedding []float64
+		if embeddings != nil {
+			embedding = embeddings[i]
+		}
+		_, err := tx.Exec(
+			`INSERT INTO knowledge_chunks (document_id, position, content, embedding) VALUES ($1, $2, $3, $4)`,
+			doc.ID, i, chunk, pq.Array(embedding),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{Data: doc})
+}
+
+// SearchKnowledge shows which knowledge chunks a message would retrieve, for creators to test their documents (owner or admin)
+func (h *Handlers) SearchKnowledge(c *gin.Context) {
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "q is required"})
+		return
+	}
+
+	hits, err := h.searchKnowledge(comp.ID, query, services.KnowledgeTopK)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	results := make([]models.KnowledgeSearchResult, 0, len(hits))
+	for _, hit := range hits {
+		results = append(results, models.KnowledgeSearchResult{KnowledgeCitation: knowledgeCitation(hit), Content: hit.Chunk.Content})
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: results})
+}
+
+// DeleteKnowledgeDocument removes a document and its chunks from a companion's knowledge base (owner or admin)
+func (h *Handlers) DeleteKnowledgeDocument(c *gin.Context) {
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	result, err := h.db.Exec(`DELETE FROM knowledge_documents WHERE id = $1 AND companion_id = $2`, c.Param("documentId"), comp.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "document not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "document deleted"})
+}
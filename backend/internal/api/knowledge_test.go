@@ -0,0 +1,53 @@
+package api
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func knowledgeUploadContext(t *testing.T, filename string, data []byte) *gin.Context {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	part.Write(data)
+	writer.Close()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/", &body)
+	c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	return c
+}
+
+func TestReadKnowledgeUpload(t *testing.T) {
+	filename, mimeType, text, err := readKnowledgeUpload(knowledgeUploadContext(t, "lore/Backstory.MD", []byte("# Mia\n\nGrew up in Taipei.")), "file")
+	if err != nil {
+		t.Fatalf("readKnowledgeUpload returned error: %v", err)
+	}
+	if filename != "Backstory.MD" || mimeType != "text/markdown" || text != "# Mia\n\nGrew up in Taipei." {
+		t.Errorf("got %q, %q, %q", filename, mimeType, text)
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+	}{
+		{"unsupported extension", "wiki.pdf", []byte("%PDF-1.4")},
+		{"binary content", "notes.txt", []byte("\x89PNG\r\n\x1a\n\x00\x00")},
+		{"invalid UTF-8", "notes.txt", []byte("caf\xe9")},
+		{"too large", "notes.txt", bytes.Repeat([]byte("a"), maxKnowledgeUploadSize+1)},
+	}
+	for _, tt := range tests {
+		if _, _, _, err := readKnowledgeUpload(knowledgeUploadContext(t, tt.filename, tt.data), "file"); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/services"
+)
+
+// lorebookColumns lists the lorebook entry columns read by scanLorebookEntry
+const lorebookColumns = `id, companion_id, keywords, content, priority, always_on, created_at, updated_at`
+
+// scanLorebookEntry scans a row selected with lorebookColumns
+func scanLorebookEntry(row rowScanner, entry *models.LorebookEntry) error {
+	return row.Scan(&entry.ID, &entry.CompanionID, pq.Array(&entry.Keywords), &entry.Content,
+		&entry.Priority, &entry.AlwaysOn, &entry.CreatedAt, &entry.UpdatedAt)
+}
+
+// loadLorebook fetches a companion's lorebook, highest priority first
+func (h *Handlers) loadLorebook(companionID string) ([]models.LorebookEntry, error) {
+	rows, err := h.db.Query(
+		`SELECT `+lorebookColumns+` FROM lorebook_entries WHERE companion_id = $1 ORDER BY priority DESC, created_at`,
+		companionID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.LorebookEntry{}
+	for rows.Next() {
+		var entry models.LorebookEntry
+		if err := scanLorebookEntry(rows, &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// loadLorebookEntry fetches one entry of a companion's lorebook, returning sql.ErrNoRows if it does not exist
+func (h *Handlers) loadLorebookEntry(companionID, entryID string) (*models.LorebookEntry, error) {
+	var entry models.LorebookEntry
+	row := h.db.QueryRow(`SELECT `+lorebookColumns+` FROM lorebook_entries WHERE id = $1 AND companion_id = $2`, entryID, companionID)
+	if err := scanLorebookEntry(row, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// insertLorebookEntry adds an entry to a companion's lorebook
+func insertLorebookEntry(db dbQueryRower, entry *models.LorebookEntry) error {
+	return db.QueryRow(
+		`INSERT INTO lorebook_entries (companion_id, keywords, content, priority, always_on)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		entry.CompanionID, pq.Array(entry.Keywords), entry.Content, entry.Priority, entry.AlwaysOn,
+	).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// loreEntries converts lorebook entries for prompt selection and card export
+func loreEntries(entries []models.LorebookEntry) []services.LoreEntry {
+	lore := make([]services.LoreEntry, 0, len(entries))
+	for _, entry := range entries {
+		lore = append(lore, services.LoreEntry{
+			Keywords: entry.Keywords,
+			Content:  entry.Content,
+			Priority: entry.Priority,
+			AlwaysOn: entry.AlwaysOn,
+		})
+	}
+	return lore
+}
+
+// companionLore selects the lorebook entries triggered by the latest messages of a conversation.
+// Failing to load the lorebook is not fatal to a reply, so errors leave it out.
+func (h *Handlers) companionLore(companionID string, messages []services.ClaudeMessage) []string {
+	entries, err := h.loadLorebook(companionID)
+	if err != nil || len(entries) == 0 {
+		return nil
+	}
+
+	start := len(messages) - services.LoreScanDepth
+	if start < 0 {
+		start = 0
+	}
+	var recent []string
+	for _, m := range messages[start:] {
+		recent = append(recent, m.Content)
+	}
+
+	var lore []string
+	for _, entry := range services.SelectLore(loreEntries(entries), recent, services.LoreBudget) {
+		lore = append(lore, entry.Content)
+	}
+	return lore
+}
+
+// normalizeKeywords trims keywords and drops empty and case-insensitive duplicate ones
+func normalizeKeywords(keywords []string) []string {
+	out := []string{}
+	seen := make(map[string]bool, len(keywords))
+	for _, keyword := range keywords {
+		keyword = strings.TrimSpace(keyword)
+		key := strings.ToLower(keyword)
+		if keyword == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, keyword)
+	}
+	return out
+}
+
+// ListLorebook lists a companion's lorebook entries, highest priority first (owner or admin)
+func (h *Handlers) ListLorebook(c *gin.Context) {
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	entries, err := h.loadLorebook(comp.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: entries})
+}
+
+// CreateLorebookEntry adds an entry to a companion's lorebook (owner or admin)
+func (h *Handlers) CreateLorebookEntry(c *gin.Context) {
+	var req models.LorebookEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	entry := &models.LorebookEntry{
+		CompanionID: comp.ID,
+		Keywords:    normalizeKeywords(req.Keywords),
+		Content:     strings.TrimSpace(req.Content),
+		Priority:    req.Priority,
+		AlwaysOn:    req.AlwaysOn,
+	}
+	if len(entry.Keywords) == 0 && !entry.AlwaysOn {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "keywords are required unless the entry is always on"})
+		return
+	}
+
+	if err := insertLorebookEntry(h.db, entry); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{Data: entry})
+}
+
+// UpdateLorebookEntry changes a lorebook entry (owner or admin)
+func (h *Handlers) UpdateLorebookEntry(c *gin.Context) {
+	var req models.UpdateLorebookEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	entry, err := h.loadLorebookEntry(comp.ID, c.Param("entryId"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "lorebook entry not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	if req.Keywords != nil {
+		entry.Keywords = normalizeKeywords(*req.Keywords)
+	}
+	if req.Content != nil {
+		entry.Content = strings.TrimSpace(*req.Content)
+	}
+	if req.Priority != nil {
+		entry.Priority = *req.Priority
+	}
+	if req.AlwaysOn != nil {
+		entry.AlwaysOn = *req.AlwaysOn
+	}
+	if len(entry.Keywords) == 0 && !entry.AlwaysOn {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "keywords are required unless the entry is always on"})
+		return
+	}
+
+	now := time.Now()
+	_, err = h.db.Exec(
+		`UPDATE lorebook_entries SET keywords = $2, content = $3, priority = $4, always_on = $5, updated_at = $6 WHERE id = $1`,
+		entry.ID, pq.Array(entry.Keywords), entry.Content, entry.Priority, entry.AlwaysOn, now,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	entry.UpdatedAt = &now
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: entry})
+}
+
+// DeleteLorebookEntry removes an entry from a companion's lorebook (owner or admin)
+func (h *Handlers) DeleteLorebookEntry(c *gin.Context) {
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	result, err := h.db.Exec(`DELETE FROM lorebook_entries WHERE id = $1 AND companion_id = $2`, c.Param("entryId"), comp.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "lorebook entry not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "lorebook entry deleted"})
+}
@@ -0,0 +1,513 @@
+package api
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/websocket"
+)
+
+// messageColumns lists the message columns read by scanMessage
+const messageColumns = `id, conversation_id, parent_id, sender, content, metadata, delivered_at, read_at, edited_at, created_at`
+
+// scanMessage scans a row selected with messageColumns
+func scanMessage(row rowScanner, msg *models.Message) error {
+	return row.Scan(&msg.ID, &msg.ConversationID, &msg.ParentID, &msg.Sender, &msg.Content, &msg.Metadata,
+		&msg.DeliveredAt, &msg.ReadAt, &msg.EditedAt, &msg.CreatedAt)
+}
+
+// messagePathCTE selects the messages on the branch ending at message $1 as "path", walking
+// at most $2 messages back. depth counts from 0 at the leaf.
+const messagePathCTE = `WITH RECURSIVE path AS (
+	SELECT m.*, 0 AS depth FROM messages m WHERE m.id = $1
+	UNION ALL
+	SELECT m.*, path.depth + 1 FROM messages m JOIN path ON m.id = path.parent_id WHERE path.depth + 1 < $2
+)`
+
+// maxPromptPathDepth bounds how far back the prompt builder walks a branch
+const maxPromptPathDepth = 50
+
+// maxPathDepth bounds how far back history walks a branch
+const maxPathDepth = 100000
+
+// insertMessage saves a message and, if it continues the conversation's active branch, makes it
+// the active leaf. A reply to a message that stopped being the leaf meanwhile, because another
+// message was sent or the user switched branches, leaves the active branch as it is.
+func insertMessage(tx *sql.Tx, msg *models.Message) error {
+	if msg.Metadata == nil {
+		msg.Metadata = models.JSONB{}
+	}
+	_, err := tx.Exec(
+		`INSERT INTO messages (id, conversation_id, parent_id, sender, content, metadata, delivered_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		msg.ID, msg.ConversationID, msg.ParentID, msg.Sender, msg.Content, msg.Metadata, msg.DeliveredAt,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`UPDATE conversations SET active_leaf_id = $2 WHERE id = $1 AND active_leaf_id IS NOT DISTINCT FROM $3`,
+		msg.ConversationID, msg.ID, msg.ParentID,
+	)
+	return err
+}
+
+// lockActiveLeaf locks a conversation's row until the transaction ends and returns its active
+// leaf, so messages sent at the same time are chained one after the other
+func lockActiveLeaf(tx *sql.Tx, conversationID string) (*string, error) {
+	var leafID *string
+	err := tx.QueryRow(`SELECT active_leaf_id FROM conversations WHERE id = $1 FOR UPDATE`, conversationID).Scan(&leafID)
+	return leafID, err
+}
+
+// sameTime reports whether two optional timestamps are both unset or the same instant
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// setActiveLeaf makes the branch ending at a message the one the conversation shows
+func setActiveLeaf(db dbExecer, conversationID, messageID string) error {
+	_, err := db.Exec(`UPDATE conversations SET active_leaf_id = $2 WHERE id = $1`, conversationID, messageID)
+	return err
+}
+
+// ownedMessage loads a message that is not deleted from one of the user's conversations,
+// writing the error response itself if it can't
+func (h *Handlers) ownedMessage(c *gin.Context, userID, messageID string) (*models.Message, *models.Conversation, bool) {
+	var msg models.Message
+	err := scanMessage(h.db.QueryRow(
+		`SELECT `+prefixColumns("m", messageColumns)+` FROM messages m
+		JOIN conversations conv ON conv.id = m.conversation_id
+		WHERE m.id = $1 AND conv.user_id = $2 AND m.deleted_at IS NULL`,
+		messageID, userID,
+	), &msg)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "message not found"})
+		return nil, nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return nil, nil, false
+	}
+
+	conv, ok := h.ownedConversation(c, userID, msg.ConversationID)
+	if !ok {
+		return nil, nil, false
+	}
+	return &msg, conv, true
+}
+
+// reviseMessage keeps the current version of a message, with its attachments and feedback, as a
+// revision. Reactions were to the replaced content, so they are cleared.
+func reviseMessage(tx *sql.Tx, msg *models.Message) error {
+	revisionID := uuid.New().String()
+	_, err := tx.Exec(
+		`INSERT INTO message_revisions (id, message_id, content, metadata) VALUES ($1, $2, $3, $4)`,
+		revisionID, msg.ID, msg.Content, msg.Metadata,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE message_attachments SET revision_id = $2 WHERE message_id = $1 AND revision_id IS NULL`,
+		msg.ID, revisionID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE message_feedback SET revision_id = $2 WHERE message_id = $1 AND revision_id IS NULL`,
+		msg.ID, revisionID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM message_reactions WHERE message_id = $1`, msg.ID)
+	return err
+}
+
+// deleteDescendants soft-deletes the messages that follow a message on any branch
+func deleteDescendants(tx *sql.Tx, conversationID, messageID string) (*models.MessagesDeleted, error) {
+	deleted := &models.MessagesDeleted{ConversationID: conversationID, DeletedAt: time.Now()}
+	rows, err := tx.Query(
+		`WITH RECURSIVE descendants AS (
+			SELECT id FROM messages WHERE parent_id = $1
+			UNION ALL
+			SELECT m.id FROM messages m JOIN descendants d ON m.parent_id = d.id
+		)
+		UPDATE messages SET deleted_at = $2
+		WHERE id IN (SELECT id FROM descendants) AND deleted_at IS NULL
+		RETURNING id`,
+		messageID, deleted.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if deleted.MessageIDs, err = collectIDs(rows); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// broadcastDeleted tells the conversation's clients about deleted messages, if there are any
+func (h *Handlers) broadcastDeleted(deleted *models.MessagesDeleted) {
+	if len(deleted.MessageIDs) > 0 {
+		h.wsHub.BroadcastEvent(deleted.ConversationID, websocket.EventMessageDeleted, deleted)
+	}
+}
+
+// RegenerateMessage generates a new companion reply in place of one. By default the reply must
+// end the active branch and is replaced, keeping the previous version as a revision; with branch
+// set the new reply is added beside it as an alternative and becomes the active branch.
+func (h *Handlers) RegenerateMessage(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.RegenerateMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	msg, conv, ok := h.ownedMessage(c, userID.(string), c.Param("id"))
+	if !ok {
+		return
+	}
+	if msg.Sender != "ai" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "only companion messages can be regenerated"})
+		return
+	}
+	if conv.ArchivedAt != nil {
+		c.JSON(http.StatusConflict, models.APIResponse{Error: "conversation is archived"})
+		return
+	}
+
+	// Answer the same message again
+	var parent *models.Message
+	if msg.ParentID != nil {
+		parent = &models.Message{}
+		err := scanMessage(h.db.QueryRow(`SELECT `+messageColumns+` FROM messages WHERE id = $1`, *msg.ParentID), parent)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	if req.Branch {
+		if parent == nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{Error: "message does not answer another message"})
+			return
+		}
+		aiMsg, err := h.replyToMessage(conv.UserID, conv.CompanionID, parent, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+		// The new reply is a sibling of the active branch's, so switch to it
+		if err := setActiveLeaf(h.db, conv.ID, aiMsg.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+		h.broadcastBranch(conv.ID, aiMsg.ID)
+		c.JSON(http.StatusOK, models.APIResponse{Data: aiMsg})
+		return
+	}
+
+	if conv.ActiveLeafID == nil || *conv.ActiveLeafID != msg.ID {
+		c.JSON(http.StatusConflict, models.APIResponse{Error: "only the latest message can be regenerated"})
+		return
+	}
+
+	var parentID, prompt string
+	if parent != nil {
+		parentID, prompt = parent.ID, parent.Content
+	}
+	reply := h.composeReply(conv.UserID, conv.CompanionID, conv.ID, parentID, prompt)
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// The reply took a while; make sure nothing was sent, branched or regenerated meanwhile
+	leafID, err := lockActiveLeaf(tx, conv.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	var editedAt *time.Time
+	err = tx.QueryRow(`SELECT edited_at FROM messages WHERE id = $1 AND deleted_at IS NULL`, msg.ID).Scan(&editedAt)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if err == sql.ErrNoRows || leafID == nil || *leafID != msg.ID || !sameTime(editedAt, msg.EditedAt) {
+		if reply.photo != nil && reply.photo.StorageKey != nil {
+			h.storage.Delete(*reply.photo.StorageKey)
+		}
+		c.JSON(http.StatusConflict, models.APIResponse{Error: "the conversation changed while the reply was generated"})
+		return
+	}
+
+	if err := reviseMessage(tx, msg); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	promptContext, err := reply.promptContextJSON()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	now := time.Now()
+	msg.Content, msg.Metadata, msg.EditedAt = reply.content, reply.metadata, &now
+	msg.Attachments, msg.ImageURL = nil, nil
+	if _, err := tx.Exec(
+		`UPDATE messages SET content = $2, metadata = $3, edited_at = $4, prompt_context = $5 WHERE id = $1`,
+		msg.ID, msg.Content, msg.Metadata, msg.EditedAt, promptContext,
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	if reply.photo != nil {
+		reply.photo.MessageID = &msg.ID
+		if err := insertAttachment(tx, reply.photo); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+		setAttachments(msg, []models.Attachment{*reply.photo})
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	h.wsHub.BroadcastEvent(conv.ID, websocket.EventMessageUpdated, msg)
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: msg})
+}
+
+// EditMessage replaces the content of a user message and generates a new companion reply to it.
+// By default the message is changed in place, keeping the previous version as a revision and
+// deleting the messages after it; with branch set the edit is added beside the original as a new
+// branch, leaving the original branch intact.
+func (h *Handlers) EditMessage(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "content required"})
+		return
+	}
+
+	msg, conv, ok := h.ownedMessage(c, userID.(string), c.Param("id"))
+	if !ok {
+		return
+	}
+	if msg.Sender != "user" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "only your own messages can be edited"})
+		return
+	}
+	if conv.ArchivedAt != nil {
+		c.JSON(http.StatusConflict, models.APIResponse{Error: "conversation is archived"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	deleted := &models.MessagesDeleted{ConversationID: conv.ID}
+	if req.Branch {
+		// The edit is a sibling of the original; attachments stay with the original
+		msg = &models.Message{
+			ID:             uuid.New().String(),
+			ConversationID: conv.ID,
+			ParentID:       msg.ParentID,
+			Sender:         "user",
+			Content:        req.Content,
+			CreatedAt:      time.Now(),
+		}
+		msg.DeliveredAt = &msg.CreatedAt
+		if err := insertMessage(tx, msg); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+		if err := setActiveLeaf(tx, conv.ID, msg.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+	} else {
+		// Only the text is replaced, so the attachments stay with the current version
+		if _, err := tx.Exec(
+			`INSERT INTO message_revisions (message_id, content, metadata) VALUES ($1, $2, $3)`,
+			msg.ID, msg.Content, msg.Metadata,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+
+		now := time.Now()
+		msg.Content, msg.EditedAt, msg.ReadAt = req.Content, &now, nil
+		if _, err := tx.Exec(
+			`UPDATE messages SET content = $2, edited_at = $3, read_at = NULL WHERE id = $1`,
+			msg.ID, msg.Content, msg.EditedAt,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+
+		// The conversation continues from the edited message
+		if deleted, err = deleteDescendants(tx, conv.ID, msg.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+		if err := setActiveLeaf(tx, conv.ID, msg.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	if !req.Branch {
+		attachments, err := h.loadAttachments([]string{msg.ID})
+		if err == nil {
+			setAttachments(msg, attachments[msg.ID])
+		}
+		h.broadcastDeleted(deleted)
+		h.wsHub.BroadcastEvent(conv.ID, websocket.EventMessageUpdated, msg)
+	}
+
+	aiMsg, err := h.replyToMessage(conv.UserID, conv.CompanionID, msg, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if req.Branch {
+		h.broadcastBranch(conv.ID, aiMsg.ID)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Data: models.SendMessageResponse{
+			UserMessage: msg,
+			AIMessage:   aiMsg,
+		},
+	})
+}
+
+// DeleteMessage soft-deletes a message; deleted messages leave the history and the prompt
+func (h *Handlers) DeleteMessage(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	msg, conv, ok := h.ownedMessage(c, userID.(string), c.Param("id"))
+	if !ok {
+		return
+	}
+	if conv.ArchivedAt != nil {
+		c.JSON(http.StatusConflict, models.APIResponse{Error: "conversation is archived"})
+		return
+	}
+
+	deleted := &models.MessagesDeleted{ConversationID: msg.ConversationID, MessageIDs: []string{msg.ID}, DeletedAt: time.Now()}
+	result, err := h.db.Exec(`UPDATE messages SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL`, msg.ID, deleted.DeletedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	// Another request deleted it since it was loaded
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "message not found"})
+		return
+	}
+
+	h.broadcastDeleted(deleted)
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "message deleted"})
+}
+
+// ListMessageRevisions lists the earlier versions of a message, oldest first
+func (h *Handlers) ListMessageRevisions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	msg, _, ok := h.ownedMessage(c, userID.(string), c.Param("id"))
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.Query(
+		`SELECT id, message_id, content, metadata, created_at FROM message_revisions
+		WHERE message_id = $1 ORDER BY created_at ASC`,
+		msg.ID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	revisions := []models.MessageRevision{}
+	var ids []string
+	for rows.Next() {
+		var rev models.MessageRevision
+		if err := rows.Scan(&rev.ID, &rev.MessageID, &rev.Content, &rev.Metadata, &rev.CreatedAt); err != nil {
+			continue
+		}
+		revisions = append(revisions, rev)
+		ids = append(ids, rev.ID)
+	}
+
+	attachments, err := h.loadRevisionAttachments(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	for i := range revisions {
+		revisions[i].Attachments = attachments[revisions[i].ID]
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: revisions})
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"nectar-ai-companion/internal/models"
+)
+
+// countingRow records how many destinations a scan was given
+type countingRow struct{ dest int }
+
+func (r *countingRow) Scan(dest ...interface{}) error {
+	r.dest = len(dest)
+	return nil
+}
+
+func TestColumnListsMatchScanners(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns string
+		scan    func(rowScanner) error
+	}{
+		{"message", messageColumns, func(row rowScanner) error { return scanMessage(row, &models.Message{}) }},
+		{"conversation", conversationColumns, func(row rowScanner) error { return scanConversation(row, &models.Conversation{}) }},
+		{"attachment", attachmentColumns, func(row rowScanner) error { return scanAttachment(row, &models.Attachment{}) }},
+	}
+
+	for _, tt := range tests {
+		row := &countingRow{}
+		tt.scan(row)
+		if want := len(strings.Split(tt.columns, ",")); row.dest != want {
+			t.Errorf("%s: scanned %d destinations for %d columns", tt.name, row.dest, want)
+		}
+	}
+}
+
+func TestSameTime(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	same := at.In(time.FixedZone("CEST", 2*60*60))
+	later := at.Add(time.Microsecond)
+
+	tests := []struct {
+		a, b *time.Time
+		want bool
+	}{
+		{nil, nil, true},
+		{&at, nil, false},
+		{nil, &at, false},
+		{&at, &same, true},
+		{&at, &later, false},
+	}
+	for i, tt := range tests {
+		if got := sameTime(tt.a, tt.b); got != tt.want {
+			t.Errorf("case %d: sameTime = %v, want %v", i, got, tt.want)
+		}
+	}
+}
@@ -65,3 +65,18 @@ func OptionalAuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// AdminMiddleware allows only admins through; it must run after AuthMiddleware
+func AdminMiddleware(authService *services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _ := c.Get("userID")
+		id, _ := userID.(string)
+		admin, err := authService.IsAdmin(id)
+		if err != nil || !admin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
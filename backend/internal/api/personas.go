@@ -0,0 +1,358 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/services"
+)
+
+// personaColumns lists the persona columns read by scanPersona
+const personaColumns = `id, user_id, display_name, pronouns, description, preferences, is_default, created_at, updated_at`
+
+// scanPersona scans a row selected with personaColumns
+func scanPersona(row rowScanner, p *models.UserPersona) error {
+	return row.Scan(&p.ID, &p.UserID, &p.DisplayName, &p.Pronouns, &p.Description, pq.Array(&p.Preferences),
+		&p.IsDefault, &p.CreatedAt, &p.UpdatedAt)
+}
+
+// loadPersona fetches one of the user's personas, returning sql.ErrNoRows if it does not exist
+func (h *Handlers) loadPersona(userID, personaID string) (*models.UserPersona, error) {
+	var p models.UserPersona
+	row := h.db.QueryRow(`SELECT `+personaColumns+` FROM user_personas WHERE id = $1 AND user_id = $2`, personaID, userID)
+	if err := scanPersona(row, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// defaultPersona fetches the user's default persona, returning sql.ErrNoRows if they have none
+func (h *Handlers) defaultPersona(userID string) (*models.UserPersona, error) {
+	var p models.UserPersona
+	row := h.db.QueryRow(`SELECT `+personaColumns+` FROM user_personas WHERE user_id = $1 AND is_default`, userID)
+	if err := scanPersona(row, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// promptPersona picks the persona a user chats as: the one given, else their default.
+// Users without personas, and lookup failures, give no persona rather than failing the reply.
+func (h *Handlers) promptPersona(userID, personaID string) *services.UserContext {
+	if userID == "" {
+		return nil
+	}
+	var p *models.UserPersona
+	var err error
+	if personaID != "" {
+		p, err = h.loadPersona(userID, personaID)
+	}
+	if p == nil {
+		p, err = h.defaultPersona(userID)
+	}
+	if err != nil {
+		return nil
+	}
+	return personaContext(p)
+}
+
+// conversationPersona returns the persona the user chats as in a conversation
+func (h *Handlers) conversationPersona(conversationID, userID string) *services.UserContext {
+	var personaID sql.NullString
+	h.db.QueryRow(`SELECT persona_id FROM conversations WHERE id = $1`, conversationID).Scan(&personaID)
+	return h.promptPersona(userID, personaID.String)
+}
+
+// personaContext converts a persona for prompt building
+func personaContext(p *models.UserPersona) *services.UserContext {
+	return &services.UserContext{
+		DisplayName: p.DisplayName,
+		Pronouns:    p.Pronouns,
+		Description: p.Description,
+		Preferences: p.Preferences,
+	}
+}
+
+// applyPersonaRequest copies the request fields onto a persona, trimming them
+func applyPersonaRequest(p *models.UserPersona, req models.PersonaRequest) {
+	p.DisplayName = strings.TrimSpace(req.DisplayName)
+	p.Pronouns = strings.TrimSpace(req.Pronouns)
+	p.Description = strings.TrimSpace(req.Description)
+	p.Preferences = []string{}
+	for _, pref := range req.Preferences {
+		if pref = strings.TrimSpace(pref); pref != "" {
+			p.Preferences = append(p.Preferences, pref)
+		}
+	}
+}
+
+// savePersona inserts or updates a persona. A user's first persona becomes their default,
+// and making a persona the default clears the flag on their others.
+func (h *Handlers) savePersona(p *models.UserPersona) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var others int
+	if err := tx.QueryRow(
+		`SELECT COUNT(*) FROM user_personas WHERE user_id = $1 AND id::text <> $2`, p.UserID, p.ID,
+	).Scan(&others); err != nil {
+		return err
+	}
+	if others == 0 {
+		p.IsDefault = true
+	}
+
+	if p.IsDefault {
+		if _, err := tx.Exec(
+			`UPDATE user_personas SET is_default = FALSE WHERE user_id = $1 AND is_default AND id::text <> $2`, p.UserID, p.ID,
+		); err != nil {
+			return err
+		}
+	}
+
+	if p.ID == "" {
+		err = tx.QueryRow(
+			`INSERT INTO user_personas (user_id, display_name, pronouns, description, preferences, is_default)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+			p.UserID, p.DisplayName, p.Pronouns, p.Description, pq.Array(p.Preferences), p.IsDefault,
+		).Scan(&p.ID, &p.CreatedAt)
+	} else {
+		now := time.Now()
+		_, err = tx.Exec(
+			`UPDATE user_personas SET display_name = $2, pronouns = $3, description = $4, preferences = $5,
+				is_default = $6, updated_at = $7
+			WHERE id = $1`,
+			p.ID, p.DisplayName, p.Pronouns, p.Description, pq.Array(p.Preferences), p.IsDefault, now,
+		)
+		p.UpdatedAt = &now
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetProfile returns the user's default persona
+func (h *Handlers) GetProfile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	p, err := h.defaultPersona(userID.(string))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "profile not set"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: p})
+}
+
+// UpdateProfile creates or replaces the user's default persona
+func (h *Handlers) UpdateProfile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.PersonaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	p, err := h.defaultPersona(userID.(string))
+	if err == sql.ErrNoRows {
+		p, err = &models.UserPersona{UserID: userID.(string)}, nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	applyPersonaRequest(p, req)
+	p.IsDefault = true
+	if err := h.savePersona(p); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: p})
+}
+
+// ListPersonas lists the user's personas, the default first
+func (h *Handlers) ListPersonas(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	rows, err := h.db.Query(
+		`SELECT `+personaColumns+` FROM user_personas WHERE user_id = $1 ORDER BY is_default DESC, created_at`,
+		userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	personas := []models.UserPersona{}
+	for rows.Next() {
+		var p models.UserPersona
+		if err := scanPersona(rows, &p); err != nil {
+			continue
+		}
+		personas = append(personas, p)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: personas})
+}
+
+// CreatePersona adds a persona; the user's first persona becomes their default
+func (h *Handlers) CreatePersona(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.PersonaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	p := &models.UserPersona{UserID: userID.(string), IsDefault: req.IsDefault}
+	applyPersonaRequest(p, req)
+	if err := h.savePersona(p); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{Data: p})
+}
+
+// UpdatePersona replaces a persona's fields. The default can be moved to another persona but not cleared.
+func (h *Handlers) UpdatePersona(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.PersonaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	p, err := h.loadPersona(userID.(string), c.Param("id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "persona not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	applyPersonaRequest(p, req)
+	p.IsDefault = p.IsDefault || req.IsDefault
+	if err := h.savePersona(p); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: p})
+}
+
+// DeletePersona removes a persona. Its conversations fall back to the default, and
+// deleting the default makes the user's oldest remaining persona the default.
+func (h *Handlers) DeletePersona(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var wasDefault bool
+	err = tx.QueryRow(
+		`DELETE FROM user_personas WHERE id = $1 AND user_id = $2 RETURNING is_default`,
+		c.Param("id"), userID,
+	).Scan(&wasDefault)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "persona not found"})
+		return
+	}
+	if err == nil && wasDefault {
+		_, err = tx.Exec(
+			`UPDATE user_personas SET is_default = TRUE
+			WHERE id = (SELECT id FROM user_personas WHERE user_id = $1 ORDER BY created_at LIMIT 1)`,
+			userID,
+		)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "persona deleted"})
+}
+
+// SetConversationPersona picks the persona the user chats as in a conversation; an empty personaId uses the default
+func (h *Handlers) SetConversationPersona(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.SetConversationPersonaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	conv, ok := h.ownedConversation(c, userID.(string), c.Param("id"))
+	if !ok {
+		return
+	}
+	if conv.PersonaID, ok = h.requestedPersona(c, userID.(string), req.PersonaID); !ok {
+		return
+	}
+
+	if _, err := h.db.Exec(`UPDATE conversations SET persona_id = $2 WHERE id = $1`, conv.ID, conv.PersonaID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: conv})
+}
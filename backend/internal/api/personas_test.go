@@ -0,0 +1,30 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"nectar-ai-companion/internal/models"
+)
+
+func TestApplyPersonaRequestTrimsFields(t *testing.T) {
+	var p models.UserPersona
+	applyPersonaRequest(&p, models.PersonaRequest{
+		DisplayName: "  Sam ",
+		Pronouns:    " they/them",
+		Description: "Night owl.\n",
+		Preferences: []string{" slow burn ", "", "   ", "no pet names"},
+	})
+
+	if p.DisplayName != "Sam" || p.Pronouns != "they/them" || p.Description != "Night owl." {
+		t.Errorf("fields not trimmed: %+v", p)
+	}
+	if want := []string{"slow burn", "no pet names"}; !reflect.DeepEqual(p.Preferences, want) {
+		t.Errorf("preferences = %q, want %q", p.Preferences, want)
+	}
+
+	applyPersonaRequest(&p, models.PersonaRequest{DisplayName: "Sam"})
+	if p.Preferences == nil || len(p.Preferences) != 0 {
+		t.Errorf("preferences = %#v, want an empty list", p.Preferences)
+	}
+}
@@ -0,0 +1,418 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/websocket"
+)
+
+// feedbackReasons lists the reasons a rating can give, by rating
+var feedbackReasons = map[string]map[string]bool{
+	"up": {
+		"in_character": true,
+		"engaging":     true,
+		"funny":        true,
+		"helpful":      true,
+		"other":        true,
+	},
+	"down": {
+		"off_character": true,
+		"repetitive":    true,
+		"inaccurate":    true,
+		"inappropriate": true,
+		"too_long":      true,
+		"too_short":     true,
+		"other":         true,
+	},
+}
+
+// feedbackColumns lists the feedback columns read by scanFeedback
+const feedbackColumns = `id, message_id, user_id, rating, reasons, comment, provider, model, prompt_version, created_at, updated_at`
+
+// scanFeedback scans a row selected with feedbackColumns
+func scanFeedback(row rowScanner, f *models.MessageFeedback) error {
+	return row.Scan(&f.ID, &f.MessageID, &f.UserID, &f.Rating, pq.Array(&f.Reasons), &f.Comment,
+		&f.Provider, &f.Model, &f.PromptVersion, &f.CreatedAt, &f.UpdatedAt)
+}
+
+// isEmojiRune reports whether a rune can be part of an emoji sequence: pictographs, symbols,
+// regional indicators, joiners, variation selectors, keycaps and tag characters
+func isEmojiRune(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF, r >= 0x2000 && r <= 0x2BFF, r >= 0xE0020 && r <= 0xE007F:
+		return true
+	case r == 0x200D, r == 0xFE0F, r == 0x20E3, r == 0x00A9, r == 0x00AE,
+		r == 0x3030, r == 0x303D, r == 0x3297, r == 0x3299:
+		return true
+	case r >= '0' && r <= '9', r == '#', r == '*':
+		return true // Keycap bases
+	}
+	return false
+}
+
+// validEmoji reports whether s is a single short emoji sequence
+func validEmoji(s string) bool {
+	if s == "" || len(s) > 32 || !utf8.ValidString(s) {
+		return false
+	}
+	pictographic := false
+	for _, r := range s {
+		if !isEmojiRune(r) {
+			return false
+		}
+		if r > 0x7F && r != 0x200D && r != 0xFE0F {
+			pictographic = true
+		}
+	}
+	return pictographic
+}
+
+// validFeedbackReasons checks that reasons are known for the rating and not repeated
+func validFeedbackReasons(rating string, reasons []string) bool {
+	seen := map[string]bool{}
+	for _, reason := range reasons {
+		if !feedbackReasons[rating][reason] || seen[reason] {
+			return false
+		}
+		seen[reason] = true
+	}
+	return true
+}
+
+// loadReactions counts the emoji reactions on messages, marking the viewer's own
+func (h *Handlers) loadReactions(messageIDs []string, viewerID string) (map[string][]models.ReactionCount, error) {
+	result := map[string][]models.ReactionCount{}
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	rows, err := h.db.Query(
+		`SELECT message_id, emoji, COUNT(*), BOOL_OR(user_id::text = $2)
+		FROM message_reactions WHERE message_id = ANY($1)
+		GROUP BY message_id, emoji ORDER BY message_id, MIN(created_at)`,
+		pq.Array(messageIDs), viewerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID string
+		var rc models.ReactionCount
+		if err := rows.Scan(&messageID, &rc.Emoji, &rc.Count, &rc.Reacted); err != nil {
+			return nil, err
+		}
+		result[messageID] = append(result[messageID], rc)
+	}
+	return result, rows.Err()
+}
+
+// loadFeedback loads a user's current feedback on messages
+func (h *Handlers) loadFeedback(messageIDs []string, userID string) (map[string]*models.MessageFeedback, error) {
+	result := map[string]*models.MessageFeedback{}
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	rows, err := h.db.Query(
+		`SELECT `+feedbackColumns+` FROM message_feedback
+		WHERE message_id = ANY($1) AND user_id = $2 AND revision_id IS NULL`,
+		pq.Array(messageIDs), userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f models.MessageFeedback
+		if err := scanFeedback(rows, &f); err != nil {
+			return nil, err
+		}
+		result[f.MessageID] = &f
+	}
+	return result, rows.Err()
+}
+
+// setReactions fills in the reactions on messages and the viewer's feedback on them
+func (h *Handlers) setReactions(messages []models.Message, viewerID string) error {
+	ids := make([]string, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+	}
+
+	reactions, err := h.loadReactions(ids, viewerID)
+	if err != nil {
+		return err
+	}
+	feedback, err := h.loadFeedback(ids, viewerID)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Reactions = reactions[messages[i].ID]
+		messages[i].Feedback = feedback[messages[i].ID]
+	}
+	return nil
+}
+
+// reactableMessage loads a companion message from one of the user's conversations, writing
+// the error response itself if it can't
+func (h *Handlers) reactableMessage(c *gin.Context, userID, messageID string) (*models.Message, bool) {
+	msg, _, ok := h.ownedMessage(c, userID, messageID)
+	if !ok {
+		return nil, false
+	}
+	if msg.Sender != "ai" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "only companion messages can be rated or reacted to"})
+		return nil, false
+	}
+	return msg, true
+}
+
+// AddReaction reacts to a companion message with an emoji
+func (h *Handlers) AddReaction(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.ReactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if !validEmoji(req.Emoji) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "emoji must be a single emoji"})
+		return
+	}
+
+	msg, ok := h.reactableMessage(c, userID.(string), c.Param("id"))
+	if !ok {
+		return
+	}
+
+	reaction := models.MessageReaction{
+		ConversationID: msg.ConversationID,
+		MessageID:      msg.ID,
+		UserID:         userID.(string),
+		Emoji:          req.Emoji,
+	}
+	err := h.db.QueryRow(
+		`INSERT INTO message_reactions (message_id, user_id, emoji) VALUES ($1, $2, $3)
+		ON CONFLICT (message_id, user_id, emoji) DO NOTHING
+		RETURNING created_at`,
+		reaction.MessageID, reaction.UserID, reaction.Emoji,
+	).Scan(&reaction.CreatedAt)
+	if err == sql.ErrNoRows {
+		// Already reacted with this emoji
+		c.JSON(http.StatusOK, models.APIResponse{Message: "reaction already added"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	h.wsHub.BroadcastEvent(msg.ConversationID, websocket.EventReactionAdded, reaction)
+
+	c.JSON(http.StatusCreated, models.APIResponse{Data: reaction})
+}
+
+// RemoveReaction takes back the user's reaction with the emoji query parameter
+func (h *Handlers) RemoveReaction(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	emoji := c.Query("emoji")
+	if emoji == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "emoji is required"})
+		return
+	}
+
+	msg, _, ok := h.ownedMessage(c, userID.(string), c.Param("id"))
+	if !ok {
+		return
+	}
+
+	result, err := h.db.Exec(
+		`DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3`,
+		msg.ID, userID, emoji,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "reaction not found"})
+		return
+	}
+
+	h.wsHub.BroadcastEvent(msg.ConversationID, websocket.EventReactionRemoved, models.MessageReaction{
+		ConversationID: msg.ConversationID,
+		MessageID:      msg.ID,
+		UserID:         userID.(string),
+		Emoji:          emoji,
+		CreatedAt:      time.Now(),
+	})
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "reaction removed"})
+}
+
+// SetMessageFeedback rates a companion reply thumbs up or down, replacing the user's earlier rating.
+// The provider, model and prompt version recorded on the reply are kept with the rating.
+func (h *Handlers) SetMessageFeedback(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.FeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if !validFeedbackReasons(req.Rating, req.Reasons) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "unknown or repeated reason for a " + req.Rating + " rating"})
+		return
+	}
+	if req.Reasons == nil {
+		req.Reasons = []string{}
+	}
+
+	msg, ok := h.reactableMessage(c, userID.(string), c.Param("id"))
+	if !ok {
+		return
+	}
+
+	provider, _ := msg.Metadata["provider"].(string)
+	model, _ := msg.Metadata["model"].(string)
+	promptVersion, _ := msg.Metadata["promptVersion"].(string)
+
+	var f models.MessageFeedback
+	err := scanFeedback(h.db.QueryRow(
+		`INSERT INTO message_feedback (message_id, user_id, rating, reasons, comment, provider, model, prompt_version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (message_id, user_id) WHERE revision_id IS NULL DO UPDATE SET
+			rating = EXCLUDED.rating, reasons = EXCLUDED.reasons, comment = EXCLUDED.comment,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING `+feedbackColumns,
+		msg.ID, userID, req.Rating, pq.Array(req.Reasons), strings.TrimSpace(req.Comment),
+		provider, model, promptVersion,
+	), &f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: f})
+}
+
+// DeleteMessageFeedback takes back the user's rating of a companion reply
+func (h *Handlers) DeleteMessageFeedback(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	msg, _, ok := h.ownedMessage(c, userID.(string), c.Param("id"))
+	if !ok {
+		return
+	}
+
+	result, err := h.db.Exec(
+		`DELETE FROM message_feedback WHERE message_id = $1 AND user_id = $2 AND revision_id IS NULL`,
+		msg.ID, userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "feedback not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "feedback removed"})
+}
+
+// GetFeedbackStats aggregates reply feedback per provider, model and prompt version, including
+// the ratings of regenerated replies. Limit it to ratings given since an RFC 3339 time with since.
+func (h *Handlers) GetFeedbackStats(c *gin.Context) {
+	var since time.Time
+	if s := c.Query("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{Error: "since must be an RFC 3339 time"})
+			return
+		}
+		since = t
+	}
+
+	rows, err := h.db.Query(
+		`SELECT provider, model, prompt_version,
+			COUNT(*) FILTER (WHERE rating = 'up'), COUNT(*) FILTER (WHERE rating = 'down')
+		FROM message_feedback WHERE created_at >= $1
+		GROUP BY provider, model, prompt_version
+		ORDER BY provider, model, prompt_version`,
+		since,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	stats := []models.FeedbackStats{}
+	index := map[[3]string]int{}
+	for rows.Next() {
+		s := models.FeedbackStats{Reasons: map[string]int{}}
+		if err := rows.Scan(&s.Provider, &s.Model, &s.PromptVersion, &s.Up, &s.Down); err != nil {
+			continue
+		}
+		s.Approval = float64(s.Up) / float64(s.Up+s.Down)
+		index[[3]string{s.Provider, s.Model, s.PromptVersion}] = len(stats)
+		stats = append(stats, s)
+	}
+
+	reasonRows, err := h.db.Query(
+		`SELECT provider, model, prompt_version, reason, COUNT(*)
+		FROM message_feedback, unnest(reasons) AS reason WHERE created_at >= $1
+		GROUP BY provider, model, prompt_version, reason`,
+		since,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer reasonRows.Close()
+
+	for reasonRows.Next() {
+		var key [3]string
+		var reason string
+		var count int
+		if err := reasonRows.Scan(&key[0], &key[1], &key[2], &reason, &count); err != nil {
+			continue
+		}
+		if i, ok := index[key]; ok {
+			stats[i].Reasons[reason] = count
+		}
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: stats})
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"testing"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/services"
+)
+
+func TestValidEmoji(t *testing.T) {
+	tests := []struct {
+		emoji string
+		want  bool
+	}{
+		{"❤️", true},
+		{"😂", true},
+		{"👍🏽", true},
+		{"👨‍👩‍👧‍👦", true},
+		{"🇫🇷", true},
+		{"1️⃣", true},
+		{"", false},
+		{"1", false},
+		{"lol", false},
+		{"😂 ", false},
+		{"你好", false},
+		{"😂😂😂😂😂😂😂😂😂", false},
+	}
+
+	for _, tt := range tests {
+		if got := validEmoji(tt.emoji); got != tt.want {
+			t.Errorf("validEmoji(%q) = %v, want %v", tt.emoji, got, tt.want)
+		}
+	}
+}
+
+func TestValidFeedbackReasons(t *testing.T) {
+	tests := []struct {
+		name    string
+		rating  string
+		reasons []string
+		want    bool
+	}{
+		{"No reasons", "up", nil, true},
+		{"Down reasons", "down", []string{"repetitive", "too_long"}, true},
+		{"Reason of the other rating", "up", []string{"repetitive"}, false},
+		{"Repeated", "down", []string{"other", "other"}, false},
+		{"Unknown", "down", []string{"boring"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validFeedbackReasons(tt.rating, tt.reasons); got != tt.want {
+				t.Errorf("validFeedbackReasons(%q, %v) = %v, want %v", tt.rating, tt.reasons, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetReplySource(t *testing.T) {
+	metadata := models.JSONB{}
+	setReplySource(metadata, "claude", "claude-sonnet-4-20250514")
+	if metadata["provider"] != "claude" || metadata["model"] != "claude-sonnet-4-20250514" ||
+		metadata["promptVersion"] != services.PromptVersion {
+		t.Errorf("unexpected metadata %v", metadata)
+	}
+
+	// The simple fallback uses no model or prompt
+	metadata = models.JSONB{}
+	setReplySource(metadata, "fallback", "")
+	if metadata["provider"] != "fallback" || metadata["model"] != nil || metadata["promptVersion"] != nil {
+		t.Errorf("unexpected fallback metadata %v", metadata)
+	}
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/websocket"
+)
+
+var errMessageNotFound = errors.New("message not found")
+
+// Receipt readers
+const (
+	readerUser      = "user"
+	readerCompanion = "companion"
+)
+
+// collectIDs reads the message IDs returned by an UPDATE ... RETURNING id
+func collectIDs(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// broadcastReceipt tells the conversation's clients about a receipt, if it covers any messages
+func (h *Handlers) broadcastReceipt(eventType string, receipt *models.MessageReceipt) {
+	if len(receipt.MessageIDs) > 0 {
+		h.wsHub.BroadcastEvent(receipt.ConversationID, eventType, receipt)
+	}
+}
+
+// markDelivered marks the conversation's undelivered companion messages delivered to the user
+func (h *Handlers) markDelivered(conversationID string) (*models.MessageReceipt, error) {
+	receipt := &models.MessageReceipt{ConversationID: conversationID, Reader: readerUser, At: time.Now()}
+	rows, err := h.db.Query(
+		`UPDATE messages SET delivered_at = $2
+		WHERE conversation_id = $1 AND sender = 'ai' AND delivered_at IS NULL
+		RETURNING id`,
+		conversationID, receipt.At,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.MessageIDs, err = collectIDs(rows); err != nil {
+		return nil, err
+	}
+
+	h.broadcastReceipt(websocket.EventMessageDelivered, receipt)
+	return receipt, nil
+}
+
+// markRead marks the conversation's companion messages read by the user, up to and including
+// upToMessageID or all of them, and moves the user's read marker along
+func (h *Handlers) markRead(userID, conversationID, upToMessageID string) (*models.MessageReceipt, error) {
+	receipt := &models.MessageReceipt{ConversationID: conversationID, Reader: readerUser, At: time.Now()}
+
+	upTo := receipt.At
+	if upToMessageID != "" {
+		err := h.db.QueryRow(
+			`SELECT created_at FROM messages WHERE id = $1 AND conversation_id = $2`,
+			upToMessageID, conversationID,
+		).Scan(&upTo)
+		if err == sql.ErrNoRows {
+			return nil, errMessageNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		`UPDATE messages SET read_at = $3, delivered_at = COALESCE(delivered_at, $3)
+		WHERE conversation_id = $1 AND sender = 'ai' AND read_at IS NULL AND created_at <= $2
+		RETURNING id`,
+		conversationID, upTo, receipt.At,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.MessageIDs, err = collectIDs(rows); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO conversation_reads (user_id, conversation_id, last_read_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, conversation_id) DO UPDATE SET last_read_at = GREATEST(conversation_reads.last_read_at, $3)`,
+		userID, conversationID, upTo,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	h.broadcastReceipt(websocket.EventMessageRead, receipt)
+	return receipt, nil
+}
+
+// companionRead marks the user's messages up to upTo read by the companion, which has replied to them
+func companionRead(tx *sql.Tx, conversationID string, upTo time.Time) (*models.MessageReceipt, error) {
+	receipt := &models.MessageReceipt{ConversationID: conversationID, Reader: readerCompanion, At: time.Now()}
+	rows, err := tx.Query(
+		`UPDATE messages SET read_at = $3, delivered_at = COALESCE(delivered_at, $3)
+		WHERE conversation_id = $1 AND sender = 'user' AND read_at IS NULL AND created_at <= $2
+		RETURNING id`,
+		conversationID, upTo, receipt.At,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if receipt.MessageIDs, err = collectIDs(rows); err != nil {
+		return nil, err
+	}
+	return receipt, nil
+}
+
+// MarkRead marks a conversation's companion messages read, up to messageId if given
+func (h *Handlers) MarkRead(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.MarkReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	conv, ok := h.ownedConversation(c, userID.(string), req.ConversationID)
+	if !ok {
+		return
+	}
+
+	receipt, err := h.markRead(conv.UserID, conv.ID, req.MessageID)
+	if err == errMessageNotFound {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: receipt})
+}
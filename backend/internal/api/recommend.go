@@ -0,0 +1,248 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/services"
+)
+
+// moodHistorySize is how many of the user's latest mood settings shape recommendations
+const moodHistorySize = 50
+
+// maxRecommendNeighbours caps how many users who share companions with the viewer feed
+// collaborative filtering, the ones sharing the most first
+const maxRecommendNeighbours = 1000
+
+// GetRecommendedCompanions ranks companions for the user from their chats, moods and liked tags
+// and from what similar users chat with. New users get trending companions instead.
+func (h *Handlers) GetRecommendedCompanions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+	viewer := userID.(string)
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit < 1 || limit > 50 {
+		limit = 10
+	}
+
+	interactions, err := h.chatInteractions(viewer)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	profile, err := h.recommendProfile(viewer, interactions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	candidates, err := h.recommendCandidates(viewer, interactions, profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	pool := make([]services.RecommendCandidate, 0, len(candidates))
+	byID := make(map[string]models.Companion, len(candidates))
+	for _, comp := range candidates {
+		pool = append(pool, services.RecommendCandidate{ID: comp.ID, Tags: comp.Tags, Personality: comp.PersonalityJSON})
+		byID[comp.ID] = comp
+	}
+
+	recommended := []models.RecommendedCompanion{}
+	seen := make(map[string]bool)
+	for _, rec := range services.NewRecommender().Recommend(profile, interactions, pool, limit) {
+		recommended = append(recommended, models.RecommendedCompanion{
+			Companion: byID[rec.CompanionID],
+			Score:     rec.Score,
+			Reasons:   rec.Reasons,
+		})
+		seen[rec.CompanionID] = true
+	}
+
+	// Cold start, or too few signals: top up with trending companions
+	if len(recommended) < limit {
+		trending, err := h.trendingCompanions(viewer, limit+len(seen))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+		for _, comp := range trending {
+			if len(recommended) == limit {
+				break
+			}
+			if seen[comp.ID] {
+				continue
+			}
+			recommended = append(recommended, models.RecommendedCompanion{Companion: comp, Reasons: []string{services.ReasonTrending}})
+			seen[comp.ID] = true
+		}
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: recommended})
+}
+
+// recommendCandidates loads the companions the user may see, other than their own, that have a
+// signal to be recommended on: someone in the interactions chats with them or they carry one of
+// the user's liked tags. Mood fit alone never recommends a companion, so the rest are left out.
+func (h *Handlers) recommendCandidates(userID string, interactions []services.Interaction, profile services.RecommendProfile) ([]models.Companion, error) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, in := range interactions {
+		if !seen[in.CompanionID] {
+			seen[in.CompanionID] = true
+			ids = append(ids, in.CompanionID)
+		}
+	}
+	tags := make([]string, 0, len(profile.Tags))
+	for tag := range profile.Tags {
+		tags = append(tags, tag)
+	}
+	if len(ids) == 0 && len(tags) == 0 {
+		return nil, nil
+	}
+
+	f := &sqlFilter{}
+	f.addVisibleTo(userID)
+	f.add("created_by IS DISTINCT FROM " + f.arg(userID))
+	f.add("(id = ANY(" + f.arg(pq.Array(ids)) + ") OR EXISTS (SELECT 1 FROM unnest(tags) t WHERE lower(trim(t)) = ANY(" + f.arg(pq.Array(tags)) + ")))")
+
+	rows, err := h.db.Query(`SELECT `+companionColumns+` FROM companions`+f.where(), f.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var companions []models.Companion
+	for rows.Next() {
+		var comp models.Companion
+		if err := scanCompanion(rows, &comp); err != nil {
+			continue
+		}
+		companions = append(companions, comp)
+	}
+	return companions, nil
+}
+
+// chatInteractions counts messages per user and companion, the input to collaborative filtering:
+// the user's own, counted live, and those of the users who chat with the same companions, from
+// the chat_interactions aggregate the stats refresh keeps
+func (h *Handlers) chatInteractions(userID string) ([]services.Interaction, error) {
+	rows, err := h.db.Query(
+		`WITH mine AS (
+			SELECT conv.user_id, conv.companion_id, COUNT(*) AS messages
+			FROM messages m JOIN conversations conv ON conv.id = m.conversation_id
+			WHERE conv.user_id = $1 AND m.sender = 'user' AND m.deleted_at IS NULL
+			GROUP BY conv.user_id, conv.companion_id
+		)
+		SELECT user_id, companion_id, messages FROM mine
+		UNION ALL
+		SELECT i.user_id, i.companion_id, i.messages FROM chat_interactions i
+		WHERE i.user_id IN (
+			SELECT n.user_id FROM chat_interactions n JOIN mine ON mine.companion_id = n.companion_id
+			WHERE n.user_id <> $1
+			GROUP BY n.user_id
+			ORDER BY COUNT(*) DESC, SUM(n.messages) DESC, n.user_id
+			LIMIT $2
+		)`,
+		userID, maxRecommendNeighbours,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var interactions []services.Interaction
+	for rows.Next() {
+		var in services.Interaction
+		if err := rows.Scan(&in.UserID, &in.CompanionID, &in.Weight); err != nil {
+			continue
+		}
+		interactions = append(interactions, in)
+	}
+	return interactions, nil
+}
+
+// recommendProfile gathers the user's mood history and the tags of the companions they chat with and favorite
+func (h *Handlers) recommendProfile(userID string, interactions []services.Interaction) (services.RecommendProfile, error) {
+	profile := services.RecommendProfile{
+		UserID: userID,
+		Moods:  make(map[string]float64),
+		Tags:   make(map[string]float64),
+	}
+
+	rows, err := h.db.Query(
+		`SELECT mood_type, COUNT(*) FROM (
+			SELECT mood_type FROM moods WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2
+		) recent GROUP BY mood_type`,
+		userID, moodHistorySize,
+	)
+	if err != nil {
+		return profile, err
+	}
+	var total float64
+	for rows.Next() {
+		var mood string
+		var count float64
+		if err := rows.Scan(&mood, &count); err == nil {
+			profile.Moods[mood] = count
+			total += count
+		}
+	}
+	rows.Close()
+	for mood := range profile.Moods {
+		profile.Moods[mood] /= total
+	}
+
+	like := func(tags []string, weight float64) {
+		for _, tag := range tags {
+			profile.Tags[strings.ToLower(strings.TrimSpace(tag))] += weight
+		}
+	}
+
+	var chatted []string
+	for _, in := range interactions {
+		if in.UserID == userID {
+			chatted = append(chatted, in.CompanionID)
+		}
+	}
+	if len(chatted) > 0 {
+		rows, err = h.db.Query(`SELECT tags FROM companions WHERE id = ANY($1)`, pq.Array(chatted))
+		if err != nil {
+			return profile, err
+		}
+		for rows.Next() {
+			var tags []string
+			if err := rows.Scan(pq.Array(&tags)); err == nil {
+				like(tags, 1)
+			}
+		}
+		rows.Close()
+	}
+
+	// Favorites are an explicit signal, so their tags count double
+	rows, err = h.db.Query(
+		`SELECT comp.tags FROM favorites f JOIN companions comp ON comp.id = f.companion_id WHERE f.user_id = $1`,
+		userID,
+	)
+	if err != nil {
+		return profile, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tags []string
+		if err := rows.Scan(pq.Array(&tags)); err == nil {
+			like(tags, 2)
+		}
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,446 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/services"
+	"nectar-ai-companion/internal/websocket"
+)
+
+// companionColumns lists the companion columns read by scanCompanion
+const companionColumns = `id, name, category, bio, avatar_url, personality_json, tags, age, status,
+	COALESCE(style, 'realistic'), scenario, greeting, COALESCE(appearance_json, '{}'),
+	interests, COALESCE(communication_style, 'friendly'), gallery_urls,
+	COALESCE(is_featured, false), COALESCE(message_count, 0), COALESCE(rating_average, 0), COALESCE(rating_count, 0),
+	COALESCE(voice_json, '{}'), COALESCE(card_extensions, '{}'),
+	created_by, COALESCE(visibility, 'public'), created_at, updated_at`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanCompanion scans a row selected with companionColumns, followed by any extra columns
+func scanCompanion(row rowScanner, comp *models.Companion, extra ...interface{}) error {
+	dest := []interface{}{
+		&comp.ID, &comp.Name, &comp.Category, &comp.Bio,
+		&comp.AvatarURL, &comp.PersonalityJSON, pq.Array(&comp.Tags),
+		&comp.Age, &comp.Status, &comp.Style, &comp.Scenario, &comp.Greeting,
+		&comp.AppearanceJSON, pq.Array(&comp.Interests), &comp.CommunicationStyle,
+		pq.Array(&comp.GalleryURLs), &comp.IsFeatured, &comp.MessageCount, &comp.RatingAverage, &comp.RatingCount, &comp.VoiceJSON, &comp.CardExtensions,
+		&comp.CreatedBy, &comp.Visibility, &comp.CreatedAt, &comp.UpdatedAt,
+	}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// loadCompanion fetches a companion by ID, returning sql.ErrNoRows if it does not exist
+func (h *Handlers) loadCompanion(id string) (*models.Companion, error) {
+	var comp models.Companion
+	row := h.db.QueryRow(`SELECT `+companionColumns+` FROM companions WHERE id = $1`, id)
+	if err := scanCompanion(row, &comp); err != nil {
+		return nil, err
+	}
+	return &comp, nil
+}
+
+// companionContext builds the prompt context for a companion
+func companionContext(comp *models.Companion) services.CompanionContext {
+	ctx := services.CompanionContext{
+		Name:               comp.Name,
+		Age:                comp.Age,
+		Bio:                comp.Bio,
+		Personality:        comp.PersonalityJSON,
+		Tags:               comp.Tags,
+		CommunicationStyle: comp.CommunicationStyle,
+		Interests:          comp.Interests,
+	}
+	if comp.Scenario != nil {
+		ctx.Scenario = *comp.Scenario
+	}
+	if comp.Greeting != nil {
+		ctx.Greeting = *comp.Greeting
+	}
+	return ctx
+}
+
+// generateReply asks Claude, then Groq, for a reply and returns the provider that answered.
+// An empty reply means every configured provider failed; lastErr holds the last failure.
+func (h *Handlers) generateReply(companionCtx services.CompanionContext, messages []services.ClaudeMessage, mood string) (reply string, provider string, lastErr error) {
+	if h.claudeService.IsConfigured() {
+		response, err := h.claudeService.GenerateResponse(companionCtx, messages, mood)
+		if err == nil {
+			return response, "claude", nil
+		}
+		lastErr = err
+	}
+
+	if h.groqService.IsConfigured() {
+		// Groq text models cannot see photos, so describe them first
+		h.captionImages(messages)
+		response, err := h.groqService.GenerateResponse(companionCtx, messages, mood)
+		if err == nil {
+			return response, "groq", nil
+		}
+		lastErr = err
+	}
+
+	return "", "", lastErr
+}
+
+// replyModel names the model a reply provider answers with
+func (h *Handlers) replyModel(provider string) string {
+	switch provider {
+	case "claude":
+		return h.claudeService.Model()
+	case "groq":
+		return h.groqService.Model()
+	}
+	return ""
+}
+
+// setReplySource records in an AI message's metadata which provider, model and prompt
+// version produced it, so feedback on the message can be attributed to them
+func setReplySource(metadata models.JSONB, provider, model string) {
+	metadata["provider"] = provider
+	if model != "" {
+		metadata["model"] = model
+		metadata["promptVersion"] = services.PromptVersion
+	}
+}
+
+// captionImages fills in text captions for photos so non-vision providers can react to them
+func (h *Handlers) captionImages(messages []services.ClaudeMessage) {
+	for i := range messages {
+		for j := range messages[i].Images {
+			img := &messages[i].Images[j]
+			if img.Caption != "" || !h.huggingFaceService.IsConfigured() {
+				continue
+			}
+			if caption, err := h.huggingFaceService.CaptionImage(img.Data, img.MediaType); err == nil {
+				img.Caption = caption
+			}
+		}
+	}
+}
+
+// companionAppearance extracts the visual traits used for image prompts
+func companionAppearance(comp *models.Companion) services.CompanionAppearance {
+	appearance := services.CompanionAppearance{
+		Name:   comp.Name,
+		Age:    comp.Age,
+		Gender: "woman", // Default
+	}
+
+	if comp.AppearanceJSON != nil {
+		if gender, ok := comp.AppearanceJSON["gender"].(string); ok {
+			appearance.Gender = gender
+		}
+		if ethnicity, ok := comp.AppearanceJSON["ethnicity"].(string); ok {
+			appearance.Ethnicity = ethnicity
+		}
+		if hairColor, ok := comp.AppearanceJSON["hairColor"].(string); ok {
+			appearance.HairColor = hairColor
+		}
+		if hairStyle, ok := comp.AppearanceJSON["hairStyle"].(string); ok {
+			appearance.HairStyle = hairStyle
+		}
+		if eyeColor, ok := comp.AppearanceJSON["eyeColor"].(string); ok {
+			appearance.EyeColor = eyeColor
+		}
+		if bodyType, ok := comp.AppearanceJSON["bodyType"].(string); ok {
+			appearance.BodyType = bodyType
+		}
+		if style, ok := comp.AppearanceJSON["style"].(string); ok {
+			appearance.Style = style
+		}
+	}
+
+	return appearance
+}
+
+// imageGenerationConfigured reports whether any image provider is available
+func (h *Handlers) imageGenerationConfigured() bool {
+	return h.huggingFaceService.IsConfigured() || h.falService.IsConfigured()
+}
+
+// generatePhoto runs the image pipeline for a companion, trying Hugging Face first and FAL.ai second
+func (h *Handlers) generatePhoto(comp *models.Companion, context string, photoType string) (imageURL string, provider string, err error) {
+	appearance := companionAppearance(comp)
+
+	// Try Hugging Face first (free)
+	if h.huggingFaceService.IsConfigured() {
+		url, hfErr := h.huggingFaceService.GenerateCompanionPhoto(appearance, context, photoType)
+		if hfErr == nil {
+			return url, "huggingface", nil
+		}
+		err = hfErr
+	}
+
+	// Fall back to FAL.ai if Hugging Face failed or not configured
+	if h.falService.IsConfigured() {
+		url, falErr := h.falService.GenerateCompanionPhoto(appearance, context, photoType)
+		if falErr == nil {
+			return url, "fal", nil
+		}
+		err = falErr
+	}
+
+	if err == nil {
+		err = fmt.Errorf("image generation service not configured")
+	}
+	return "", "", err
+}
+
+// generatePhotoReply turns a [Photo] reply into a caption plus the URL of a generated image,
+// as the image pipeline returned it. Replies without the marker are returned unchanged; if
+// generation fails the description is kept as text so the user still gets the photo in words.
+// fallback is that text, for callers that fail to use the image.
+func (h *Handlers) generatePhotoReply(comp *models.Companion, reply string) (content, imageURL, fallback string) {
+	parsed, ok := services.ParsePhotoReply(reply)
+	if !ok {
+		return reply, "", reply
+	}
+
+	url, _, err := h.generatePhoto(comp, parsed.Description, "selfie")
+	if err != nil {
+		return parsed.FallbackText(), "", parsed.FallbackText()
+	}
+	return parsed.Caption, url, parsed.FallbackText()
+}
+
+// resolvePhotoReply turns a [Photo] reply into a caption plus a generated image attachment,
+// falling back to the description as text if the image cannot be generated or stored
+func (h *Handlers) resolvePhotoReply(comp *models.Companion, reply string) (content string, photo *models.Attachment) {
+	content, imageURL, fallback := h.generatePhotoReply(comp, reply)
+	if imageURL == "" {
+		return content, nil
+	}
+
+	photo, err := h.storeGeneratedImage(imageURL)
+	if err != nil {
+		return fallback, nil
+	}
+	return content, photo
+}
+
+// photoPlaceholder stands in for the text of image-only messages in the prompt history
+const photoPlaceholder = "*sends a photo*"
+
+// maxPromptImages caps how many of the user's recent photos are sent to vision models
+const maxPromptImages = 3
+
+// promptHistory loads the last messages of the branch ending at leafID as prompt messages,
+// skipping deleted ones. The user's most recent photos are included as image blocks.
+func (h *Handlers) promptHistory(leafID string) ([]services.ClaudeMessage, error) {
+	if leafID == "" {
+		return nil, nil
+	}
+
+	rows, err := h.db.Query(
+		messagePathCTE+`
+		SELECT id, sender, content FROM path
+		WHERE deleted_at IS NULL
+		ORDER BY depth ASC LIMIT 10`,
+		leafID, maxPromptPathDepth,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []services.ClaudeMessage
+	var ids []string
+	for rows.Next() {
+		var id, sender, content string
+		if err := rows.Scan(&id, &sender, &content); err != nil {
+			continue
+		}
+		role := "user"
+		if sender == "ai" {
+			role = "assistant"
+		}
+		messages = append([]services.ClaudeMessage{{Role: role, Content: content}}, messages...)
+		ids = append([]string{id}, ids...)
+	}
+
+	attachments, err := h.loadAttachments(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk backwards so the newest photos win the image budget
+	imageBudget := maxPromptImages
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			for _, att := range attachments[ids[i]] {
+				if imageBudget == 0 {
+					break
+				}
+				if img, err := h.promptImage(att); err == nil {
+					messages[i].Images = append(messages[i].Images, *img)
+					imageBudget--
+				}
+			}
+		}
+		if strings.TrimSpace(messages[i].Content) == "" && len(messages[i].Images) == 0 {
+			messages[i].Content = photoPlaceholder
+		}
+	}
+
+	return messages, nil
+}
+
+// companionReply is a generated companion reply that has not been stored yet
+type companionReply struct {
+	comp     *models.Companion // Nil if the companion could not be loaded
+	content  string
+	photo    *models.Attachment
+	metadata models.JSONB
+	// What the system prompt was built from; nil if no model produced the reply
+	promptContext *services.ReplyPromptContext
+}
+
+// promptContextJSON encodes a reply's prompt context for the messages.prompt_context column
+func (r *companionReply) promptContextJSON() ([]byte, error) {
+	if r.promptContext == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(r.promptContext)
+}
+
+// composeReply generates the companion's reply to the branch ending at leafID. prompt is the
+// user message being answered; it drives knowledge retrieval and the simple fallback.
+func (h *Handlers) composeReply(userID, companionID, conversationID, leafID, prompt string) *companionReply {
+	// Get user's current mood
+	var mood string
+	h.db.QueryRow(
+		`SELECT mood_type FROM moods WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1`,
+		userID,
+	).Scan(&mood)
+	if mood == "" {
+		mood = "romantic"
+	}
+
+	reply := &companionReply{metadata: models.JSONB{}}
+	var citations []models.KnowledgeCitation
+	var provider string
+
+	// Fetch companion data, as pinned by the conversation
+	comp, err := h.conversationCompanion(conversationID, companionID)
+	if err == nil {
+		reply.comp = comp
+		messages, err := h.promptHistory(leafID)
+		if err == nil {
+			companionCtx := companionContext(comp)
+			companionCtx.User = h.conversationPersona(conversationID, userID)
+			companionCtx.Lore = h.companionLore(comp.ID, messages)
+			companionCtx.Knowledge, citations = h.companionKnowledge(comp.ID, prompt)
+			// Generate response with Claude
+			if h.claudeService.IsConfigured() {
+				if response, err := h.claudeService.GenerateResponse(companionCtx, messages, mood); err == nil {
+					reply.content, provider = response, "claude"
+				}
+			}
+			if reply.content != "" {
+				reply.promptContext = &services.ReplyPromptContext{
+					Mood:      mood,
+					Lore:      companionCtx.Lore,
+					Knowledge: companionCtx.Knowledge,
+					User:      companionCtx.User,
+				}
+			}
+		}
+	}
+
+	// Fallback to simple AI if Claude failed or is not configured
+	if reply.content == "" {
+		reply.content = h.aiService.GenerateReply([]string{prompt}, mood)
+		provider = "fallback"
+	}
+	setReplySource(reply.metadata, provider, h.replyModel(provider))
+
+	// Turn [Photo] replies into a generated image
+	if comp != nil {
+		reply.content, reply.photo = h.resolvePhotoReply(comp, reply.content)
+	}
+
+	if len(citations) > 0 {
+		reply.metadata["citations"] = citations
+	}
+	return reply
+}
+
+// replyToMessage runs the reply pipeline for a saved user message: it builds the
+// prompt from recent history, generates the companion's reply, resolves photos,
+// optionally renders it as a voice note, saves the AI message as the next message
+// on the user message's branch and broadcasts it to the conversation.
+func (h *Handlers) replyToMessage(userID string, companionID string, userMsg *models.Message, voice bool) (*models.Message, error) {
+	reply := h.composeReply(userID, companionID, userMsg.ConversationID, userMsg.ID, userMsg.Content)
+	comp, photo := reply.comp, reply.photo
+
+	aiMsg := &models.Message{
+		ID:             uuid.New().String(),
+		ConversationID: userMsg.ConversationID,
+		ParentID:       &userMsg.ID,
+		Sender:         "ai",
+		Content:        reply.content,
+		Metadata:       reply.metadata,
+		CreatedAt:      time.Now(),
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := insertMessage(tx, aiMsg); err != nil {
+		return nil, err
+	}
+	promptContext, err := reply.promptContextJSON()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE messages SET prompt_context = $2 WHERE id = $1`, aiMsg.ID, promptContext); err != nil {
+		return nil, err
+	}
+
+	if photo != nil {
+		photo.MessageID = &aiMsg.ID
+		if err := insertAttachment(tx, photo); err != nil {
+			return nil, err
+		}
+		setAttachments(aiMsg, []models.Attachment{*photo})
+	}
+
+	// Replying reads the user's messages
+	receipt, err := companionRead(tx, userMsg.ConversationID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	userMsg.ReadAt = &receipt.At
+	h.broadcastReceipt(websocket.EventMessageRead, receipt)
+
+	// Attach a voice note; the text reply stands on its own if synthesis fails
+	if voice && comp != nil {
+		if note, err := h.renderVoiceNote(comp, aiMsg); err == nil {
+			setAttachments(aiMsg, append(aiMsg.Attachments, *note))
+		}
+	}
+
+	// Broadcast to WebSocket clients
+	h.wsHub.BroadcastToConversation(aiMsg.ConversationID, aiMsg)
+
+	return aiMsg, nil
+}
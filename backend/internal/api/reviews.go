@@ -0,0 +1,397 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"nectar-ai-companion/internal/models"
+)
+
+// reviewAutoHideReports is how many unresolved reports hide a review until an admin looks at it
+const reviewAutoHideReports = 3
+
+// reviewColumns lists the review columns read by scanReview; queries alias reviews as r and join users as u
+const reviewColumns = `r.id, r.companion_id, r.user_id, COALESCE(u.username, ''), r.rating, r.body, r.status,
+	(SELECT COUNT(*) FROM review_reports rr WHERE rr.review_id = r.id AND rr.resolved_at IS NULL), r.created_at, r.updated_at`
+
+// scanReview scans a row selected with reviewColumns
+func scanReview(row rowScanner, r *models.Review) error {
+	return row.Scan(&r.ID, &r.CompanionID, &r.UserID, &r.Username, &r.Rating, &r.Body, &r.Status,
+		&r.ReportCount, &r.CreatedAt, &r.UpdatedAt)
+}
+
+// refreshRatings recomputes a companion's rating aggregates from its visible reviews
+func refreshRatings(db dbExecer, companionID string) error {
+	_, err := db.Exec(
+		`UPDATE companions SET
+			rating_average = COALESCE((SELECT AVG(rating) FROM reviews WHERE companion_id = $1 AND status = 'visible'), 0),
+			rating_count = (SELECT COUNT(*) FROM reviews WHERE companion_id = $1 AND status = 'visible')
+		WHERE id = $1`,
+		companionID,
+	)
+	return err
+}
+
+// viewableCompanion loads the companion in the :id param if the viewer may see it.
+// It writes the error response and returns nil if not.
+func (h *Handlers) viewableCompanion(c *gin.Context) *models.Companion {
+	comp, err := h.loadCompanion(c.Param("id"))
+	if err == sql.ErrNoRows || (err == nil && !h.canViewCompanion(viewerID(c), comp)) {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "companion not found"})
+		return nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return nil
+	}
+	return comp
+}
+
+// isFavorite reports whether a user has favorited a companion
+func (h *Handlers) isFavorite(userID, companionID string) (bool, error) {
+	var favorite bool
+	err := h.db.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM favorites WHERE user_id = $1 AND companion_id = $2)`,
+		userID, companionID,
+	).Scan(&favorite)
+	return favorite, err
+}
+
+// FavoriteCompanion adds a companion to the user's favorites
+func (h *Handlers) FavoriteCompanion(c *gin.Context) {
+	comp := h.viewableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	_, err := h.db.Exec(
+		`INSERT INTO favorites (user_id, companion_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		viewerID(c), comp.ID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "added to favorites"})
+}
+
+// UnfavoriteCompanion removes a companion from the user's favorites
+func (h *Handlers) UnfavoriteCompanion(c *gin.Context) {
+	_, err := h.db.Exec(
+		`DELETE FROM favorites WHERE user_id = $1 AND companion_id = $2`,
+		viewerID(c), c.Param("id"),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "removed from favorites"})
+}
+
+// ListFavorites lists the user's favorite companions, most recently added first
+func (h *Handlers) ListFavorites(c *gin.Context) {
+	viewer := viewerID(c)
+	f := &sqlFilter{}
+	userArg := f.arg(viewer)
+	f.addVisibleTo(viewer)
+
+	rows, err := h.db.Query(
+		`SELECT `+companionColumns+` FROM companions
+		JOIN (SELECT companion_id, created_at AS favorited_at FROM favorites WHERE user_id = `+userArg+`) fav
+			ON fav.companion_id = companions.id`+f.where()+`
+		ORDER BY fav.favorited_at DESC`,
+		f.args...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	favorite := true
+	companions := []models.Companion{}
+	for rows.Next() {
+		var comp models.Companion
+		if err := scanCompanion(rows, &comp); err != nil {
+			continue
+		}
+		comp.IsFavorite = &favorite
+		companions = append(companions, comp)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: companions})
+}
+
+// ListReviews lists a companion's visible reviews, newest first
+func (h *Handlers) ListReviews(c *gin.Context) {
+	comp := h.viewableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var total int
+	h.db.QueryRow(`SELECT COUNT(*) FROM reviews WHERE companion_id = $1 AND status = 'visible'`, comp.ID).Scan(&total)
+
+	rows, err := h.db.Query(
+		`SELECT `+reviewColumns+` FROM reviews r LEFT JOIN users u ON u.id = r.user_id
+		WHERE r.companion_id = $1 AND r.status = 'visible'
+		ORDER BY r.created_at DESC, r.id ASC
+		LIMIT $2 OFFSET $3`,
+		comp.ID, pageSize, (page-1)*pageSize,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	reviews := []models.Review{}
+	for rows.Next() {
+		var r models.Review
+		if err := scanReview(rows, &r); err != nil {
+			continue
+		}
+		reviews = append(reviews, r)
+	}
+
+	c.JSON(http.StatusOK, models.PaginatedResponse{
+		Data:       reviews,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: (total + pageSize - 1) / pageSize,
+	})
+}
+
+// ReviewCompanion creates or replaces the user's rating and review of a companion
+func (h *Handlers) ReviewCompanion(c *gin.Context) {
+	var req models.ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	comp := h.viewableCompanion(c)
+	if comp == nil {
+		return
+	}
+	userID := viewerID(c)
+	if comp.CreatedBy != nil && *comp.CreatedBy == userID {
+		c.JSON(http.StatusForbidden, models.APIResponse{Error: "you cannot review your own companion"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// An edited review keeps its moderation status
+	var reviewID string
+	err = tx.QueryRow(
+		`INSERT INTO reviews (companion_id, user_id, rating, body) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (companion_id, user_id) DO UPDATE SET rating = EXCLUDED.rating, body = EXCLUDED.body, updated_at = $5
+		RETURNING id`,
+		comp.ID, userID, req.Rating, req.Body, time.Now(),
+	).Scan(&reviewID)
+	if err == nil {
+		err = refreshRatings(tx, comp.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	var review models.Review
+	row := h.db.QueryRow(`SELECT `+reviewColumns+` FROM reviews r LEFT JOIN users u ON u.id = r.user_id WHERE r.id = $1`, reviewID)
+	if err := scanReview(row, &review); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: review})
+}
+
+// DeleteReview removes the user's review of a companion
+func (h *Handlers) DeleteReview(c *gin.Context) {
+	companionID := c.Param("id")
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM reviews WHERE companion_id = $1 AND user_id = $2`, companionID, viewerID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "review not found"})
+		return
+	}
+	if err := refreshRatings(tx, companionID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "review deleted"})
+}
+
+// ReportReview flags a review for moderation; enough reports hide it automatically
+func (h *Handlers) ReportReview(c *gin.Context) {
+	var req models.ReportReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	var companionID, authorID string
+	err := h.db.QueryRow(`SELECT companion_id, user_id FROM reviews WHERE id = $1`, c.Param("id")).Scan(&companionID, &authorID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "review not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	userID := viewerID(c)
+	if authorID == userID {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "you cannot report your own review"})
+		return
+	}
+
+	_, err = h.db.Exec(
+		`INSERT INTO review_reports (review_id, user_id, reason) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+		c.Param("id"), userID, req.Reason,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	// Reports an admin already resolved stay in place, so earlier reporters cannot report again
+	var reports int
+	h.db.QueryRow(
+		`SELECT COUNT(*) FROM review_reports WHERE review_id = $1 AND resolved_at IS NULL`, c.Param("id"),
+	).Scan(&reports)
+	if reports >= reviewAutoHideReports {
+		if err := h.setReviewStatus(c.Param("id"), companionID, "hidden", false); err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "review reported"})
+}
+
+// setReviewStatus shows or hides a review and refreshes the companion's rating. resolveReports marks
+// the review's open reports as handled by an admin.
+func (h *Handlers) setReviewStatus(reviewID, companionID, status string, resolveReports bool) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE reviews SET status = $2 WHERE id = $1`, reviewID, status); err != nil {
+		return err
+	}
+	if resolveReports {
+		_, err := tx.Exec(
+			`UPDATE review_reports SET resolved_at = CURRENT_TIMESTAMP WHERE review_id = $1 AND resolved_at IS NULL`,
+			reviewID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if err := refreshRatings(tx, companionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// moderateReview handles admin hide and unhide requests, resolving the review's reports
+func (h *Handlers) moderateReview(c *gin.Context, status string) {
+	var companionID string
+	err := h.db.QueryRow(`SELECT companion_id FROM reviews WHERE id = $1`, c.Param("id")).Scan(&companionID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "review not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.setReviewStatus(c.Param("id"), companionID, status, true); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "review " + status})
+}
+
+// HideReview hides a review from listings and the rating (admin)
+func (h *Handlers) HideReview(c *gin.Context) {
+	h.moderateReview(c, "hidden")
+}
+
+// UnhideReview restores a hidden review (admin)
+func (h *Handlers) UnhideReview(c *gin.Context) {
+	h.moderateReview(c, "visible")
+}
+
+// ListReportedReviews lists reviews with unresolved reports, most reported first (admin)
+func (h *Handlers) ListReportedReviews(c *gin.Context) {
+	rows, err := h.db.Query(
+		`SELECT ` + reviewColumns + ` FROM reviews r LEFT JOIN users u ON u.id = r.user_id
+		WHERE EXISTS (SELECT 1 FROM review_reports rr WHERE rr.review_id = r.id AND rr.resolved_at IS NULL)
+		ORDER BY (SELECT COUNT(*) FROM review_reports rr WHERE rr.review_id = r.id AND rr.resolved_at IS NULL) DESC, r.created_at DESC
+		LIMIT 100`,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	reviews := []models.Review{}
+	for rows.Next() {
+		var r models.Review
+		if err := scanReview(rows, &r); err != nil {
+			continue
+		}
+		reviews = append(reviews, r)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: reviews})
+}
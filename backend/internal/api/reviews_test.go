@@ -0,0 +1,42 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+
+	"nectar-ai-companion/internal/models"
+)
+
+func TestReviewRequestValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     models.ReviewRequest
+		wantErr bool
+	}{
+		{"one star", models.ReviewRequest{Rating: 1}, false},
+		{"five stars with text", models.ReviewRequest{Rating: 5, Body: "Lovely to talk to"}, false},
+		{"missing rating", models.ReviewRequest{Body: "No stars"}, true},
+		{"six stars", models.ReviewRequest{Rating: 6}, true},
+		{"negative", models.ReviewRequest{Rating: -1}, true},
+		{"too long", models.ReviewRequest{Rating: 3, Body: strings.Repeat("a", 4001)}, true},
+	}
+
+	for _, tt := range tests {
+		err := binding.Validator.ValidateStruct(&tt.req)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: ValidateStruct error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRatingSortOrder(t *testing.T) {
+	s, err := searchFromURL(t, "/api/companions/search?sort=rating")
+	if err != nil {
+		t.Fatalf("parseCompanionSearch returned error: %v", err)
+	}
+	if order := s.orderBy(&sqlFilter{}); !strings.HasPrefix(order, " ORDER BY COALESCE(rating_average, 0) DESC") {
+		t.Errorf("unexpected order %q", order)
+	}
+}
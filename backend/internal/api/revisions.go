@@ -0,0 +1,326 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nectar-ai-companion/internal/models"
+)
+
+// snapshotFields orders the fields in revision diffs
+var snapshotFields = []string{
+	"name", "category", "bio", "avatarUrl", "personality", "tags", "age",
+	"scenario", "greeting", "communicationStyle", "interests", "appearance", "voice",
+}
+
+// snapshotCompanion captures a companion's persona for a revision
+func snapshotCompanion(comp *models.Companion) (models.JSONB, error) {
+	raw, err := json.Marshal(models.CompanionSnapshot{
+		Name:               comp.Name,
+		Category:           comp.Category,
+		Bio:                comp.Bio,
+		AvatarURL:          comp.AvatarURL,
+		Personality:        comp.PersonalityJSON,
+		Tags:               comp.Tags,
+		Age:                comp.Age,
+		Scenario:           comp.Scenario,
+		Greeting:           comp.Greeting,
+		CommunicationStyle: comp.CommunicationStyle,
+		Interests:          comp.Interests,
+		Appearance:         comp.AppearanceJSON,
+		Voice:              comp.VoiceJSON,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot models.JSONB
+	if err := json.Unmarshal(raw, &snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// applySnapshot restores the persona stored in a revision onto a companion
+func applySnapshot(comp *models.Companion, snapshot models.JSONB) error {
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	var s models.CompanionSnapshot
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return err
+	}
+
+	comp.Name = s.Name
+	comp.Category = s.Category
+	comp.Bio = s.Bio
+	comp.AvatarURL = s.AvatarURL
+	comp.PersonalityJSON = s.Personality
+	comp.Tags = s.Tags
+	comp.Age = s.Age
+	comp.Scenario = s.Scenario
+	comp.Greeting = s.Greeting
+	comp.CommunicationStyle = s.CommunicationStyle
+	comp.Interests = s.Interests
+	comp.AppearanceJSON = s.Appearance
+	comp.VoiceJSON = s.Voice
+	return nil
+}
+
+// diffSnapshots lists the fields that differ between two revisions
+func diffSnapshots(from, to models.JSONB) []models.RevisionChange {
+	fields := append([]string{}, snapshotFields...)
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f] = true
+	}
+
+	// Fields from older or newer snapshot shapes go last, sorted
+	var extra []string
+	for _, snapshot := range []models.JSONB{from, to} {
+		for key := range snapshot {
+			if !known[key] {
+				known[key] = true
+				extra = append(extra, key)
+			}
+		}
+	}
+	sort.Strings(extra)
+	fields = append(fields, extra...)
+
+	changes := []models.RevisionChange{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(from[field], to[field]) {
+			changes = append(changes, models.RevisionChange{Field: field, From: from[field], To: to[field]})
+		}
+	}
+	return changes
+}
+
+// insertRevision snapshots a companion as its next revision. The companion row is locked first so
+// concurrent saves number their revisions one after the other.
+func insertRevision(tx *sql.Tx, comp *models.Companion, editedBy *string) (*models.CompanionRevision, error) {
+	snapshot, err := snapshotCompanion(comp)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`SELECT 1 FROM companions WHERE id = $1 FOR UPDATE`, comp.ID); err != nil {
+		return nil, err
+	}
+
+	rev := &models.CompanionRevision{
+		ID:          uuid.New().String(),
+		CompanionID: comp.ID,
+		Snapshot:    snapshot,
+		EditedBy:    editedBy,
+	}
+	err = tx.QueryRow(
+		`INSERT INTO companion_revisions (id, companion_id, revision, snapshot, edited_by)
+		SELECT $1, $2, COALESCE(MAX(revision), 0) + 1, $3, $4 FROM companion_revisions WHERE companion_id = $2
+		RETURNING revision, created_at`,
+		rev.ID, rev.CompanionID, rev.Snapshot, rev.EditedBy,
+	).Scan(&rev.Revision, &rev.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+// loadRevision fetches one revision of a companion, returning sql.ErrNoRows if it does not exist
+func (h *Handlers) loadRevision(companionID string, revision int) (*models.CompanionRevision, error) {
+	var rev models.CompanionRevision
+	err := h.db.QueryRow(
+		`SELECT id, companion_id, revision, snapshot, edited_by, created_at
+		FROM companion_revisions WHERE companion_id = $1 AND revision = $2`,
+		companionID, revision,
+	).Scan(&rev.ID, &rev.CompanionID, &rev.Revision, &rev.Snapshot, &rev.EditedBy, &rev.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// conversationCompanion loads a conversation's companion with the persona of the revision it is pinned to
+func (h *Handlers) conversationCompanion(conversationID string, companionID string) (*models.Companion, error) {
+	comp, err := h.loadCompanion(companionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot models.JSONB
+	err = h.db.QueryRow(
+		`SELECT r.snapshot FROM conversations conv
+		JOIN companion_revisions r ON r.id = conv.companion_revision_id
+		WHERE conv.id = $1`,
+		conversationID,
+	).Scan(&snapshot)
+	if err == sql.ErrNoRows {
+		return comp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applySnapshot(comp, snapshot); err != nil {
+		return nil, err
+	}
+	return comp, nil
+}
+
+// ListCompanionRevisions lists a companion's revisions, newest first
+func (h *Handlers) ListCompanionRevisions(c *gin.Context) {
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	rows, err := h.db.Query(
+		`SELECT id, companion_id, revision, snapshot, edited_by, created_at
+		FROM companion_revisions WHERE companion_id = $1
+		ORDER BY revision DESC`,
+		comp.ID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	revisions := []models.CompanionRevision{}
+	for rows.Next() {
+		var rev models.CompanionRevision
+		if err := rows.Scan(&rev.ID, &rev.CompanionID, &rev.Revision, &rev.Snapshot, &rev.EditedBy, &rev.CreatedAt); err != nil {
+			continue
+		}
+		revisions = append(revisions, rev)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: revisions})
+}
+
+// DiffCompanionRevisions compares two revisions (from defaults to the one before to, to defaults to the latest)
+func (h *Handlers) DiffCompanionRevisions(c *gin.Context) {
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	to, _ := strconv.Atoi(c.Query("to"))
+	if to == 0 {
+		h.db.QueryRow(`SELECT COALESCE(MAX(revision), 0) FROM companion_revisions WHERE companion_id = $1`, comp.ID).Scan(&to)
+	}
+	from, _ := strconv.Atoi(c.Query("from"))
+	if from == 0 {
+		from = to - 1
+	}
+
+	fromRev, err := h.loadRevision(comp.ID, from)
+	if err == nil {
+		var toRev *models.CompanionRevision
+		toRev, err = h.loadRevision(comp.ID, to)
+		if err == nil {
+			c.JSON(http.StatusOK, models.APIResponse{Data: gin.H{
+				"from":    fromRev.Revision,
+				"to":      toRev.Revision,
+				"changes": diffSnapshots(fromRev.Snapshot, toRev.Snapshot),
+			}})
+			return
+		}
+	}
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "revision not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+}
+
+// RollbackCompanion restores a revision's persona, saved as a new revision
+func (h *Handlers) RollbackCompanion(c *gin.Context) {
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "invalid revision"})
+		return
+	}
+
+	comp := h.manageableCompanion(c)
+	if comp == nil {
+		return
+	}
+
+	rev, err := h.loadRevision(comp.ID, revision)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "revision not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	if err := applySnapshot(comp, rev.Snapshot); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if err := h.saveCompanion(comp, viewerID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: comp})
+}
+
+// PinConversationRevision pins one of the user's conversations to a companion revision, or unpins it with revision 0
+func (h *Handlers) PinConversationRevision(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req models.PinRevisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	conv, ok := h.ownedConversation(c, userID.(string), c.Param("id"))
+	if !ok {
+		return
+	}
+	conv.CompanionRevisionID = nil
+
+	if req.Revision > 0 {
+		rev, err := h.loadRevision(conv.CompanionID, req.Revision)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.APIResponse{Error: "revision not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return
+		}
+		conv.CompanionRevisionID = &rev.ID
+	}
+
+	_, err := h.db.Exec(
+		`UPDATE conversations SET companion_revision_id = $2 WHERE id = $1`,
+		conv.ID, conv.CompanionRevisionID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: conv})
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"testing"
+
+	"nectar-ai-companion/internal/models"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	scenario := "Coffee shop meet-cute"
+	comp := &models.Companion{
+		Name:               "Mia",
+		Category:           "girls",
+		Bio:                "Artist",
+		Age:                24,
+		Tags:               []string{"Creative"},
+		Scenario:           &scenario,
+		PersonalityJSON:    models.JSONB{"humor": float64(70)},
+		CommunicationStyle: "playful",
+	}
+
+	snapshot, err := snapshotCompanion(comp)
+	if err != nil {
+		t.Fatalf("snapshotCompanion returned error: %v", err)
+	}
+
+	edited := *comp
+	edited.Bio = "Sculptor"
+	edited.Scenario = nil
+	edited.Tags = []string{"Bold"}
+	if err := applySnapshot(&edited, snapshot); err != nil {
+		t.Fatalf("applySnapshot returned error: %v", err)
+	}
+
+	if edited.Bio != "Artist" || edited.Scenario == nil || *edited.Scenario != scenario || edited.Tags[0] != "Creative" {
+		t.Errorf("snapshot not restored: %+v", edited)
+	}
+	if edited.PersonalityJSON["humor"] != float64(70) {
+		t.Errorf("personality not restored: %v", edited.PersonalityJSON)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	from := models.JSONB{"name": "Mia", "bio": "Artist", "tags": []interface{}{"Creative"}, "age": float64(24)}
+	to := models.JSONB{"name": "Mia", "bio": "Sculptor", "tags": []interface{}{"Creative", "Bold"}, "age": float64(24), "mood": "sunny"}
+
+	changes := diffSnapshots(from, to)
+	if len(changes) != 3 {
+		t.Fatalf("got %d changes, want 3: %+v", len(changes), changes)
+	}
+
+	// Known fields come first in snapshot order, unknown fields last
+	want := []string{"bio", "tags", "mood"}
+	for i, change := range changes {
+		if change.Field != want[i] {
+			t.Errorf("change %d field = %q, want %q", i, change.Field, want[i])
+		}
+	}
+	if changes[0].From != "Artist" || changes[0].To != "Sculptor" {
+		t.Errorf("unexpected bio change %+v", changes[0])
+	}
+	if changes[2].From != nil {
+		t.Errorf("added field should come from nil, got %v", changes[2].From)
+	}
+
+	if len(diffSnapshots(from, from)) != 0 {
+		t.Error("identical snapshots should have no changes")
+	}
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"github.com/gin-gonic/gin"
+
+	"nectar-ai-companion/internal/storage"
 )
 
 // SetupRoutes configures all API routes
@@ -14,14 +16,81 @@ func SetupRoutes(router *gin.Engine, h *Handlers) {
 		auth.POST("/register", h.Register)
 		auth.POST("/login", h.Login)
 		auth.GET("/me", AuthMiddleware(h.authService), h.GetMe)
+		auth.POST("/me/avatar", AuthMiddleware(h.authService), h.UploadUserAvatar)
+		auth.GET("/me/profile", AuthMiddleware(h.authService), h.GetProfile)
+		auth.PUT("/me/profile", AuthMiddleware(h.authService), h.UpdateProfile)
+		auth.GET("/me/personas", AuthMiddleware(h.authService), h.ListPersonas)
+		auth.POST("/me/personas", AuthMiddleware(h.authService), h.CreatePersona)
+		auth.PUT("/me/personas/:id", AuthMiddleware(h.authService), h.UpdatePersona)
+		auth.DELETE("/me/personas/:id", AuthMiddleware(h.authService), h.DeletePersona)
 	}
 
-	// Companions routes (all public for demo)
+	// Companions routes (public browsing, owner-or-admin editing)
 	companions := api.Group("/companions")
+	companions.Use(OptionalAuthMiddleware(h.authService))
 	{
 		companions.GET("", h.ListCompanions)
+		companions.GET("/search", h.SearchCompanions)
+		companions.GET("/trending", h.GetTrendingCompanions)
+		companions.GET("/recommended", AuthMiddleware(h.authService), h.GetRecommendedCompanions)
+		companions.GET("/favorites", AuthMiddleware(h.authService), h.ListFavorites)
 		companions.GET("/:id", h.GetCompanion)
-		companions.POST("/custom", h.CreateCompanion) // Public for demo
+		companions.POST("/custom", h.CreateCompanion) // Guests allowed when ALLOW_GUEST_COMPANIONS=true
+		companions.POST("/import", h.ImportCompanion) // Character Card V2 JSON or PNG
+		companions.GET("/:id/card", h.ExportCompanion)
+		companions.PUT("/:id", AuthMiddleware(h.authService), h.ReplaceCompanion)
+		companions.PATCH("/:id", AuthMiddleware(h.authService), h.UpdateCompanion)
+		companions.DELETE("/:id", AuthMiddleware(h.authService), h.DeleteCompanion)
+		companions.POST("/:id/avatar", AuthMiddleware(h.authService), h.UploadCompanionAvatar)
+		companions.GET("/:id/revisions", AuthMiddleware(h.authService), h.ListCompanionRevisions)
+		companions.GET("/:id/revisions/diff", AuthMiddleware(h.authService), h.DiffCompanionRevisions)
+		companions.POST("/:id/revisions/:revision/rollback", AuthMiddleware(h.authService), h.RollbackCompanion)
+		companions.POST("/:id/favorite", AuthMiddleware(h.authService), h.FavoriteCompanion)
+		companions.DELETE("/:id/favorite", AuthMiddleware(h.authService), h.UnfavoriteCompanion)
+		companions.GET("/:id/lorebook", AuthMiddleware(h.authService), h.ListLorebook)
+		companions.POST("/:id/lorebook", AuthMiddleware(h.authService), h.CreateLorebookEntry)
+		companions.PATCH("/:id/lorebook/:entryId", AuthMiddleware(h.authService), h.UpdateLorebookEntry)
+		companions.DELETE("/:id/lorebook/:entryId", AuthMiddleware(h.authService), h.DeleteLorebookEntry)
+		companions.GET("/:id/knowledge", AuthMiddleware(h.authService), h.ListKnowledgeDocuments)
+		companions.POST("/:id/knowledge", AuthMiddleware(h.authService), h.UploadKnowledgeDocument)
+		companions.GET("/:id/knowledge/search", AuthMiddleware(h.authService), h.SearchKnowledge)
+		companions.DELETE("/:id/knowledge/:documentId", AuthMiddleware(h.authService), h.DeleteKnowledgeDocument)
+		companions.GET("/:id/gallery", h.ListGallery)
+		companions.POST("/:id/gallery", AuthMiddleware(h.authService), h.UploadGalleryItem)
+		companions.POST("/:id/gallery/generate", AuthMiddleware(h.authService), h.GenerateGalleryItem)
+		companions.PUT("/:id/gallery/order", AuthMiddleware(h.authService), h.ReorderGallery)
+		companions.PATCH("/:id/gallery/:itemId", AuthMiddleware(h.authService), h.UpdateGalleryItem)
+		companions.DELETE("/:id/gallery/:itemId", AuthMiddleware(h.authService), h.DeleteGalleryItem)
+		companions.GET("/:id/reviews", h.ListReviews)
+		companions.PUT("/:id/reviews", AuthMiddleware(h.authService), h.ReviewCompanion)
+		companions.DELETE("/:id/reviews", AuthMiddleware(h.authService), h.DeleteReview)
+	}
+
+	// Companion taxonomy
+	api.GET("/categories", h.ListCategories)
+	api.GET("/tags", h.ListTags)
+
+	// Review moderation
+	api.POST("/reviews/:id/report", AuthMiddleware(h.authService), h.ReportReview)
+
+	// Admin routes
+	admin := api.Group("/admin")
+	admin.Use(AuthMiddleware(h.authService), AdminMiddleware(h.authService))
+	{
+		admin.POST("/categories", h.CreateCategory)
+		admin.PUT("/categories/:slug", h.UpdateCategory)
+		admin.DELETE("/categories/:slug", h.DeleteCategory)
+		admin.POST("/tags", h.CreateTag)
+		admin.PUT("/tags/:slug", h.UpdateTag)
+		admin.DELETE("/tags/:slug", h.DeleteTag)
+		admin.POST("/tags/:slug/synonyms", h.AddTagSynonym)
+		admin.DELETE("/tags/:slug/synonyms/:synonym", h.DeleteTagSynonym)
+		admin.POST("/tags/:slug/merge", h.MergeTag)
+		admin.GET("/reviews/reported", h.ListReportedReviews)
+		admin.POST("/reviews/:id/hide", h.HideReview)
+		admin.POST("/reviews/:id/unhide", h.UnhideReview)
+		admin.GET("/feedback/stats", h.GetFeedbackStats)
+		admin.GET("/training-data", h.ExportTrainingData)
 	}
 
 	// Stories routes (protected)
@@ -39,17 +108,39 @@ func SetupRoutes(router *gin.Engine, h *Handlers) {
 	{
 		chat.POST("/start", h.StartChat)
 		chat.POST("/message", h.SendMessage)
+		chat.POST("/read", h.MarkRead)
 		chat.GET("/history/:companionId", h.GetChatHistory)
+		chat.POST("/attachments", h.UploadAttachment)
+		chat.POST("/messages/:id/voice", h.RenderVoiceNote)
+		chat.PUT("/messages/:id", h.EditMessage)
+		chat.DELETE("/messages/:id", h.DeleteMessage)
+		chat.POST("/messages/:id/regenerate", h.RegenerateMessage)
+		chat.GET("/messages/:id/revisions", h.ListMessageRevisions)
+		chat.GET("/messages/:id/siblings", h.ListMessageSiblings)
+		chat.POST("/messages/:id/fork", h.ForkConversation)
+		chat.POST("/messages/:id/reactions", h.AddReaction)
+		chat.DELETE("/messages/:id/reactions", h.RemoveReaction)
+		chat.PUT("/messages/:id/feedback", h.SetMessageFeedback)
+		chat.DELETE("/messages/:id/feedback", h.DeleteMessageFeedback)
+		chat.POST("/voice", h.SendVoiceMessage)
+		chat.GET("/conversations", h.ListConversations)
+		chat.POST("/conversations", h.CreateConversation)
+		chat.PATCH("/conversations/:id", h.UpdateConversation)
+		chat.DELETE("/conversations/:id", h.DeleteConversation)
+		chat.GET("/conversations/:id/messages", h.GetConversationMessages)
+		chat.PUT("/conversations/:id/revision", h.PinConversationRevision)
+		chat.PUT("/conversations/:id/persona", h.SetConversationPersona)
+		chat.PUT("/conversations/:id/branch", h.SwitchBranch)
 	}
 
 	// Public chat routes (for demo/testing without auth)
-	api.POST("/chat/public", h.PublicChat)
+	api.POST("/chat/public", OptionalAuthMiddleware(h.authService), h.PublicChat)
 	api.POST("/chat/public/save", h.SavePublicMessage)
 	api.GET("/chat/public/history/:companionId", h.GetPublicChatHistory)
 	api.GET("/chat/public/conversations", h.GetPublicConversations)
 
 	// Image generation routes (public for demo)
-	api.POST("/images/generate", h.GenerateCompanionPhoto)
+	api.POST("/images/generate", OptionalAuthMiddleware(h.authService), h.GenerateCompanionPhoto)
 
 	// Memories routes (protected)
 	memories := api.Group("/memories")
@@ -77,4 +168,9 @@ func SetupRoutes(router *gin.Engine, h *Handlers) {
 
 	// Admin endpoint to reseed stories (with videos)
 	api.POST("/admin/reseed-stories", h.ReseedStories)
+
+	// Uploaded and generated media stored on local disk
+	if local, ok := h.storage.(*storage.LocalStorage); ok {
+		router.Static(local.BasePath(), local.Dir())
+	}
 }
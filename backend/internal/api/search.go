@@ -0,0 +1,241 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"nectar-ai-companion/internal/models"
+)
+
+// sqlFilter accumulates WHERE conditions and their positional arguments
+type sqlFilter struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg adds a positional argument and returns its placeholder
+func (f *sqlFilter) arg(v interface{}) string {
+	f.args = append(f.args, v)
+	return fmt.Sprintf("$%d", len(f.args))
+}
+
+// add appends a condition
+func (f *sqlFilter) add(condition string) {
+	f.conditions = append(f.conditions, condition)
+}
+
+// where renders the conditions as a WHERE clause
+func (f *sqlFilter) where() string {
+	if len(f.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conditions, " AND ")
+}
+
+// addVisibleTo limits companions to public ones plus the viewer's own
+func (f *sqlFilter) addVisibleTo(viewer string) {
+	if viewer == "" {
+		f.add("visibility = 'public'")
+		return
+	}
+	f.add(fmt.Sprintf("(visibility = 'public' OR created_by = %s)", f.arg(viewer)))
+}
+
+// searchConfig is the text search configuration used for the companions search_vector
+const searchConfig = "english"
+
+// companionSortOrders maps sort options to ORDER BY expressions.
+// Every order ends with id so pages stay stable when values tie.
+var companionSortOrders = map[string]string{
+	"featured": "is_featured DESC, created_at DESC",
+	"popular":  "COALESCE(message_count, 0) DESC",
+	"newest":   "created_at DESC",
+	"rating":   "COALESCE(rating_average, 0) DESC, COALESCE(rating_count, 0) DESC",
+	"trending": "COALESCE((SELECT s.trending_score FROM companion_stats s WHERE s.companion_id = companions.id), 0) DESC",
+}
+
+// companionSearch holds the parsed parameters of a companion search
+type companionSearch struct {
+	Query              string
+	Category           string
+	Style              string
+	Tags               []string
+	MinAge             int
+	MaxAge             int
+	CommunicationStyle string
+	Sort               string
+	Page               int
+	PageSize           int
+}
+
+// parseCompanionSearch reads search parameters from the query string
+func parseCompanionSearch(c *gin.Context) (companionSearch, error) {
+	s := companionSearch{
+		Query:              strings.TrimSpace(c.Query("q")),
+		Category:           c.Query("category"),
+		Style:              c.Query("style"),
+		Tags:               c.QueryArray("tag"),
+		CommunicationStyle: c.Query("communicationStyle"),
+		Sort:               c.Query("sort"),
+	}
+	if s.Category == "all" {
+		s.Category = ""
+	}
+
+	s.MinAge, _ = strconv.Atoi(c.Query("minAge"))
+	s.MaxAge, _ = strconv.Atoi(c.Query("maxAge"))
+	if s.MinAge != 0 && s.MaxAge != 0 && s.MinAge > s.MaxAge {
+		return s, fmt.Errorf("minAge must not be greater than maxAge")
+	}
+
+	if s.Sort == "" {
+		s.Sort = "featured"
+		if s.Query != "" {
+			s.Sort = "relevance"
+		}
+	}
+	if _, ok := companionSortOrders[s.Sort]; !ok && !(s.Sort == "relevance" && s.Query != "") {
+		return s, fmt.Errorf("unsupported sort: %s", s.Sort)
+	}
+
+	s.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	s.PageSize, _ = strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	if s.Page < 1 {
+		s.Page = 1
+	}
+	if s.PageSize < 1 || s.PageSize > 100 {
+		s.PageSize = 20
+	}
+
+	return s, nil
+}
+
+// filter builds the WHERE conditions for the search, limited to what the viewer may see
+func (s companionSearch) filter(viewer string) *sqlFilter {
+	f := &sqlFilter{}
+	f.addVisibleTo(viewer)
+
+	if s.Query != "" {
+		f.add(fmt.Sprintf("search_vector @@ websearch_to_tsquery('%s', %s)", searchConfig, f.arg(s.Query)))
+	}
+	if s.Category != "" {
+		f.add("category = " + f.arg(s.Category))
+	}
+	if s.Style != "" {
+		f.add("COALESCE(style, 'realistic') = " + f.arg(s.Style))
+	}
+	for _, tag := range s.Tags {
+		f.add(fmt.Sprintf("EXISTS (SELECT 1 FROM unnest(tags) t WHERE lower(t) = lower(%s))", f.arg(tag)))
+	}
+	if s.MinAge > 0 {
+		f.add("age >= " + f.arg(s.MinAge))
+	}
+	if s.MaxAge > 0 {
+		f.add("age <= " + f.arg(s.MaxAge))
+	}
+	if s.CommunicationStyle != "" {
+		f.add("COALESCE(communication_style, 'friendly') = " + f.arg(s.CommunicationStyle))
+	}
+
+	return f
+}
+
+// orderBy renders the ORDER BY clause, adding arguments to f for relevance ranking
+func (s companionSearch) orderBy(f *sqlFilter) string {
+	order := companionSortOrders[s.Sort]
+	if s.Sort == "relevance" {
+		order = fmt.Sprintf("ts_rank_cd(search_vector, websearch_to_tsquery('%s', %s)) DESC", searchConfig, f.arg(s.Query))
+	}
+	return " ORDER BY " + order + ", id ASC"
+}
+
+// companionFacets lists the facet queries: name, grouped expression and extra FROM items
+var companionFacets = []struct {
+	name  string
+	expr  string
+	from  string
+	limit int
+}{
+	{name: "category", expr: "category"},
+	{name: "style", expr: "COALESCE(style, 'realistic')"},
+	{name: "tag", expr: "t", from: ", unnest(tags) t", limit: 20},
+	{name: "ageRange", expr: `CASE WHEN age < 25 THEN '18-24' WHEN age < 35 THEN '25-34'
+		WHEN age < 45 THEN '35-44' ELSE '45+' END`},
+	{name: "communicationStyle", expr: "COALESCE(communication_style, 'friendly')"},
+}
+
+// SearchCompanions runs a full-text search over companions with facets, sorting and pagination
+func (h *Handlers) SearchCompanions(c *gin.Context) {
+	search, err := parseCompanionSearch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	f := search.filter(viewerID(c))
+	where := f.where()
+	filterArgs := len(f.args)
+
+	order := search.orderBy(f)
+	limit := f.arg(search.PageSize)
+	offset := f.arg((search.Page - 1) * search.PageSize)
+
+	rows, err := h.db.Query(
+		`SELECT `+companionColumns+` FROM companions`+where+order+` LIMIT `+limit+` OFFSET `+offset,
+		f.args...,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	companions := []models.Companion{}
+	for rows.Next() {
+		var comp models.Companion
+		if err := scanCompanion(rows, &comp); err != nil {
+			continue
+		}
+		companions = append(companions, comp)
+	}
+
+	args := f.args[:filterArgs]
+
+	var total int
+	h.db.QueryRow("SELECT COUNT(*) FROM companions"+where, args...).Scan(&total)
+
+	facets := make(map[string][]models.FacetCount, len(companionFacets))
+	for _, facet := range companionFacets {
+		query := fmt.Sprintf(`SELECT %s AS value, COUNT(*) FROM companions%s%s GROUP BY value ORDER BY COUNT(*) DESC, value`,
+			facet.expr, facet.from, where)
+		if facet.limit > 0 {
+			query += fmt.Sprintf(" LIMIT %d", facet.limit)
+		}
+
+		counts := []models.FacetCount{}
+		if facetRows, err := h.db.Query(query, args...); err == nil {
+			for facetRows.Next() {
+				var fc models.FacetCount
+				if err := facetRows.Scan(&fc.Value, &fc.Count); err == nil {
+					counts = append(counts, fc)
+				}
+			}
+			facetRows.Close()
+		}
+		facets[facet.name] = counts
+	}
+
+	c.JSON(http.StatusOK, models.CompanionSearchResponse{
+		Data:       companions,
+		Total:      total,
+		Page:       search.Page,
+		PageSize:   search.PageSize,
+		TotalPages: (total + search.PageSize - 1) / search.PageSize,
+		Sort:       search.Sort,
+		Facets:     facets,
+	})
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func searchFromURL(t *testing.T, url string) (companionSearch, error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest("GET", url, nil)
+	return parseCompanionSearch(c)
+}
+
+func TestParseCompanionSearchDefaults(t *testing.T) {
+	s, err := searchFromURL(t, "/api/companions/search")
+	if err != nil {
+		t.Fatalf("parseCompanionSearch returned error: %v", err)
+	}
+	if s.Sort != "featured" || s.Page != 1 || s.PageSize != 20 {
+		t.Errorf("unexpected defaults %+v", s)
+	}
+
+	s, _ = searchFromURL(t, "/api/companions/search?q=artist&pageSize=500")
+	if s.Sort != "relevance" || s.PageSize != 20 {
+		t.Errorf("text queries should sort by relevance with a clamped page size, got %+v", s)
+	}
+}
+
+func TestParseCompanionSearchRejectsBadInput(t *testing.T) {
+	for _, url := range []string{
+		"/api/companions/search?sort=random",
+		"/api/companions/search?sort=relevance",
+		"/api/companions/search?minAge=40&maxAge=20",
+	} {
+		if _, err := searchFromURL(t, url); err == nil {
+			t.Errorf("expected error for %s", url)
+		}
+	}
+}
+
+func TestCompanionSearchFilter(t *testing.T) {
+	s, err := searchFromURL(t, "/api/companions/search?q=art&category=girls&tag=Creative&tag=Funny&minAge=21&sort=popular&page=2")
+	if err != nil {
+		t.Fatalf("parseCompanionSearch returned error: %v", err)
+	}
+
+	f := s.filter("user-1")
+	where := f.where()
+	for _, want := range []string{
+		"(visibility = 'public' OR created_by = $1)",
+		"search_vector @@ websearch_to_tsquery('english', $2)",
+		"category = $3",
+		"lower(t) = lower($4)",
+		"lower(t) = lower($5)",
+		"age >= $6",
+	} {
+		if !strings.Contains(where, want) {
+			t.Errorf("where clause missing %q:\n%s", want, where)
+		}
+	}
+	if len(f.args) != 6 {
+		t.Errorf("got %d args, want 6", len(f.args))
+	}
+
+	order := s.orderBy(f)
+	if !strings.HasSuffix(order, ", id ASC") || !strings.Contains(order, "message_count") {
+		t.Errorf("unexpected order %q", order)
+	}
+}
+
+func TestCompanionSearchRelevanceOrder(t *testing.T) {
+	s, _ := searchFromURL(t, "/api/companions/search?q=poet")
+	f := s.filter("")
+	order := s.orderBy(f)
+
+	if !strings.Contains(order, "ts_rank_cd(search_vector, websearch_to_tsquery('english', $2))") {
+		t.Errorf("unexpected relevance order %q", order)
+	}
+	if f.args[1] != "poet" {
+		t.Errorf("relevance rank should bind the query, got %v", f.args)
+	}
+	if !strings.Contains(f.where(), "visibility = 'public'") {
+		t.Error("guests should only search public companions")
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"nectar-ai-companion/internal/models"
+)
+
+// statsColumns selects companion_stats (aliased s) after companionColumns, zeroed when not yet aggregated
+const statsColumns = `COALESCE(s.messages_total, 0), COALESCE(s.unique_chatters, 0), COALESCE(s.story_views, 0),
+	COALESCE(s.trending_score, 0), s.computed_at`
+
+// statsDest returns the scan destinations for statsColumns
+func statsDest(stats *models.CompanionStats) []interface{} {
+	return []interface{}{&stats.MessageCount, &stats.UniqueChatters, &stats.StoryViews, &stats.TrendingScore, &stats.ComputedAt}
+}
+
+// loadCompanionStats fetches a companion's aggregated stats, zeroed if the aggregator has not run yet
+func (h *Handlers) loadCompanionStats(companionID string) (*models.CompanionStats, error) {
+	var stats models.CompanionStats
+	err := h.db.QueryRow(
+		`SELECT `+statsColumns+` FROM companions LEFT JOIN companion_stats s ON s.companion_id = companions.id
+		WHERE companions.id = $1`,
+		companionID,
+	).Scan(statsDest(&stats)...)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetTrendingCompanions lists companions by time-decayed activity, with their stats
+func (h *Handlers) GetTrendingCompanions(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > 50 {
+		limit = 20
+	}
+
+	companions, err := h.trendingCompanions(viewerID(c), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: companions})
+}
+
+// trendingCompanions returns the top companions by trending score that the viewer may see
+func (h *Handlers) trendingCompanions(viewer string, limit int) ([]models.Companion, error) {
+	f := &sqlFilter{}
+	f.addVisibleTo(viewer)
+	rows, err := h.db.Query(
+		`SELECT `+companionColumns+`, `+statsColumns+`
+		FROM companions LEFT JOIN companion_stats s ON s.companion_id = companions.id`+f.where()+`
+		ORDER BY COALESCE(s.trending_score, 0) DESC, is_featured DESC, id ASC
+		LIMIT `+f.arg(limit),
+		f.args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	companions := []models.Companion{}
+	for rows.Next() {
+		var comp models.Companion
+		stats := &models.CompanionStats{}
+		if err := scanCompanion(rows, &comp, statsDest(stats)...); err != nil {
+			continue
+		}
+		comp.Stats = stats
+		companions = append(companions, comp)
+	}
+	return companions, nil
+}
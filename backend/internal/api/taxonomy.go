@@ -0,0 +1,516 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+
+	"nectar-ai-companion/internal/models"
+)
+
+// tagIndex maps tag slugs and synonyms to the canonical display name stored on companions
+type tagIndex map[string]string
+
+// canonical resolves tags to their managed display names, dropping duplicates.
+// It also returns the tags that match no managed tag or synonym.
+func (idx tagIndex) canonical(tags []string) (known []string, unknown []string) {
+	known = []string{}
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		name, ok := idx[slugify(tag)]
+		if !ok {
+			unknown = append(unknown, tag)
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			known = append(known, name)
+		}
+	}
+	return known, unknown
+}
+
+// loadTagIndex reads every managed tag and synonym
+func (h *Handlers) loadTagIndex() (tagIndex, error) {
+	rows, err := h.db.Query(
+		`SELECT slug, display_name FROM tags
+		UNION ALL
+		SELECT s.synonym, t.display_name FROM tag_synonyms s JOIN tags t ON t.slug = s.tag_slug`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	idx := tagIndex{}
+	for rows.Next() {
+		var slug, name string
+		if err := rows.Scan(&slug, &name); err != nil {
+			return nil, err
+		}
+		idx[slug] = name
+	}
+	return idx, rows.Err()
+}
+
+// categoryExists reports whether a category slug is managed
+func (h *Handlers) categoryExists(slug string) (bool, error) {
+	var exists bool
+	err := h.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM categories WHERE slug = $1)`, slug).Scan(&exists)
+	return exists, err
+}
+
+// checkTaxonomy validates a patch's category and replaces its tags with their managed names.
+// Unknown tags are an error unless dropUnknown is set, as for imported cards with free-form tags.
+// It writes the error response and returns false if the patch is invalid.
+func (h *Handlers) checkTaxonomy(c *gin.Context, p *companionPatch, dropUnknown bool) bool {
+	if p.Category != nil {
+		exists, err := h.categoryExists(*p.Category)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return false
+		}
+		if !exists {
+			c.JSON(http.StatusBadRequest, models.APIResponse{Error: "unknown category: " + *p.Category})
+			return false
+		}
+	}
+
+	if p.Tags != nil {
+		idx, err := h.loadTagIndex()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+			return false
+		}
+		known, unknown := idx.canonical(p.Tags)
+		if len(unknown) > 0 && !dropUnknown {
+			c.JSON(http.StatusBadRequest, models.APIResponse{Error: "unknown tags: " + strings.Join(unknown, ", ")})
+			return false
+		}
+		p.Tags = known
+	}
+
+	return true
+}
+
+// taxonomySlug picks the slug for a new category or tag from the request
+func taxonomySlug(req models.TaxonomyRequest) (string, error) {
+	slug := req.Slug
+	if slug == "" {
+		slug = req.DisplayName
+	}
+	slug = slugify(slug)
+	if slug == "" {
+		return "", fmt.Errorf("slug must contain letters or digits")
+	}
+	return slug, nil
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
+// ListCategories lists the managed categories in display order
+func (h *Handlers) ListCategories(c *gin.Context) {
+	rows, err := h.db.Query(`SELECT slug, display_name, sort_order, created_at FROM categories ORDER BY sort_order, display_name`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		var cat models.Category
+		if err := rows.Scan(&cat.Slug, &cat.DisplayName, &cat.SortOrder, &cat.CreatedAt); err != nil {
+			continue
+		}
+		categories = append(categories, cat)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: categories})
+}
+
+// CreateCategory adds a category (admin)
+func (h *Handlers) CreateCategory(c *gin.Context) {
+	var req models.TaxonomyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+	slug, err := taxonomySlug(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	cat := models.Category{Slug: slug, DisplayName: req.DisplayName, SortOrder: req.SortOrder}
+	err = h.db.QueryRow(
+		`INSERT INTO categories (slug, display_name, sort_order) VALUES ($1, $2, $3) RETURNING created_at`,
+		cat.Slug, cat.DisplayName, cat.SortOrder,
+	).Scan(&cat.CreatedAt)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, models.APIResponse{Error: "category already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{Data: cat})
+}
+
+// UpdateCategory renames or reorders a category (admin); a new slug is applied to its companions too
+func (h *Handlers) UpdateCategory(c *gin.Context) {
+	var req models.TaxonomyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+	slug := c.Param("slug")
+	if req.Slug != "" {
+		var err error
+		if slug, err = taxonomySlug(req); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	cat := models.Category{Slug: slug, DisplayName: req.DisplayName, SortOrder: req.SortOrder}
+	err := h.db.QueryRow(
+		`UPDATE categories SET slug = $2, display_name = $3, sort_order = $4 WHERE slug = $1 RETURNING created_at`,
+		c.Param("slug"), cat.Slug, cat.DisplayName, cat.SortOrder,
+	).Scan(&cat.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "category not found"})
+		return
+	}
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, models.APIResponse{Error: "category already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: cat})
+}
+
+// DeleteCategory removes a category that no companion uses (admin)
+func (h *Handlers) DeleteCategory(c *gin.Context) {
+	var inUse int
+	h.db.QueryRow(`SELECT COUNT(*) FROM companions WHERE category = $1`, c.Param("slug")).Scan(&inUse)
+	if inUse > 0 {
+		c.JSON(http.StatusConflict, models.APIResponse{Error: fmt.Sprintf("category is used by %d companions", inUse)})
+		return
+	}
+
+	res, err := h.db.Exec(`DELETE FROM categories WHERE slug = $1`, c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "category not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "category deleted"})
+}
+
+// ListTags lists the managed tags in display order with their synonyms
+func (h *Handlers) ListTags(c *gin.Context) {
+	rows, err := h.db.Query(
+		`SELECT t.slug, t.display_name, t.sort_order, t.created_at,
+			ARRAY(SELECT s.synonym FROM tag_synonyms s WHERE s.tag_slug = t.slug ORDER BY s.synonym)
+		FROM tags t ORDER BY t.sort_order, t.display_name`,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.Slug, &tag.DisplayName, &tag.SortOrder, &tag.CreatedAt, pq.Array(&tag.Synonyms)); err != nil {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: tags})
+}
+
+// CreateTag adds a tag (admin)
+func (h *Handlers) CreateTag(c *gin.Context) {
+	var req models.TaxonomyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+	slug, err := taxonomySlug(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	var synonym bool
+	h.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM tag_synonyms WHERE synonym = $1)`, slug).Scan(&synonym)
+	if synonym {
+		c.JSON(http.StatusConflict, models.APIResponse{Error: "slug is already a synonym of another tag"})
+		return
+	}
+
+	tag := models.Tag{Slug: slug, DisplayName: req.DisplayName, SortOrder: req.SortOrder, Synonyms: []string{}}
+	err = h.db.QueryRow(
+		`INSERT INTO tags (slug, display_name, sort_order) VALUES ($1, $2, $3) RETURNING created_at`,
+		tag.Slug, tag.DisplayName, tag.SortOrder,
+	).Scan(&tag.CreatedAt)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, models.APIResponse{Error: "tag already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{Data: tag})
+}
+
+// rewriteCompanionTags renames a tag on every companion, or removes it when to is nil. Companion
+// tags match when they slugify to the tag's slug or display name, so spellings like "sci fi" and
+// "Sci-Fi" are renamed or merged together.
+func rewriteCompanionTags(tx *sql.Tx, slug, name string, to *string) error {
+	rows, err := tx.Query(`SELECT DISTINCT t FROM companions, unnest(tags) t`)
+	if err != nil {
+		return err
+	}
+	matches := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			rows.Close()
+			return err
+		}
+		if s := slugify(tag); s == slug || s == slugify(name) {
+			matches = append(matches, tag)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(
+		`UPDATE companions SET tags = ARRAY(
+			SELECT tag FROM (
+				SELECT CASE WHEN t = ANY($1) THEN $2 ELSE t END AS tag, MIN(ord) AS ord
+				FROM unnest(tags) WITH ORDINALITY u(t, ord)
+				GROUP BY 1
+			) renamed
+			WHERE tag IS NOT NULL
+			ORDER BY ord
+		)
+		WHERE tags && $1`,
+		pq.Array(matches), to,
+	)
+	return err
+}
+
+// UpdateTag changes a tag's display name or sort order (admin); companions are renamed to match
+func (h *Handlers) UpdateTag(c *gin.Context) {
+	var req models.TaxonomyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	err = tx.QueryRow(`SELECT display_name FROM tags WHERE slug = $1 FOR UPDATE`, c.Param("slug")).Scan(&oldName)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "tag not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	tag := models.Tag{Slug: c.Param("slug"), DisplayName: req.DisplayName, SortOrder: req.SortOrder}
+	err = tx.QueryRow(
+		`UPDATE tags SET display_name = $2, sort_order = $3 WHERE slug = $1 RETURNING created_at`,
+		tag.Slug, tag.DisplayName, tag.SortOrder,
+	).Scan(&tag.CreatedAt)
+	if err == nil && oldName != tag.DisplayName {
+		err = rewriteCompanionTags(tx, tag.Slug, oldName, &tag.DisplayName)
+	}
+	if err == nil {
+		err = tx.QueryRow(
+			`SELECT ARRAY(SELECT synonym FROM tag_synonyms WHERE tag_slug = $1 ORDER BY synonym)`, tag.Slug,
+		).Scan(pq.Array(&tag.Synonyms))
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Data: tag})
+}
+
+// DeleteTag removes a tag and its synonyms, and strips it from companions (admin)
+func (h *Handlers) DeleteTag(c *gin.Context) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var name string
+	err = tx.QueryRow(`DELETE FROM tags WHERE slug = $1 RETURNING display_name`, c.Param("slug")).Scan(&name)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "tag not found"})
+		return
+	}
+	if err == nil {
+		err = rewriteCompanionTags(tx, c.Param("slug"), name, nil)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "tag deleted"})
+}
+
+// AddTagSynonym makes another spelling resolve to a tag (admin)
+func (h *Handlers) AddTagSynonym(c *gin.Context) {
+	var req models.TagSynonymRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+	synonym := slugify(req.Synonym)
+	if synonym == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "synonym must contain letters or digits"})
+		return
+	}
+
+	var isTag bool
+	h.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM tags WHERE slug = $1)`, synonym).Scan(&isTag)
+	if isTag {
+		c.JSON(http.StatusConflict, models.APIResponse{Error: "synonym is a tag; merge it instead"})
+		return
+	}
+
+	_, err := h.db.Exec(
+		`INSERT INTO tag_synonyms (synonym, tag_slug) SELECT $1, slug FROM tags WHERE slug = $2`,
+		synonym, c.Param("slug"),
+	)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, models.APIResponse{Error: "synonym already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{Data: gin.H{"synonym": synonym, "tag": c.Param("slug")}})
+}
+
+// DeleteTagSynonym removes a synonym from a tag (admin)
+func (h *Handlers) DeleteTagSynonym(c *gin.Context) {
+	res, err := h.db.Exec(`DELETE FROM tag_synonyms WHERE synonym = $1 AND tag_slug = $2`, c.Param("synonym"), c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "synonym not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: "synonym deleted"})
+}
+
+// MergeTag folds a tag into another (admin): companions switch to the target,
+// and the merged slug and its synonyms become synonyms of the target
+func (h *Handlers) MergeTag(c *gin.Context) {
+	var req models.MergeTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+	from := c.Param("slug")
+	if req.Into == from {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "cannot merge a tag into itself"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	var fromName, intoName string
+	err = tx.QueryRow(`SELECT display_name FROM tags WHERE slug = $1 FOR UPDATE`, from).Scan(&fromName)
+	if err == nil {
+		err = tx.QueryRow(`SELECT display_name FROM tags WHERE slug = $1 FOR UPDATE`, req.Into).Scan(&intoName)
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "tag not found"})
+		return
+	}
+
+	if err == nil {
+		_, err = tx.Exec(`UPDATE tag_synonyms SET tag_slug = $2 WHERE tag_slug = $1`, from, req.Into)
+	}
+	if err == nil {
+		_, err = tx.Exec(`DELETE FROM tags WHERE slug = $1`, from)
+	}
+	if err == nil {
+		_, err = tx.Exec(`INSERT INTO tag_synonyms (synonym, tag_slug) VALUES ($1, $2)`, from, req.Into)
+	}
+	if err == nil {
+		err = rewriteCompanionTags(tx, from, fromName, &intoName)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{Message: fmt.Sprintf("merged %s into %s", from, req.Into)})
+}
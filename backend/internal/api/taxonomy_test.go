@@ -0,0 +1,49 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"nectar-ai-companion/internal/models"
+)
+
+func TestTagIndexCanonical(t *testing.T) {
+	idx := tagIndex{
+		"creative":     "Creative",
+		"artsy":        "Creative", // synonym
+		"deep-thinker": "Deep Thinker",
+	}
+
+	known, unknown := idx.canonical([]string{"creative", "Deep thinker", "Artsy", "Sporty", "CREATIVE"})
+	if want := []string{"Creative", "Deep Thinker"}; !reflect.DeepEqual(known, want) {
+		t.Errorf("known = %v, want %v", known, want)
+	}
+	if want := []string{"Sporty"}; !reflect.DeepEqual(unknown, want) {
+		t.Errorf("unknown = %v, want %v", unknown, want)
+	}
+
+	known, unknown = idx.canonical(nil)
+	if known == nil || len(known) != 0 || unknown != nil {
+		t.Errorf("empty tags should resolve to an empty list, got %v %v", known, unknown)
+	}
+}
+
+func TestTaxonomySlug(t *testing.T) {
+	tests := []struct {
+		req     models.TaxonomyRequest
+		want    string
+		wantErr bool
+	}{
+		{models.TaxonomyRequest{DisplayName: "Sci-Fi Heroes"}, "sci-fi-heroes", false},
+		{models.TaxonomyRequest{Slug: "fantasy", DisplayName: "Fantasy & Myth"}, "fantasy", false},
+		{models.TaxonomyRequest{DisplayName: "  Deep   Thinker "}, "deep-thinker", false},
+		{models.TaxonomyRequest{DisplayName: "💕"}, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := taxonomySlug(tt.req)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("taxonomySlug(%+v) = %q, %v; want %q, error %v", tt.req, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nectar-ai-companion/internal/models"
+	"nectar-ai-companion/internal/services"
+)
+
+// audioExtensions maps synthesized and uploaded audio MIME types to file extensions
+var audioExtensions = map[string]string{
+	"audio/mpeg": ".mp3",
+	"audio/wav":  ".wav",
+	"audio/ogg":  ".ogg",
+	"audio/webm": ".webm",
+	"audio/mp4":  ".m4a",
+}
+
+// maxAudioUploadSize limits user voice notes to 25MB, the Whisper API limit
+const maxAudioUploadSize = 25 << 20
+
+// sniffedAudioTypes maps the types http.DetectContentType reports for audio containers to audioExtensions keys
+var sniffedAudioTypes = map[string]string{
+	"audio/mpeg":      "audio/mpeg",
+	"audio/wave":      "audio/wav",
+	"application/ogg": "audio/ogg",
+	"video/webm":      "audio/webm",
+	"video/mp4":       "audio/mp4",
+}
+
+// voiceJSON stores a voice profile in a JSONB column
+func voiceJSON(voice services.VoiceProfile) models.JSONB {
+	j := models.JSONB{}
+	if voice.VoiceID != "" {
+		j["voiceId"] = voice.VoiceID
+	}
+	if voice.Pitch > 0 {
+		j["pitch"] = voice.Pitch
+	}
+	if voice.Speed > 0 {
+		j["speed"] = voice.Speed
+	}
+	return j
+}
+
+// voiceProfile reads a voice profile stored with voiceJSON
+func voiceProfile(j models.JSONB) services.VoiceProfile {
+	var voice services.VoiceProfile
+	if voiceID, ok := j["voiceId"].(string); ok {
+		voice.VoiceID = voiceID
+	}
+	if pitch, ok := j["pitch"].(float64); ok {
+		voice.Pitch = pitch
+	}
+	if speed, ok := j["speed"].(float64); ok {
+		voice.Speed = speed
+	}
+	return voice
+}
+
+// companionVoice reads a companion's voice profile, lowering the default pitch for male companions
+func companionVoice(comp *models.Companion) services.VoiceProfile {
+	voice := voiceProfile(comp.VoiceJSON)
+	if voice.Pitch == 0 && (comp.Category == "guys" || companionAppearance(comp).Gender == "man") {
+		voice.Pitch = 0.7
+	}
+	return voice
+}
+
+// renderVoiceNote synthesizes an AI message with the companion's voice and saves it as an audio attachment
+func (h *Handlers) renderVoiceNote(comp *models.Companion, msg *models.Message) (*models.Attachment, error) {
+	if !h.voiceProvider.IsConfigured() {
+		return nil, fmt.Errorf("voice service not configured")
+	}
+
+	text := services.SpeakableText(msg.Content)
+	if text == "" {
+		return nil, fmt.Errorf("message has no speakable text")
+	}
+
+	audio, err := h.voiceProvider.Synthesize(text, companionVoice(comp))
+	if err != nil {
+		return nil, err
+	}
+
+	att, err := h.storeMedia("audio", "voice/"+comp.ID, audio.Data, audio.MimeType)
+	if err != nil {
+		return nil, err
+	}
+	if audio.DurationMs > 0 {
+		att.DurationMs = &audio.DurationMs
+	}
+	att.MessageID = &msg.ID
+
+	if err := insertAttachment(h.db, att); err != nil {
+		return nil, err
+	}
+	return att, nil
+}
+
+// RenderVoiceNote renders one of the companion's messages as a voice note the client can play
+func (h *Handlers) RenderVoiceNote(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	if !h.voiceProvider.IsConfigured() {
+		c.JSON(http.StatusServiceUnavailable, models.APIResponse{Error: "Voice service not configured"})
+		return
+	}
+
+	// Verify the message is an AI message in one of the user's conversations
+	var msg models.Message
+	var companionID string
+	err := h.db.QueryRow(
+		`SELECT m.id, m.conversation_id, m.sender, m.content, m.created_at, conv.companion_id
+		FROM messages m JOIN conversations conv ON conv.id = m.conversation_id
+		WHERE m.id = $1 AND conv.user_id = $2 AND m.deleted_at IS NULL`,
+		c.Param("id"), userID,
+	).Scan(&msg.ID, &msg.ConversationID, &msg.Sender, &msg.Content, &msg.CreatedAt, &companionID)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.APIResponse{Error: "message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if msg.Sender != "ai" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "only companion messages can be voiced"})
+		return
+	}
+
+	attachments, err := h.loadAttachments([]string{msg.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	// Reuse an existing voice note
+	for _, att := range attachments[msg.ID] {
+		if att.Kind == "audio" {
+			c.JSON(http.StatusOK, models.APIResponse{Data: att})
+			return
+		}
+	}
+
+	comp, err := h.conversationCompanion(msg.ConversationID, companionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	att, err := h.renderVoiceNote(comp, &msg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: "Failed to render voice note: " + err.Error()})
+		return
+	}
+
+	setAttachments(&msg, append(attachments[msg.ID], *att))
+	h.wsHub.BroadcastToConversation(msg.ConversationID, &msg)
+
+	c.JSON(http.StatusCreated, models.APIResponse{Data: att})
+}
+
+// readAudioUpload reads a multipart audio field and validates its type.
+// The content is sniffed first; containers the sniffer does not know (e.g. bare
+// MP3 frames, M4A) fall back to the declared Content-Type.
+func readAudioUpload(c *gin.Context, field string) ([]byte, string, error) {
+	file, header, err := c.Request.FormFile(field)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s is required", field)
+	}
+	defer file.Close()
+
+	if header.Size > maxAudioUploadSize {
+		return nil, "", fmt.Errorf("audio must be smaller than %dMB", maxAudioUploadSize>>20)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAudioUploadSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read upload: %w", err)
+	}
+	if len(data) > maxAudioUploadSize {
+		return nil, "", fmt.Errorf("audio must be smaller than %dMB", maxAudioUploadSize>>20)
+	}
+
+	mimeType, ok := sniffedAudioTypes[http.DetectContentType(data)]
+	if !ok {
+		declared := strings.TrimSpace(strings.Split(header.Header.Get("Content-Type"), ";")[0])
+		if _, known := audioExtensions[declared]; !known {
+			return nil, "", fmt.Errorf("unsupported audio type: %s", declared)
+		}
+		mimeType = declared
+	}
+
+	return data, mimeType, nil
+}
+
+// SendVoiceMessage transcribes a voice note from the user, saves it as a message
+// with the audio attached and the transcript as its content, and gets the companion's reply.
+// Form fields: conversationId, audio (file) and optional voiceReply=true for a spoken answer.
+func (h *Handlers) SendVoiceMessage(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, models.APIResponse{Error: "unauthorized"})
+		return
+	}
+
+	if !h.transcriptionProvider.IsConfigured() {
+		c.JSON(http.StatusServiceUnavailable, models.APIResponse{Error: "Transcription service not configured"})
+		return
+	}
+
+	conversationID := c.PostForm("conversationId")
+	if conversationID == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: "conversationId is required"})
+		return
+	}
+
+	// Verify conversation belongs to user
+	conv, ok := h.ownedConversation(c, userID.(string), conversationID)
+	if !ok {
+		return
+	}
+	if conv.ArchivedAt != nil {
+		c.JSON(http.StatusConflict, models.APIResponse{Error: "conversation is archived"})
+		return
+	}
+	companionID := conv.CompanionID
+
+	data, mimeType, err := readAudioUpload(c, "audio")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	transcript, err := h.transcriptionProvider.Transcribe(data, mimeType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: "Failed to transcribe voice note: " + err.Error()})
+		return
+	}
+	if strings.TrimSpace(transcript.Text) == "" {
+		c.JSON(http.StatusUnprocessableEntity, models.APIResponse{Error: "no speech detected in voice note"})
+		return
+	}
+
+	uid := userID.(string)
+	att, err := h.storeMedia("audio", "attachments/"+uid, data, mimeType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	att.UserID = &uid
+	if transcript.DurationMs > 0 {
+		att.DurationMs = &transcript.DurationMs
+	}
+
+	// The message follows the active leaf, read below
+	userMsg := models.Message{
+		ID:             uuid.New().String(),
+		ConversationID: conv.ID,
+		Sender:         "user",
+		Content:        strings.TrimSpace(transcript.Text),
+		CreatedAt:      time.Now(),
+	}
+	// The companion receives messages as soon as they are stored
+	userMsg.DeliveredAt = &userMsg.CreatedAt
+	att.MessageID = &userMsg.ID
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		h.storage.Delete(*att.StorageKey)
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	committed := false
+	defer func() {
+		tx.Rollback()
+		// The audio file is kept only if its row was
+		if !committed {
+			h.storage.Delete(*att.StorageKey)
+		}
+	}()
+
+	if userMsg.ParentID, err = lockActiveLeaf(tx, conv.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	if err := insertMessage(tx, &userMsg); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	if err := insertAttachment(tx, att); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	committed = true
+	setAttachments(&userMsg, []models.Attachment{*att})
+
+	aiMsg, err := h.replyToMessage(uid, companionID, &userMsg, c.PostForm("voiceReply") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{Error: err.Error()})
+		return
+	}
+	// The reply is returned to the sender, so they have read it
+	if receipt, err := h.markRead(uid, conv.ID, aiMsg.ID); err == nil {
+		aiMsg.DeliveredAt, aiMsg.ReadAt = &receipt.At, &receipt.At
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Data: models.SendMessageResponse{
+			UserMessage: &userMsg,
+			AIMessage:   aiMsg,
+		},
+	})
+}
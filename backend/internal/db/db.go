@@ -66,7 +66,7 @@ func RunMigrations(db *sql.DB) error {
 		`CREATE TABLE IF NOT EXISTS companions (
 			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
 			name VARCHAR(100) NOT NULL,
-			category VARCHAR(20) NOT NULL CHECK (category IN ('girls', 'guys', 'anime')),
+			category VARCHAR(50) NOT NULL,
 			bio TEXT,
 			avatar_url TEXT NOT NULL,
 			personality_json JSONB DEFAULT '{}',
@@ -111,8 +111,7 @@ func RunMigrations(db *sql.DB) error {
 			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
 			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
 			companion_id UUID NOT NULL REFERENCES companions(id) ON DELETE CASCADE,
-			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE(user_id, companion_id)
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 		)`,
 
 		// Messages table
@@ -161,6 +160,332 @@ func RunMigrations(db *sql.DB) error {
 			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 		)`,
 
+		// Message attachments table (images, audio, video, stickers)
+		`CREATE TABLE IF NOT EXISTS message_attachments (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			message_id UUID REFERENCES messages(id) ON DELETE CASCADE,
+			user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+			kind VARCHAR(20) NOT NULL CHECK (kind IN ('image', 'audio', 'video', 'sticker')),
+			url TEXT NOT NULL,
+			storage_key TEXT,
+			mime_type VARCHAR(100),
+			width INTEGER,
+			height INTEGER,
+			size_bytes BIGINT,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Move generated photos that older versions stored on messages into attachments, and drop the column
+		`DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'messages' AND column_name = 'image_url') THEN
+				INSERT INTO message_attachments (message_id, kind, url)
+				SELECT m.id, 'image', m.image_url FROM messages m
+				WHERE m.image_url IS NOT NULL
+				AND NOT EXISTS (SELECT 1 FROM message_attachments a WHERE a.message_id = m.id);
+				ALTER TABLE messages DROP COLUMN image_url;
+			END IF;
+		END $$`,
+
+		// Companion voice profiles and voice note durations
+		`ALTER TABLE companions ADD COLUMN IF NOT EXISTS voice_json JSONB DEFAULT '{}'`,
+		`ALTER TABLE message_attachments ADD COLUMN IF NOT EXISTS duration_ms INTEGER`,
+
+		// Companion ownership and visibility, user roles
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin'))`,
+		`ALTER TABLE companions ADD COLUMN IF NOT EXISTS created_by UUID REFERENCES users(id) ON DELETE SET NULL`,
+		`ALTER TABLE companions ADD COLUMN IF NOT EXISTS visibility VARCHAR(20) NOT NULL DEFAULT 'public' CHECK (visibility IN ('private', 'unlisted', 'public'))`,
+		`ALTER TABLE companions ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE`,
+
+		// Character card fields with no companion column, kept for lossless export
+		`ALTER TABLE companions ADD COLUMN IF NOT EXISTS card_extensions JSONB DEFAULT '{}'`,
+
+		// Companion revisions: a persona snapshot per edit, conversations optionally pinned to one
+		`CREATE TABLE IF NOT EXISTS companion_revisions (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			companion_id UUID NOT NULL REFERENCES companions(id) ON DELETE CASCADE,
+			revision INTEGER NOT NULL,
+			snapshot JSONB NOT NULL,
+			edited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(companion_id, revision)
+		)`,
+		`INSERT INTO companion_revisions (companion_id, revision, snapshot, edited_by)
+		SELECT c.id, 1, jsonb_build_object(
+			'name', c.name, 'category', c.category, 'bio', COALESCE(c.bio, ''), 'avatarUrl', c.avatar_url,
+			'personality', COALESCE(c.personality_json, '{}'), 'tags', COALESCE(to_jsonb(c.tags), '[]'),
+			'age', c.age, 'scenario', c.scenario, 'greeting', c.greeting,
+			'communicationStyle', COALESCE(c.communication_style, 'friendly'),
+			'interests', COALESCE(to_jsonb(c.interests), '[]'),
+			'appearance', COALESCE(c.appearance_json, '{}'), 'voice', COALESCE(c.voice_json, '{}')
+		), c.created_by
+		FROM companions c
+		WHERE NOT EXISTS (SELECT 1 FROM companion_revisions r WHERE r.companion_id = c.id)`,
+		`ALTER TABLE conversations ADD COLUMN IF NOT EXISTS companion_revision_id UUID REFERENCES companion_revisions(id) ON DELETE SET NULL`,
+
+		// Full-text search over name, tags, interests and bio, maintained by a trigger
+		// (array_to_string is not immutable, so a generated column cannot be used)
+		`ALTER TABLE companions ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+		`CREATE OR REPLACE FUNCTION companions_search_vector_update() RETURNS trigger AS $$
+		BEGIN
+			NEW.search_vector :=
+				setweight(to_tsvector('english', COALESCE(NEW.name, '')), 'A') ||
+				setweight(to_tsvector('english', array_to_string(COALESCE(NEW.tags, '{}'), ' ')), 'B') ||
+				setweight(to_tsvector('english', array_to_string(COALESCE(NEW.interests, '{}'), ' ')), 'C') ||
+				setweight(to_tsvector('english', COALESCE(NEW.bio, '')), 'D');
+			RETURN NEW;
+		END
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS companions_search_vector ON companions`,
+		`CREATE TRIGGER companions_search_vector
+		BEFORE INSERT OR UPDATE OF name, bio, tags, interests ON companions
+		FOR EACH ROW EXECUTE FUNCTION companions_search_vector_update()`,
+		// Touching name fires the trigger for rows created before it existed
+		`UPDATE companions SET name = name WHERE search_vector IS NULL`,
+
+		// Per-companion popularity, refreshed by services.StatsService
+		`CREATE TABLE IF NOT EXISTS companion_stats (
+			companion_id UUID PRIMARY KEY REFERENCES companions(id) ON DELETE CASCADE,
+			messages_total BIGINT NOT NULL DEFAULT 0,
+			unique_chatters INTEGER NOT NULL DEFAULT 0,
+			story_views INTEGER NOT NULL DEFAULT 0,
+			trending_score DOUBLE PRECISION NOT NULL DEFAULT 0,
+			computed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// Messages each user sent each companion, refreshed with the stats for recommendations
+		`CREATE TABLE IF NOT EXISTS chat_interactions (
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			companion_id UUID NOT NULL REFERENCES companions(id) ON DELETE CASCADE,
+			messages BIGINT NOT NULL,
+			PRIMARY KEY (user_id, companion_id)
+		)`,
+
+		// Favorites, ratings and reviews
+		`CREATE TABLE IF NOT EXISTS favorites (
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			companion_id UUID NOT NULL REFERENCES companions(id) ON DELETE CASCADE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, companion_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS reviews (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			companion_id UUID NOT NULL REFERENCES companions(id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+			body TEXT NOT NULL DEFAULT '',
+			status VARCHAR(20) NOT NULL DEFAULT 'visible' CHECK (status IN ('visible', 'hidden')),
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE,
+			UNIQUE(companion_id, user_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS review_reports (
+			review_id UUID NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			reason TEXT NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (review_id, user_id)
+		)`,
+		// Set when an admin hides or restores the review; resolved reports no longer count
+		`ALTER TABLE review_reports ADD COLUMN IF NOT EXISTS resolved_at TIMESTAMP WITH TIME ZONE`,
+		`ALTER TABLE companions ADD COLUMN IF NOT EXISTS rating_average DOUBLE PRECISION DEFAULT 0`,
+		`ALTER TABLE companions ADD COLUMN IF NOT EXISTS rating_count INTEGER DEFAULT 0`,
+
+		// Managed categories and tags, replacing the fixed category CHECK constraint
+		`CREATE TABLE IF NOT EXISTS categories (
+			slug VARCHAR(50) PRIMARY KEY,
+			display_name VARCHAR(50) NOT NULL,
+			sort_order INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`INSERT INTO categories (slug, display_name, sort_order)
+		SELECT * FROM (VALUES ('girls', 'Girls', 1), ('guys', 'Guys', 2), ('anime', 'Anime', 3)) v
+		WHERE NOT EXISTS (SELECT 1 FROM categories)`,
+		`ALTER TABLE companions DROP CONSTRAINT IF EXISTS companions_category_check`,
+		`ALTER TABLE companions ALTER COLUMN category TYPE VARCHAR(50)`,
+		`INSERT INTO categories (slug, display_name)
+		SELECT DISTINCT category, initcap(category) FROM companions
+		ON CONFLICT DO NOTHING`,
+		`DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'companions_category_fkey') THEN
+				ALTER TABLE companions ADD CONSTRAINT companions_category_fkey
+					FOREIGN KEY (category) REFERENCES categories(slug) ON UPDATE CASCADE;
+			END IF;
+		END $$`,
+		`CREATE TABLE IF NOT EXISTS tags (
+			slug VARCHAR(50) PRIMARY KEY,
+			display_name VARCHAR(50) NOT NULL,
+			sort_order INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS tag_synonyms (
+			synonym VARCHAR(50) PRIMARY KEY,
+			tag_slug VARCHAR(50) NOT NULL REFERENCES tags(slug) ON DELETE CASCADE ON UPDATE CASCADE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// The creator's suggested tags, on first run only so admin deletions stick
+		`INSERT INTO tags (slug, display_name, sort_order)
+		SELECT * FROM (VALUES
+			('empathetic', 'Empathetic', 1), ('witty', 'Witty', 2), ('playful', 'Playful', 3),
+			('creative', 'Creative', 4), ('adventurous', 'Adventurous', 5), ('romantic', 'Romantic', 6),
+			('intellectual', 'Intellectual', 7), ('mysterious', 'Mysterious', 8), ('cheerful', 'Cheerful', 9),
+			('calm', 'Calm', 10), ('energetic', 'Energetic', 11), ('deep-thinker', 'Deep Thinker', 12),
+			('supportive', 'Supportive', 13), ('flirty', 'Flirty', 14), ('confident', 'Confident', 15),
+			('friendly', 'Friendly', 16)
+		) v
+		WHERE NOT EXISTS (SELECT 1 FROM tags)`,
+		// Tags already on companions (e.g. from seed.sql) become managed tags, slugged like slugify in the api package
+		`INSERT INTO tags (slug, display_name)
+		SELECT slug, MIN(t) FROM (
+			SELECT trim(both '-' FROM regexp_replace(regexp_replace(replace(lower(trim(t)), ' ', '-'), '[^a-z0-9-]', '', 'g'), '-+', '-', 'g')) AS slug, t
+			FROM companions, unnest(tags) t
+		) s
+		WHERE slug <> '' AND NOT EXISTS (SELECT 1 FROM tag_synonyms WHERE synonym = s.slug)
+		GROUP BY slug
+		ON CONFLICT DO NOTHING`,
+
+		// Companion galleries; companions.gallery_urls mirrors the unlocked items
+		`CREATE TABLE IF NOT EXISTS gallery_items (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			companion_id UUID NOT NULL REFERENCES companions(id) ON DELETE CASCADE,
+			url TEXT NOT NULL,
+			storage_key TEXT,
+			mime_type VARCHAR(100),
+			width INTEGER,
+			height INTEGER,
+			caption TEXT NOT NULL DEFAULT '',
+			position INTEGER NOT NULL DEFAULT 0,
+			unlock_level INTEGER NOT NULL DEFAULT 0,
+			source VARCHAR(20) NOT NULL DEFAULT 'upload' CHECK (source IN ('upload', 'generated')),
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`INSERT INTO gallery_items (companion_id, url, position)
+		SELECT c.id, g.url, g.ord - 1 FROM companions c, unnest(c.gallery_urls) WITH ORDINALITY g(url, ord)
+		WHERE NOT EXISTS (SELECT 1 FROM gallery_items i WHERE i.companion_id = c.id)`,
+
+		// User personas: who the user chats as, one of them the default
+		`CREATE TABLE IF NOT EXISTS user_personas (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			display_name VARCHAR(100) NOT NULL,
+			pronouns VARCHAR(50) NOT NULL DEFAULT '',
+			description TEXT NOT NULL DEFAULT '',
+			preferences TEXT[] NOT NULL DEFAULT '{}',
+			is_default BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE conversations ADD COLUMN IF NOT EXISTS persona_id UUID REFERENCES user_personas(id) ON DELETE SET NULL`,
+
+		// Knowledge base documents, split into chunks retrieved into the prompt
+		`CREATE TABLE IF NOT EXISTS knowledge_documents (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			companion_id UUID NOT NULL REFERENCES companions(id) ON DELETE CASCADE,
+			title VARCHAR(200) NOT NULL,
+			filename VARCHAR(255) NOT NULL,
+			mime_type VARCHAR(100) NOT NULL,
+			content TEXT NOT NULL,
+			size_bytes INTEGER NOT NULL,
+			chunk_count INTEGER NOT NULL DEFAULT 0,
+			embedded BOOLEAN NOT NULL DEFAULT FALSE,
+			created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS knowledge_chunks (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			document_id UUID NOT NULL REFERENCES knowledge_documents(id) ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			embedding DOUBLE PRECISION[]
+		)`,
+
+		// Per-message metadata, such as the knowledge citations of AI replies
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}'`,
+
+		// Lorebook entries, inserted into the system prompt when their keywords come up
+		`CREATE TABLE IF NOT EXISTS lorebook_entries (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			companion_id UUID NOT NULL REFERENCES companions(id) ON DELETE CASCADE,
+			keywords TEXT[] NOT NULL DEFAULT '{}',
+			content TEXT NOT NULL,
+			priority INTEGER NOT NULL DEFAULT 0,
+			always_on BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+
+		// Conversation threads: several named conversations per user and companion
+		`ALTER TABLE conversations DROP CONSTRAINT IF EXISTS conversations_user_id_companion_id_key`,
+		`ALTER TABLE conversations ADD COLUMN IF NOT EXISTS title VARCHAR(100) NOT NULL DEFAULT ''`,
+		`ALTER TABLE conversations ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP WITH TIME ZONE`,
+
+		// Read markers: how far each user has read in their conversations
+		`CREATE TABLE IF NOT EXISTS conversation_reads (
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			conversation_id UUID NOT NULL REFERENCES conversations(id) ON DELETE CASCADE,
+			last_read_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, conversation_id)
+		)`,
+
+		// Delivery and read receipts
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMP WITH TIME ZONE`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS read_at TIMESTAMP WITH TIME ZONE`,
+
+		// Message edits, regenerations and soft deletes; replaced versions are kept as revisions
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP WITH TIME ZONE`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE`,
+		`CREATE TABLE IF NOT EXISTS message_revisions (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			content TEXT NOT NULL,
+			metadata JSONB NOT NULL DEFAULT '{}',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE message_attachments ADD COLUMN IF NOT EXISTS revision_id UUID REFERENCES message_revisions(id) ON DELETE CASCADE`,
+
+		// Message trees: each message follows its parent, and a conversation shows the branch ending at its active leaf
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES messages(id) ON DELETE CASCADE`,
+		`ALTER TABLE conversations ADD COLUMN IF NOT EXISTS active_leaf_id UUID REFERENCES messages(id) ON DELETE SET NULL`,
+		// Chain the messages of conversations from before branching in order, once
+		`UPDATE messages m SET parent_id = chain.prev_id
+		FROM (
+			SELECT msg.id, LAG(msg.id) OVER (PARTITION BY msg.conversation_id ORDER BY msg.created_at, msg.id) AS prev_id
+			FROM messages msg JOIN conversations conv ON conv.id = msg.conversation_id
+			WHERE conv.active_leaf_id IS NULL
+		) chain
+		WHERE m.id = chain.id AND chain.prev_id IS NOT NULL AND m.parent_id IS NULL`,
+		`UPDATE conversations conv SET active_leaf_id = (
+			SELECT id FROM messages WHERE conversation_id = conv.id ORDER BY created_at DESC, id DESC LIMIT 1
+		) WHERE conv.active_leaf_id IS NULL`,
+
+		// Emoji reactions and thumbs up/down feedback on companion replies. Feedback keeps the
+		// provider, model and prompt version of the reply; regenerating a reply moves its feedback
+		// to the replaced revision.
+		`CREATE TABLE IF NOT EXISTS message_reactions (
+			message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			emoji VARCHAR(32) NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (message_id, user_id, emoji)
+		)`,
+		`CREATE TABLE IF NOT EXISTS message_feedback (
+			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+			message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			revision_id UUID REFERENCES message_revisions(id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			rating VARCHAR(4) NOT NULL CHECK (rating IN ('up', 'down')),
+			reasons TEXT[] NOT NULL DEFAULT '{}',
+			comment TEXT NOT NULL DEFAULT '',
+			provider VARCHAR(50) NOT NULL DEFAULT '',
+			model VARCHAR(100) NOT NULL DEFAULT '',
+			prompt_version VARCHAR(50) NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE
+		)`,
+		// The mood, lore and knowledge passages an AI reply's system prompt was built with, so training
+		// data can rebuild it; kept apart from the metadata clients see
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS prompt_context JSONB NOT NULL DEFAULT '{}'`,
+
 		// Indexes
 		`CREATE INDEX IF NOT EXISTS idx_stories_companion_id ON stories(companion_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_story_views_user_id ON story_views(user_id)`,
@@ -170,6 +495,26 @@ func RunMigrations(db *sql.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_moods_user_id ON moods(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_public_conversations_session ON public_conversations(session_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_public_messages_conversation ON public_messages(conversation_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_message_attachments_message ON message_attachments(message_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_companions_created_by ON companions(created_by)`,
+		`CREATE INDEX IF NOT EXISTS idx_companions_search_vector ON companions USING GIN(search_vector)`,
+		`CREATE INDEX IF NOT EXISTS idx_companion_stats_trending ON companion_stats(trending_score DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_interactions_companion ON chat_interactions(companion_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_favorites_companion_id ON favorites(companion_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_reviews_companion_id ON reviews(companion_id, created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_tag_synonyms_tag_slug ON tag_synonyms(tag_slug)`,
+		`CREATE INDEX IF NOT EXISTS idx_gallery_items_companion ON gallery_items(companion_id, position)`,
+		`CREATE INDEX IF NOT EXISTS idx_lorebook_entries_companion ON lorebook_entries(companion_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_knowledge_documents_companion ON knowledge_documents(companion_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_knowledge_chunks_document ON knowledge_chunks(document_id, position)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_personas_user ON user_personas(user_id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_user_personas_default ON user_personas(user_id) WHERE is_default`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_conversation_created ON messages(conversation_id, created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_message_revisions_message ON message_revisions(message_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_parent ON messages(parent_id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_message_feedback_current ON message_feedback(message_id, user_id) WHERE revision_id IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_message_feedback_source ON message_feedback(provider, model, prompt_version)`,
 	}
 
 	for _, migration := range migrations {
@@ -29,30 +29,97 @@ type User struct {
 	Username  string    `json:"username" db:"username"`
 	Password  string    `json:"-" db:"password_hash"`
 	AvatarURL *string   `json:"avatarUrl,omitempty" db:"avatar_url"`
+	Role      string    `json:"role" db:"role"` // "user" or "admin"
 	CreatedAt time.Time `json:"createdAt" db:"created_at"`
 }
 
+// UserPersona is who a user chats as: how companions address them and what they know about them
+type UserPersona struct {
+	ID          string     `json:"id" db:"id"`
+	UserID      string     `json:"userId" db:"user_id"`
+	DisplayName string     `json:"displayName" db:"display_name"`
+	Pronouns    string     `json:"pronouns" db:"pronouns"`
+	Description string     `json:"description" db:"description"`
+	Preferences []string   `json:"preferences" db:"preferences"`
+	IsDefault   bool       `json:"isDefault" db:"is_default"` // Used for conversations with no persona picked
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty" db:"updated_at"`
+}
+
 // Companion represents an AI companion
 type Companion struct {
-	ID                 string    `json:"id" db:"id"`
-	Name               string    `json:"name" db:"name"`
-	Category           string    `json:"category" db:"category"`
-	Bio                string    `json:"bio" db:"bio"`
-	AvatarURL          string    `json:"avatar" db:"avatar_url"`
-	PersonalityJSON    JSONB     `json:"personality" db:"personality_json"`
-	Tags               []string  `json:"tags"`
-	Age                int       `json:"age" db:"age"`
-	Status             string    `json:"status" db:"status"`
-	Style              string    `json:"style" db:"style"`
-	Scenario           *string   `json:"scenario,omitempty" db:"scenario"`
-	Greeting           *string   `json:"greeting,omitempty" db:"greeting"`
-	AppearanceJSON     JSONB     `json:"appearance,omitempty" db:"appearance_json"`
-	Interests          []string  `json:"interests,omitempty"`
-	CommunicationStyle string    `json:"communicationStyle" db:"communication_style"`
-	GalleryURLs        []string  `json:"galleryUrls,omitempty"`
-	IsFeatured         bool      `json:"isFeatured" db:"is_featured"`
-	MessageCount       int       `json:"messageCount" db:"message_count"`
-	CreatedAt          time.Time `json:"createdAt" db:"created_at"`
+	ID                 string          `json:"id" db:"id"`
+	Name               string          `json:"name" db:"name"`
+	Category           string          `json:"category" db:"category"`
+	Bio                string          `json:"bio" db:"bio"`
+	AvatarURL          string          `json:"avatar" db:"avatar_url"`
+	PersonalityJSON    JSONB           `json:"personality" db:"personality_json"`
+	Tags               []string        `json:"tags"`
+	Age                int             `json:"age" db:"age"`
+	Status             string          `json:"status" db:"status"`
+	Style              string          `json:"style" db:"style"`
+	Scenario           *string         `json:"scenario,omitempty" db:"scenario"`
+	Greeting           *string         `json:"greeting,omitempty" db:"greeting"`
+	AppearanceJSON     JSONB           `json:"appearance,omitempty" db:"appearance_json"`
+	Interests          []string        `json:"interests,omitempty"`
+	CommunicationStyle string          `json:"communicationStyle" db:"communication_style"`
+	GalleryURLs        []string        `json:"galleryUrls,omitempty"`
+	VoiceJSON          JSONB           `json:"voice,omitempty" db:"voice_json"`
+	CardExtensions     JSONB           `json:"cardExtensions,omitempty" db:"card_extensions"` // Character card fields with no companion equivalent
+	IsFeatured         bool            `json:"isFeatured" db:"is_featured"`
+	MessageCount       int             `json:"messageCount" db:"message_count"`
+	RatingAverage      float64         `json:"ratingAverage" db:"rating_average"` // Mean of visible reviews
+	RatingCount        int             `json:"ratingCount" db:"rating_count"`
+	IsFavorite         *bool           `json:"isFavorite,omitempty"` // Set for signed-in viewers of a single companion
+	CreatedBy          *string         `json:"createdBy,omitempty" db:"created_by"`
+	Visibility         string          `json:"visibility" db:"visibility"` // private, unlisted or public
+	CreatedAt          time.Time       `json:"createdAt" db:"created_at"`
+	UpdatedAt          *time.Time      `json:"updatedAt,omitempty" db:"updated_at"`
+	Stats              *CompanionStats `json:"stats,omitempty"`
+}
+
+// CompanionStats holds popularity metrics aggregated from chats and story views
+type CompanionStats struct {
+	MessageCount   int64      `json:"messageCount" db:"messages_total"`
+	UniqueChatters int        `json:"uniqueChatters" db:"unique_chatters"`
+	StoryViews     int        `json:"storyViews" db:"story_views"`
+	TrendingScore  float64    `json:"trendingScore" db:"trending_score"`
+	ComputedAt     *time.Time `json:"computedAt,omitempty" db:"computed_at"`
+}
+
+// CompanionRevision is a snapshot of a companion's persona after an edit
+type CompanionRevision struct {
+	ID          string    `json:"id" db:"id"`
+	CompanionID string    `json:"companionId" db:"companion_id"`
+	Revision    int       `json:"revision" db:"revision"`
+	Snapshot    JSONB     `json:"snapshot" db:"snapshot"`
+	EditedBy    *string   `json:"editedBy,omitempty" db:"edited_by"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+}
+
+// CompanionSnapshot is the persona stored in a companion revision's snapshot.
+// The JSON keys match the backfill in db.RunMigrations.
+type CompanionSnapshot struct {
+	Name               string   `json:"name"`
+	Category           string   `json:"category"`
+	Bio                string   `json:"bio"`
+	AvatarURL          string   `json:"avatarUrl"`
+	Personality        JSONB    `json:"personality"`
+	Tags               []string `json:"tags"`
+	Age                int      `json:"age"`
+	Scenario           *string  `json:"scenario"`
+	Greeting           *string  `json:"greeting"`
+	CommunicationStyle string   `json:"communicationStyle"`
+	Interests          []string `json:"interests"`
+	Appearance         JSONB    `json:"appearance"`
+	Voice              JSONB    `json:"voice"`
+}
+
+// RevisionChange is one field that differs between two companion revisions
+type RevisionChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
 }
 
 // Appearance represents companion appearance traits
@@ -95,23 +162,149 @@ type StoryView struct {
 	ViewedAt time.Time `json:"viewedAt" db:"viewed_at"`
 }
 
-// Conversation represents a chat conversation
+// Conversation represents a chat thread; a user may have several with the same companion
 type Conversation struct {
-	ID          string    `json:"id" db:"id"`
-	UserID      string    `json:"userId" db:"user_id"`
-	CompanionID string    `json:"companionId" db:"companion_id"`
-	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+	ID                  string     `json:"id" db:"id"`
+	UserID              string     `json:"userId" db:"user_id"`
+	CompanionID         string     `json:"companionId" db:"companion_id"`
+	Title               string     `json:"title" db:"title"`
+	CompanionRevisionID *string    `json:"companionRevisionId,omitempty" db:"companion_revision_id"` // Persona the conversation is pinned to; nil follows the latest edit
+	PersonaID           *string    `json:"personaId,omitempty" db:"persona_id"`                      // User persona chatted as; nil uses the user's default
+	ActiveLeafID        *string    `json:"activeLeafId,omitempty" db:"active_leaf_id"`               // Last message of the active branch
+	ArchivedAt          *time.Time `json:"archivedAt,omitempty" db:"archived_at"`
+	CreatedAt           time.Time  `json:"createdAt" db:"created_at"`
+}
+
+// ConversationSummary is an inbox entry: a thread with its companion, latest message and unread count
+type ConversationSummary struct {
+	Conversation
+	Companion      CompanionSummary `json:"companion"`
+	LastMessage    *MessagePreview  `json:"lastMessage,omitempty"` // Nil for threads without messages
+	LastActivityAt time.Time        `json:"lastActivityAt"`        // Latest message, or when the thread was created
+	UnreadCount    int              `json:"unreadCount"`           // Companion messages after the user's read marker
+}
+
+// CompanionSummary is the part of a companion shown in lists
+type CompanionSummary struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar"`
+}
+
+// MessagePreview is the start of a message shown in lists
+type MessagePreview struct {
+	Sender  string `json:"sender"`
+	Preview string `json:"preview"`
 }
 
 // Message represents a chat message
 type Message struct {
-	ID             string    `json:"id" db:"id"`
-	ConversationID string    `json:"conversationId" db:"conversation_id"`
-	Sender         string    `json:"sender" db:"sender"`
-	Content        string    `json:"content" db:"content"`
+	ID             string           `json:"id" db:"id"`
+	ConversationID string           `json:"conversationId" db:"conversation_id"`
+	ParentID       *string          `json:"parentId,omitempty" db:"parent_id"` // Previous message on its branch; nil for the first
+	Sender         string           `json:"sender" db:"sender"`
+	Content        string           `json:"content" db:"content"`
+	ImageURL       *string          `json:"imageUrl,omitempty"` // The first image attachment, for older clients
+	Attachments    []Attachment     `json:"attachments,omitempty"`
+	Metadata       JSONB            `json:"metadata,omitempty" db:"metadata"`        // e.g. the knowledge citations of AI replies
+	DeliveredAt    *time.Time       `json:"deliveredAt,omitempty" db:"delivered_at"` // When the recipient received it
+	ReadAt         *time.Time       `json:"readAt,omitempty" db:"read_at"`           // When the recipient read it; for user messages, when the companion replied
+	EditedAt       *time.Time       `json:"editedAt,omitempty" db:"edited_at"`       // When the content last changed by an edit or regeneration
+	Reactions      []ReactionCount  `json:"reactions,omitempty"`
+	Feedback       *MessageFeedback `json:"feedback,omitempty"` // The viewer's rating of a companion reply
+	CreatedAt      time.Time        `json:"createdAt" db:"created_at"`
+}
+
+// MessageReaction is an emoji a user put on a companion message
+type MessageReaction struct {
+	ConversationID string    `json:"conversationId"`
+	MessageID      string    `json:"messageId" db:"message_id"`
+	UserID         string    `json:"userId" db:"user_id"`
+	Emoji          string    `json:"emoji" db:"emoji"`
 	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
 }
 
+// ReactionCount is how many users reacted to a message with an emoji
+type ReactionCount struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"` // Whether the viewer is one of them
+}
+
+// MessageFeedback is a user's thumbs up or down on a companion reply, tied to the provider,
+// model and prompt version that produced it
+type MessageFeedback struct {
+	ID            string     `json:"id" db:"id"`
+	MessageID     string     `json:"messageId" db:"message_id"`
+	UserID        string     `json:"userId" db:"user_id"`
+	Rating        string     `json:"rating" db:"rating"` // up or down
+	Reasons       []string   `json:"reasons" db:"reasons"`
+	Comment       string     `json:"comment,omitempty" db:"comment"`
+	Provider      string     `json:"provider" db:"provider"`
+	Model         string     `json:"model,omitempty" db:"model"`
+	PromptVersion string     `json:"promptVersion,omitempty" db:"prompt_version"`
+	CreatedAt     time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt     *time.Time `json:"updatedAt,omitempty" db:"updated_at"`
+}
+
+// FeedbackStats aggregates reply feedback for one provider, model and prompt version
+type FeedbackStats struct {
+	Provider      string         `json:"provider"`
+	Model         string         `json:"model"`
+	PromptVersion string         `json:"promptVersion"`
+	Up            int            `json:"up"`
+	Down          int            `json:"down"`
+	Approval      float64        `json:"approval"` // Share of ratings that are thumbs up
+	Reasons       map[string]int `json:"reasons"`  // How often each reason was given
+}
+
+// MessageRevision is an earlier version of a message, kept when it is edited or regenerated
+type MessageRevision struct {
+	ID          string       `json:"id" db:"id"`
+	MessageID   string       `json:"messageId" db:"message_id"`
+	Content     string       `json:"content" db:"content"`
+	Metadata    JSONB        `json:"metadata,omitempty" db:"metadata"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	CreatedAt   time.Time    `json:"createdAt" db:"created_at"` // When this version was replaced
+}
+
+// MessagesDeleted reports messages of a conversation that were deleted
+type MessagesDeleted struct {
+	ConversationID string    `json:"conversationId"`
+	MessageIDs     []string  `json:"messageIds"`
+	DeletedAt      time.Time `json:"deletedAt"`
+}
+
+// BranchSwitched reports the new active branch of a conversation
+type BranchSwitched struct {
+	ConversationID string `json:"conversationId"`
+	ActiveLeafID   string `json:"activeLeafId"`
+}
+
+// MessageReceipt reports messages of a conversation delivered to or read by their recipient
+type MessageReceipt struct {
+	ConversationID string    `json:"conversationId"`
+	MessageIDs     []string  `json:"messageIds"`
+	Reader         string    `json:"reader"` // user or companion
+	At             time.Time `json:"at"`
+}
+
+// Attachment represents media attached to a chat message
+type Attachment struct {
+	ID         string    `json:"id" db:"id"`
+	MessageID  *string   `json:"messageId,omitempty" db:"message_id"`
+	UserID     *string   `json:"userId,omitempty" db:"user_id"`
+	Kind       string    `json:"kind" db:"kind"` // image, audio, video, sticker
+	URL        string    `json:"url" db:"url"`
+	StorageKey *string   `json:"storageKey,omitempty" db:"storage_key"`
+	MimeType   *string   `json:"mimeType,omitempty" db:"mime_type"`
+	Width      *int      `json:"width,omitempty" db:"width"`
+	Height     *int      `json:"height,omitempty" db:"height"`
+	SizeBytes  *int64    `json:"sizeBytes,omitempty" db:"size_bytes"`
+	DurationMs *int      `json:"durationMs,omitempty" db:"duration_ms"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+}
+
 // Memory represents a user's memory with a companion
 type Memory struct {
 	ID          string    `json:"id" db:"id"`
@@ -122,6 +315,120 @@ type Memory struct {
 	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
 }
 
+// LorebookEntry is world info about a companion, added to the system prompt when one of its
+// keywords appears in recent messages, or always if AlwaysOn is set
+type LorebookEntry struct {
+	ID          string     `json:"id" db:"id"`
+	CompanionID string     `json:"companionId" db:"companion_id"`
+	Keywords    []string   `json:"keywords" db:"keywords"`
+	Content     string     `json:"content" db:"content"`
+	Priority    int        `json:"priority" db:"priority"` // Higher priorities win when the budget runs out
+	AlwaysOn    bool       `json:"alwaysOn" db:"always_on"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty" db:"updated_at"`
+}
+
+// KnowledgeDocument is a text or markdown document in a companion's knowledge base
+type KnowledgeDocument struct {
+	ID          string    `json:"id" db:"id"`
+	CompanionID string    `json:"companionId" db:"companion_id"`
+	Title       string    `json:"title" db:"title"`
+	Filename    string    `json:"filename" db:"filename"`
+	MimeType    string    `json:"mimeType" db:"mime_type"`
+	SizeBytes   int       `json:"sizeBytes" db:"size_bytes"`
+	ChunkCount  int       `json:"chunkCount" db:"chunk_count"`
+	Embedded    bool      `json:"embedded" db:"embedded"` // Whether its chunks have embeddings for semantic retrieval
+	CreatedBy   *string   `json:"createdBy,omitempty" db:"created_by"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+}
+
+// KnowledgeCitation records a knowledge chunk retrieved into the prompt for a reply
+type KnowledgeCitation struct {
+	DocumentID string  `json:"documentId"`
+	Title      string  `json:"title"`
+	ChunkID    string  `json:"chunkId"`
+	Position   int     `json:"position"`
+	Score      float64 `json:"score"`
+}
+
+// KnowledgeSearchResult is a chunk matched by a knowledge base search
+type KnowledgeSearchResult struct {
+	KnowledgeCitation
+	Content string `json:"content"`
+}
+
+// AvatarURLs are the URLs of the rendered sizes of an uploaded avatar
+type AvatarURLs struct {
+	Thumb string `json:"thumb"`
+	Card  string `json:"card"`
+	Full  string `json:"full"`
+}
+
+// CompanionAvatarResponse is returned after uploading a companion's avatar
+type CompanionAvatarResponse struct {
+	Companion *Companion  `json:"companion"`
+	Avatar    *AvatarURLs `json:"avatar"`
+}
+
+// GalleryItem is an image in a companion's gallery.
+// Items with an unlock level above 1 are locked until the viewer reaches that relationship level.
+type GalleryItem struct {
+	ID          string    `json:"id" db:"id"`
+	CompanionID string    `json:"companionId" db:"companion_id"`
+	URL         string    `json:"url,omitempty" db:"url"` // Empty while locked for the viewer
+	StorageKey  *string   `json:"-" db:"storage_key"`
+	MimeType    *string   `json:"mimeType,omitempty" db:"mime_type"`
+	Width       *int      `json:"width,omitempty" db:"width"`
+	Height      *int      `json:"height,omitempty" db:"height"`
+	Caption     string    `json:"caption" db:"caption"`
+	Position    int       `json:"position" db:"position"`
+	UnlockLevel int       `json:"unlockLevel" db:"unlock_level"`
+	Locked      bool      `json:"locked"`
+	Source      string    `json:"source" db:"source"` // upload or generated
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+
+	// Messages the viewer needs to have sent the companion to unlock the item; set while it is locked
+	UnlockMessages int `json:"unlockMessages,omitempty"`
+}
+
+// Category is a managed companion category
+type Category struct {
+	Slug        string    `json:"slug" db:"slug"`
+	DisplayName string    `json:"displayName" db:"display_name"`
+	SortOrder   int       `json:"sortOrder" db:"sort_order"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+}
+
+// Tag is a managed companion tag; companions store its display name
+type Tag struct {
+	Slug        string    `json:"slug" db:"slug"`
+	DisplayName string    `json:"displayName" db:"display_name"`
+	SortOrder   int       `json:"sortOrder" db:"sort_order"`
+	Synonyms    []string  `json:"synonyms"` // Slugs that resolve to this tag
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+}
+
+// Review is a user's star rating of a companion with an optional text review
+type Review struct {
+	ID          string     `json:"id" db:"id"`
+	CompanionID string     `json:"companionId" db:"companion_id"`
+	UserID      string     `json:"userId" db:"user_id"`
+	Username    string     `json:"username"`
+	Rating      int        `json:"rating" db:"rating"`
+	Body        string     `json:"body" db:"body"`
+	Status      string     `json:"status" db:"status"` // visible or hidden
+	ReportCount int        `json:"reportCount" db:"report_count"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty" db:"updated_at"`
+}
+
+// RecommendedCompanion is a companion suggested to a user, with why it was picked
+type RecommendedCompanion struct {
+	Companion
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
 // Mood represents a user's mood setting
 type Mood struct {
 	ID        string    `json:"id" db:"id"`
@@ -132,6 +439,63 @@ type Mood struct {
 
 // API Request/Response types
 
+type GenerateGalleryItemRequest struct {
+	PhotoType   string `json:"photoType"` // selfie, portrait, full_body, candid, flirty, cute, romantic
+	Context     string `json:"context"`
+	Caption     string `json:"caption" binding:"max=500"`
+	UnlockLevel int    `json:"unlockLevel"` // 0 to services.MaxRelationshipLevel, checked by the handler
+}
+
+// UpdateGalleryItemRequest changes the fields present in the body
+type UpdateGalleryItemRequest struct {
+	Caption     *string `json:"caption" binding:"omitempty,max=500"`
+	UnlockLevel *int    `json:"unlockLevel"` // 0 to services.MaxRelationshipLevel, checked by the handler
+}
+
+type ReorderGalleryRequest struct {
+	ItemIDs []string `json:"itemIds" binding:"required"`
+}
+
+// LorebookEntryRequest creates a lorebook entry; entries need keywords unless they are always on
+type LorebookEntryRequest struct {
+	Keywords []string `json:"keywords" binding:"max=50,dive,max=100"`
+	Content  string   `json:"content" binding:"required,max=4000"`
+	Priority int      `json:"priority"`
+	AlwaysOn bool     `json:"alwaysOn"`
+}
+
+// UpdateLorebookEntryRequest changes the fields present in the body
+type UpdateLorebookEntryRequest struct {
+	Keywords *[]string `json:"keywords" binding:"omitempty,max=50,dive,max=100"`
+	Content  *string   `json:"content" binding:"omitempty,min=1,max=4000"`
+	Priority *int      `json:"priority"`
+	AlwaysOn *bool     `json:"alwaysOn"`
+}
+
+// TaxonomyRequest creates or updates a category or tag; the slug defaults to one made from the display name
+type TaxonomyRequest struct {
+	Slug        string `json:"slug" binding:"max=50"`
+	DisplayName string `json:"displayName" binding:"required,max=50"`
+	SortOrder   int    `json:"sortOrder"`
+}
+
+type TagSynonymRequest struct {
+	Synonym string `json:"synonym" binding:"required,max=50"`
+}
+
+type MergeTagRequest struct {
+	Into string `json:"into" binding:"required"`
+}
+
+type ReviewRequest struct {
+	Rating int    `json:"rating" binding:"required,min=1,max=5"`
+	Body   string `json:"body" binding:"max=4000"`
+}
+
+type ReportReviewRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
 type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Username string `json:"username" binding:"required,min=3,max=50"`
@@ -150,7 +514,7 @@ type AuthResponse struct {
 
 type CreateCompanionRequest struct {
 	Name        string      `json:"name" binding:"required"`
-	Category    string      `json:"category" binding:"required,oneof=girls guys anime"`
+	Category    string      `json:"category" binding:"required"` // A slug from the categories table
 	Bio         string      `json:"bio"`
 	AvatarURL   string      `json:"avatarUrl"`
 	Personality Personality `json:"personality"`
@@ -159,12 +523,95 @@ type CreateCompanionRequest struct {
 }
 
 type StartChatRequest struct {
-	CompanionID string `json:"companionId" binding:"required"`
+	CompanionID  string `json:"companionId" binding:"required"`
+	FollowLatest bool   `json:"followLatest"` // Don't pin a new conversation to the companion's current revision
+	PersonaID    string `json:"personaId"`    // Persona to chat as; empty uses the default, or keeps a resumed thread's
+}
+
+// PersonaRequest creates a persona or replaces its fields
+type PersonaRequest struct {
+	DisplayName string   `json:"displayName" binding:"required,max=100"`
+	Pronouns    string   `json:"pronouns" binding:"max=50"`
+	Description string   `json:"description" binding:"max=1000"`
+	Preferences []string `json:"preferences" binding:"max=20,dive,max=200"`
+	IsDefault   bool     `json:"isDefault"`
+}
+
+// CreateConversationRequest starts a new thread with a companion
+type CreateConversationRequest struct {
+	CompanionID  string `json:"companionId" binding:"required"`
+	Title        string `json:"title" binding:"max=100"`
+	FollowLatest bool   `json:"followLatest"` // Don't pin the thread to the companion's current revision
+	PersonaID    string `json:"personaId"`    // Persona to chat as; empty uses the default
+}
+
+// UpdateConversationRequest renames, archives or unarchives a thread; omitted fields are unchanged
+type UpdateConversationRequest struct {
+	Title    *string `json:"title" binding:"omitempty,max=100"`
+	Archived *bool   `json:"archived"`
+}
+
+// SetConversationPersonaRequest picks the persona for a conversation; empty uses the default
+type SetConversationPersonaRequest struct {
+	PersonaID string `json:"personaId"`
+}
+
+// PinRevisionRequest pins a conversation to a companion revision; 0 unpins it
+type PinRevisionRequest struct {
+	Revision int `json:"revision" binding:"min=0"`
 }
 
 type SendMessageRequest struct {
+	ConversationID string   `json:"conversationId" binding:"required"`
+	Content        string   `json:"content"`
+	AttachmentIDs  []string `json:"attachmentIds"`
+	Image          string   `json:"image"` // Optional base64 data URL of a photo for the companion to see
+	Voice          bool     `json:"voice"` // Ask the companion to reply with a voice note
+}
+
+// EditMessageRequest replaces the content of a user message
+type EditMessageRequest struct {
+	Content string `json:"content" binding:"required"`
+	Branch  bool   `json:"branch"` // Add the edit as a sibling branch instead of replacing the message
+}
+
+// ReactionRequest adds an emoji reaction to a companion message
+type ReactionRequest struct {
+	Emoji string `json:"emoji" binding:"required,max=32"`
+}
+
+// FeedbackRequest rates a companion reply, with optional reasons from a fixed list and a comment
+type FeedbackRequest struct {
+	Rating  string   `json:"rating" binding:"required,oneof=up down"`
+	Reasons []string `json:"reasons" binding:"max=5"`
+	Comment string   `json:"comment" binding:"max=1000"`
+}
+
+// RegenerateMessageRequest regenerates a companion reply
+type RegenerateMessageRequest struct {
+	Branch bool `json:"branch"` // Add the new reply as a sibling branch instead of replacing the message
+}
+
+// SwitchBranchRequest makes the branch through a message active
+type SwitchBranchRequest struct {
+	MessageID string `json:"messageId" binding:"required"`
+}
+
+// ForkConversationRequest starts a new thread from the path up to a message
+type ForkConversationRequest struct {
+	Title string `json:"title" binding:"max=100"`
+}
+
+// MessageSiblings lists the alternatives at a point of a conversation tree
+type MessageSiblings struct {
+	Siblings    []Message `json:"siblings"`    // Messages with the same parent, oldest first
+	ActiveIndex int       `json:"activeIndex"` // Index of the sibling on the active branch, or -1
+}
+
+// MarkReadRequest marks a conversation's companion messages read, up to and including messageId or all of them
+type MarkReadRequest struct {
 	ConversationID string `json:"conversationId" binding:"required"`
-	Content        string `json:"content" binding:"required"`
+	MessageID      string `json:"messageId"`
 }
 
 type SendMessageResponse struct {
@@ -188,6 +635,29 @@ type PaginatedResponse struct {
 	TotalPages int         `json:"totalPages"`
 }
 
+// CursorResponse is a page of results; pass nextCursor as the cursor parameter to get the next page
+type CursorResponse struct {
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"nextCursor,omitempty"` // Empty on the last page
+}
+
+// FacetCount is the number of search results sharing a facet value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// CompanionSearchResponse is a page of search results with facet counts
+type CompanionSearchResponse struct {
+	Data       []Companion             `json:"data"`
+	Total      int                     `json:"total"`
+	Page       int                     `json:"page"`
+	PageSize   int                     `json:"pageSize"`
+	TotalPages int                     `json:"totalPages"`
+	Sort       string                  `json:"sort"`
+	Facets     map[string][]FacetCount `json:"facets"`
+}
+
 type APIResponse struct {
 	Data    interface{} `json:"data,omitempty"`
 	Message string      `json:"message,omitempty"`
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// piiPatterns finds personal information that is replaced wholesale, in the order they are applied.
+// Emails and URLs go first so their digits are not taken for phone or card numbers.
+var piiPatterns = []struct {
+	pattern     *regexp.Regexp
+	placeholder string
+}{
+	{regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), "[email]"},
+	{regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`), "[url]"},
+	{regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), "[card number]"},
+	{regexp.MustCompile(`\+\d[\d\s.\-]{7,14}\d`), "[phone]"},
+	{regexp.MustCompile(`\(?\b\d{3}\)?[\s.\-]\d{3}[\s.\-]\d{4}\b`), "[phone]"},
+	{regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), "[ip]"},
+}
+
+// anonymizedUserName stands in for the user's own names
+const anonymizedUserName = "User"
+
+// Anonymizer replaces personal information in chat text with placeholders: emails, URLs,
+// card and phone numbers, IP addresses and the names the user goes by
+type Anonymizer struct {
+	names []string // Longest first, so a full name wins over a name it starts with
+}
+
+// NewAnonymizer creates an anonymizer that also replaces the given names, such as the user's
+// username and persona display names. Single-letter names are ignored.
+func NewAnonymizer(names ...string) *Anonymizer {
+	a := &Anonymizer{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		key := strings.ToLower(name)
+		if utf8.RuneCountInString(name) < 2 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		a.names = append(a.names, name)
+	}
+	sort.SliceStable(a.names, func(i, j int) bool {
+		return utf8.RuneCountInString(a.names[i]) > utf8.RuneCountInString(a.names[j])
+	})
+	return a
+}
+
+// Text anonymizes a piece of text
+func (a *Anonymizer) Text(s string) string {
+	for _, p := range piiPatterns {
+		s = p.pattern.ReplaceAllString(s, p.placeholder)
+	}
+	return a.replaceNames(s)
+}
+
+// isNameRune reports whether a rune continues a word, so a name next to it is part of a longer word.
+// Unlike regexp's \b this covers non-ASCII letters, as in "José" or "Zoë".
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r) || r == '_'
+}
+
+// replaceNames replaces the user's names where they appear as whole words, ignoring case
+func (a *Anonymizer) replaceNames(s string) string {
+	if len(a.names) == 0 {
+		return s
+	}
+
+	var b strings.Builder
+	prev := rune(-1)
+	for i := 0; i < len(s); {
+		if !isNameRune(prev) {
+			if n := a.nameAt(s[i:]); n > 0 {
+				b.WriteString(anonymizedUserName)
+				prev, _ = utf8.DecodeLastRuneInString(s[i : i+n])
+				i += n
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		b.WriteString(s[i : i+size])
+		prev = r
+		i += size
+	}
+	return b.String()
+}
+
+// nameAt returns the byte length of the user's name that s starts with as a whole word, or 0
+func (a *Anonymizer) nameAt(s string) int {
+	for _, name := range a.names {
+		// Take as many characters as the name has; case folding can change their byte length
+		n, count := 0, utf8.RuneCountInString(name)
+		for count > 0 && n < len(s) {
+			_, size := utf8.DecodeRuneInString(s[n:])
+			n += size
+			count--
+		}
+		if count > 0 || !strings.EqualFold(s[:n], name) {
+			continue
+		}
+		if next, _ := utf8.DecodeRuneInString(s[n:]); n < len(s) && isNameRune(next) {
+			continue
+		}
+		return n
+	}
+	return 0
+}
+
+// User anonymizes a user persona for prompt building
+func (a *Anonymizer) User(user *UserContext) *UserContext {
+	if user == nil {
+		return nil
+	}
+	anonymized := &UserContext{
+		DisplayName: anonymizedUserName,
+		Pronouns:    user.Pronouns,
+		Description: a.Text(user.Description),
+	}
+	for _, pref := range user.Preferences {
+		anonymized.Preferences = append(anonymized.Preferences, a.Text(pref))
+	}
+	return anonymized
+}
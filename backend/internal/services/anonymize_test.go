@@ -0,0 +1,68 @@
+package services
+
+import "testing"
+
+func TestAnonymizerText(t *testing.T) {
+	a := NewAnonymizer("sam_w", "Sam Whitfield", "Sam", "x")
+
+	tests := []struct {
+		in, want string
+	}{
+		{"mail me at sam.w+chat@example.co.uk!", "mail me at [email]!"},
+		{"see https://example.com/p?id=1 or www.example.org", "see [url] or [url]"},
+		{"call +44 7700 900123 tonight", "call [phone] tonight"},
+		{"my number is (555) 123-4567", "my number is [phone]"},
+		{"card 4111 1111 1111 1111 ok", "card [card number] ok"},
+		{"server at 192.168.0.12", "server at [ip]"},
+		{"I'm Sam Whitfield, call me sam or SAM_W", "I'm User, call me User or User"},
+		{"Samantha is my sister", "Samantha is my sister"},
+		{"x marks the spot in 2024", "x marks the spot in 2024"},
+	}
+
+	for _, tt := range tests {
+		if got := a.Text(tt.in); got != tt.want {
+			t.Errorf("Text(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAnonymizerNonASCIINames(t *testing.T) {
+	a := NewAnonymizer("José", "Zoë", "Élodie", "Zoë Müller")
+
+	tests := []struct {
+		in, want string
+	}{
+		{"hola, soy José!", "hola, soy User!"},
+		{"JOSÉ and josé", "User and User"},
+		{"Zoë Müller here, Zoë for short", "User here, User for short"},
+		{"Élodie,Élodie", "User,User"},
+		{"Josély and Zoës are other names", "Josély and Zoës are other names"},
+		{"ÉlodieÉlodie", "ÉlodieÉlodie"},
+	}
+
+	for _, tt := range tests {
+		if got := a.Text(tt.in); got != tt.want {
+			t.Errorf("Text(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAnonymizerUser(t *testing.T) {
+	a := NewAnonymizer("Robin")
+	user := a.User(&UserContext{
+		DisplayName: "Robin",
+		Pronouns:    "they/them",
+		Description: "Robin is a nurse, reach them at robin@example.com",
+		Preferences: []string{"likes hiking"},
+	})
+
+	if user.DisplayName != "User" || user.Pronouns != "they/them" {
+		t.Errorf("unexpected persona %+v", user)
+	}
+	if user.Description != "User is a nurse, reach them at [email]" {
+		t.Errorf("description not anonymized: %q", user.Description)
+	}
+	if a.User(nil) != nil {
+		t.Error("nil persona should stay nil")
+	}
+}
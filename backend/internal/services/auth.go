@@ -70,6 +70,7 @@ func (s *AuthService) Register(req *models.RegisterRequest) (*models.User, strin
 		ID:       uuid.New().String(),
 		Email:    req.Email,
 		Username: req.Username,
+		Role:     "user",
 	}
 
 	_, err = s.db.Exec(
@@ -95,10 +96,10 @@ func (s *AuthService) Login(req *models.LoginRequest) (*models.User, string, err
 	var passwordHash string
 
 	err := s.db.QueryRow(
-		`SELECT id, email, username, password_hash, avatar_url, created_at
+		`SELECT id, email, username, password_hash, avatar_url, role, created_at
 		FROM users WHERE email = $1`,
 		req.Email,
-	).Scan(&user.ID, &user.Email, &user.Username, &passwordHash, &user.AvatarURL, &user.CreatedAt)
+	).Scan(&user.ID, &user.Email, &user.Username, &passwordHash, &user.AvatarURL, &user.Role, &user.CreatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, "", ErrInvalidCredentials
@@ -125,9 +126,9 @@ func (s *AuthService) Login(req *models.LoginRequest) (*models.User, string, err
 func (s *AuthService) GetUserByID(id string) (*models.User, error) {
 	var user models.User
 	err := s.db.QueryRow(
-		`SELECT id, email, username, avatar_url, created_at FROM users WHERE id = $1`,
+		`SELECT id, email, username, avatar_url, role, created_at FROM users WHERE id = $1`,
 		id,
-	).Scan(&user.ID, &user.Email, &user.Username, &user.AvatarURL, &user.CreatedAt)
+	).Scan(&user.ID, &user.Email, &user.Username, &user.AvatarURL, &user.Role, &user.CreatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, ErrUserNotFound
@@ -139,6 +140,19 @@ func (s *AuthService) GetUserByID(id string) (*models.User, error) {
 	return &user, nil
 }
 
+// IsAdmin reports whether a user has the admin role
+func (s *AuthService) IsAdmin(userID string) (bool, error) {
+	var role string
+	err := s.db.QueryRow(`SELECT role FROM users WHERE id = $1`, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return false, ErrUserNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	return role == "admin", nil
+}
+
 // ValidateToken validates a JWT token and returns the user ID
 func (s *AuthService) ValidateToken(tokenString string) (string, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// maxAvatarPixels rejects images that would take too much memory to decode
+const maxAvatarPixels = 40_000_000
+
+// avatarJPEGQuality is the quality of JPEG avatar variants
+const avatarJPEGQuality = 85
+
+// avatarSize describes one rendered avatar size. Cropped sizes are cut to the
+// size's aspect ratio around the centre; the others keep the whole image.
+type avatarSize struct {
+	name   string
+	width  int
+	height int
+	crop   bool
+}
+
+// avatarSizes are the variants rendered for every avatar
+var avatarSizes = []avatarSize{
+	{name: "thumb", width: 128, height: 128, crop: true},
+	{name: "card", width: 400, height: 600, crop: true}, // The 2:3 portrait used by companion cards
+	{name: "full", width: 1024, height: 1024},
+}
+
+// AvatarVariant is one rendered size of an avatar
+type AvatarVariant struct {
+	Name     string
+	Data     []byte
+	MimeType string
+	Width    int
+	Height   int
+}
+
+// RenderAvatar decodes an uploaded image and renders the thumb, card and full variants.
+// Images are never scaled up. Re-encoding drops EXIF and other metadata; the EXIF
+// orientation of JPEGs is applied first so photos stay upright.
+// Opaque images are encoded as JPEG and images with transparency as PNG.
+func RenderAvatar(data []byte) ([]AvatarVariant, error) {
+	src, err := decodeAvatar(data)
+	if err != nil {
+		return nil, err
+	}
+
+	opaque := src.Opaque()
+	variants := make([]AvatarVariant, 0, len(avatarSizes))
+	for _, size := range avatarSizes {
+		crop := src.Bounds()
+		if size.crop {
+			crop = centreCrop(crop, size.width, size.height)
+		}
+		w, h := fitWithin(crop.Dx(), crop.Dy(), size.width, size.height)
+		img := resizeBox(src, crop, w, h)
+
+		var buf bytes.Buffer
+		variant := AvatarVariant{Name: size.name, Width: w, Height: h}
+		if opaque {
+			variant.MimeType = "image/jpeg"
+			err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: avatarJPEGQuality})
+		} else {
+			variant.MimeType = "image/png"
+			err = png.Encode(&buf, img)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s avatar: %w", size.name, err)
+		}
+		variant.Data = buf.Bytes()
+		variants = append(variants, variant)
+	}
+
+	return variants, nil
+}
+
+// RenderPortraitPNG renders an image as a PNG no larger than the full avatar variant, for
+// embedding character cards in
+func RenderPortraitPNG(data []byte) ([]byte, error) {
+	src, err := decodeAvatar(data)
+	if err != nil {
+		return nil, err
+	}
+
+	full := avatarSizes[len(avatarSizes)-1]
+	w, h := fitWithin(src.Bounds().Dx(), src.Bounds().Dy(), full.width, full.height)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, resizeBox(src, src.Bounds(), w, h)); err != nil {
+		return nil, fmt.Errorf("failed to encode portrait: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeAvatar decodes an image upright, rejecting images over maxAvatarPixels before
+// allocating them
+func decodeAvatar(data []byte) (*image.RGBA, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image format: %w", err)
+	}
+	if cfg.Width*cfg.Height > maxAvatarPixels {
+		return nil, fmt.Errorf("image is too large: %dx%d", cfg.Width, cfg.Height)
+	}
+
+	decoded, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, decoded.Bounds().Dx(), decoded.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+	if format == "jpeg" {
+		src = orient(src, jpegOrientation(data))
+	}
+	return src, nil
+}
+
+// centreCrop returns the largest rectangle with the aspect ratio w:h centred in r
+func centreCrop(r image.Rectangle, w, h int) image.Rectangle {
+	cw, ch := r.Dx(), r.Dy()
+	if cw*h > ch*w {
+		cw = ch * w / h
+	} else {
+		ch = cw * h / w
+	}
+	if cw < 1 {
+		cw = 1
+	}
+	if ch < 1 {
+		ch = 1
+	}
+	x := r.Min.X + (r.Dx()-cw)/2
+	y := r.Min.Y + (r.Dy()-ch)/2
+	return image.Rect(x, y, x+cw, y+ch)
+}
+
+// fitWithin scales w x h down to fit inside maxW x maxH, keeping the aspect ratio
+func fitWithin(w, h, maxW, maxH int) (int, int) {
+	if w <= maxW && h <= maxH {
+		return w, h
+	}
+	if w*maxH > h*maxW {
+		h = h * maxW / w
+		w = maxW
+	} else {
+		w = w * maxH / h
+		h = maxH
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+// resizeBox scales the crop area of src to w x h by averaging the source pixels under each target pixel
+func resizeBox(src *image.RGBA, crop image.Rectangle, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	cw, ch := crop.Dx(), crop.Dy()
+
+	for y := 0; y < h; y++ {
+		y0 := crop.Min.Y + y*ch/h
+		y1 := crop.Min.Y + (y+1)*ch/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0 := crop.Min.X + x*cw/w
+			x1 := crop.Min.X + (x+1)*cw/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[i])
+					g += uint32(src.Pix[i+1])
+					b += uint32(src.Pix[i+2])
+					a += uint32(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+
+			j := dst.PixOffset(x, y)
+			dst.Pix[j] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(b / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// orient applies an EXIF orientation (1-8) so the image displays upright without it
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	// Orientations 5-8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Flip horizontally
+				dx, dy = w-1-x, y
+			case 3: // Rotate 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // Flip vertically
+				dx, dy = x, h-1-y
+			case 5: // Transpose
+				dx, dy = y, x
+			case 6: // Rotate 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // Transverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotate 90° counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation tag of a JPEG, returning 1 (upright) if there is none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		// Start of scan: the metadata segments are over
+		if marker == 0xDA {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag (0x0112) from the first IFD of a TIFF-structured EXIF block
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for e := 0; e < entries; e++ {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			v := int(order.Uint16(tiff[entry+8 : entry+10]))
+			if v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
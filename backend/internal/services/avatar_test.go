@@ -0,0 +1,189 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func solidImage(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// jpegWithOrientation encodes img as a JPEG carrying an EXIF orientation tag
+func jpegWithOrientation(t *testing.T, img image.Image, orientation uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	data := buf.Bytes()
+
+	// Big-endian TIFF header, one IFD with a single SHORT orientation entry
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	tiff = append(append(tiff, entry...), 0, 0, 0, 0)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(payload)+2))
+	app1 = append(app1, payload...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
+
+func variantsByName(t *testing.T, data []byte) map[string]AvatarVariant {
+	t.Helper()
+	variants, err := RenderAvatar(data)
+	if err != nil {
+		t.Fatalf("RenderAvatar returned error: %v", err)
+	}
+	byName := make(map[string]AvatarVariant, len(variants))
+	for _, v := range variants {
+		byName[v.Name] = v
+	}
+	return byName
+}
+
+func TestRenderAvatarSizes(t *testing.T) {
+	variants := variantsByName(t, encodePNG(t, solidImage(1600, 1200, color.RGBA{R: 200, G: 40, B: 120, A: 255})))
+
+	want := map[string][2]int{"thumb": {128, 128}, "card": {400, 600}, "full": {1024, 768}}
+	for name, size := range want {
+		v, ok := variants[name]
+		if !ok {
+			t.Fatalf("missing %s variant", name)
+		}
+		if v.Width != size[0] || v.Height != size[1] {
+			t.Errorf("%s is %dx%d, want %dx%d", name, v.Width, v.Height, size[0], size[1])
+		}
+		if v.MimeType != "image/jpeg" {
+			t.Errorf("opaque %s should be JPEG, got %s", name, v.MimeType)
+		}
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(v.Data))
+		if err != nil || cfg.Width != size[0] || cfg.Height != size[1] {
+			t.Errorf("%s decodes as %dx%d (err %v)", name, cfg.Width, cfg.Height, err)
+		}
+	}
+}
+
+func TestRenderAvatarDoesNotUpscale(t *testing.T) {
+	variants := variantsByName(t, encodePNG(t, solidImage(90, 60, color.White)))
+
+	if v := variants["full"]; v.Width != 90 || v.Height != 60 {
+		t.Errorf("full is %dx%d, want the original 90x60", v.Width, v.Height)
+	}
+	if v := variants["card"]; v.Width != 40 || v.Height != 60 {
+		t.Errorf("card is %dx%d, want a 40x60 crop", v.Width, v.Height)
+	}
+}
+
+func TestRenderAvatarKeepsTransparency(t *testing.T) {
+	variants := variantsByName(t, encodePNG(t, solidImage(200, 200, color.RGBA{})))
+	if v := variants["thumb"]; v.MimeType != "image/png" {
+		t.Errorf("transparent thumb should be PNG, got %s", v.MimeType)
+	}
+}
+
+func TestRenderAvatarAppliesAndStripsEXIF(t *testing.T) {
+	data := jpegWithOrientation(t, solidImage(80, 40, color.Gray{Y: 128}), 6)
+	if got := jpegOrientation(data); got != 6 {
+		t.Fatalf("jpegOrientation = %d, want 6", got)
+	}
+
+	variants := variantsByName(t, data)
+	full := variants["full"]
+	if full.Width != 40 || full.Height != 80 {
+		t.Errorf("rotated full is %dx%d, want 40x80", full.Width, full.Height)
+	}
+	for name, v := range variants {
+		if bytes.Contains(v.Data, []byte("Exif")) {
+			t.Errorf("%s still carries EXIF", name)
+		}
+	}
+}
+
+func TestOrientRotatesPixels(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.RGBA{R: 255, A: 255})
+	src.Set(1, 0, color.RGBA{B: 255, A: 255})
+
+	// Turning clockwise puts the left pixel on top
+	dst := orient(src, 6)
+	if dst.Bounds().Dx() != 1 || dst.Bounds().Dy() != 2 {
+		t.Fatalf("rotated bounds %v", dst.Bounds())
+	}
+	if r, _, _, _ := dst.At(0, 0).RGBA(); r == 0 {
+		t.Error("expected the red pixel at the top after a clockwise turn")
+	}
+}
+
+func TestRenderAvatarRejectsNonImages(t *testing.T) {
+	if _, err := RenderAvatar([]byte("not an image")); err == nil {
+		t.Error("expected an error for non-image data")
+	}
+}
+
+func TestRenderPortraitPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, solidImage(2048, 1024, color.White), nil); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+
+	out, err := RenderPortraitPNG(buf.Bytes())
+	if err != nil {
+		t.Fatalf("RenderPortraitPNG returned error: %v", err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(out))
+	if err != nil || format != "png" {
+		t.Fatalf("portrait decodes as %q (err %v), want png", format, err)
+	}
+	if cfg.Width != 1024 || cfg.Height != 512 {
+		t.Errorf("portrait is %dx%d, want 1024x512", cfg.Width, cfg.Height)
+	}
+}
+
+func TestRenderPortraitPNGRejectsHugeImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, solidImage(8, 8, color.White), nil); err != nil {
+		t.Fatalf("jpeg.Encode: %v", err)
+	}
+	data := buf.Bytes()
+
+	// Declare 60000x60000 in the frame header without the pixel data to match
+	sof := bytes.Index(data, []byte{0xFF, 0xC0})
+	if sof < 0 {
+		t.Fatal("no SOF0 marker in encoded JPEG")
+	}
+	binary.BigEndian.PutUint16(data[sof+5:], 60000)
+	binary.BigEndian.PutUint16(data[sof+7:], 60000)
+
+	if _, err := RenderPortraitPNG(data); err == nil {
+		t.Error("expected an error for an image over the pixel limit")
+	}
+}
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// CharacterCardSpec identifies Tavern/SillyTavern Character Card V2 JSON
+const CharacterCardSpec = "chara_card_v2"
+
+// CharacterCardPNGKeyword is the tEXt chunk keyword holding the base64 card in PNG cards
+const CharacterCardPNGKeyword = "chara"
+
+var (
+	ErrNotCharacterCard = errors.New("not a character card")
+	ErrNoCardInPNG      = errors.New("PNG has no chara text chunk")
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// CharacterCard is a Character Card V2 document
+type CharacterCard struct {
+	Spec        string            `json:"spec"`
+	SpecVersion string            `json:"spec_version"`
+	Data        CharacterCardData `json:"data"`
+}
+
+// CharacterCardData holds the card fields we map onto companions.
+// Every other field (mes_example, character_book, extensions, ...) is kept verbatim in Extra.
+type CharacterCardData struct {
+	Name        string
+	Description string
+	Personality string
+	Scenario    string
+	FirstMes    string
+	Tags        []string
+	Extra       map[string]json.RawMessage
+}
+
+// cardDataFields are the V2 fields mapped onto CharacterCardData
+var cardDataFields = []string{"name", "description", "personality", "scenario", "first_mes", "tags"}
+
+// cardDataDefaults are the remaining fields the V2 spec requires, written when missing
+var cardDataDefaults = map[string]string{
+	"mes_example":               `""`,
+	"creator_notes":             `""`,
+	"system_prompt":             `""`,
+	"post_history_instructions": `""`,
+	"alternate_greetings":       `[]`,
+	"creator":                   `""`,
+	"character_version":         `""`,
+	"extensions":                `{}`,
+}
+
+// UnmarshalJSON splits mapped fields from the rest of the card
+func (d *CharacterCardData) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	targets := map[string]interface{}{
+		"name":        &d.Name,
+		"description": &d.Description,
+		"personality": &d.Personality,
+		"scenario":    &d.Scenario,
+		"first_mes":   &d.FirstMes,
+		"tags":        &d.Tags,
+	}
+	for _, key := range cardDataFields {
+		raw, ok := fields[key]
+		if !ok {
+			continue
+		}
+		// Tolerate null and mistyped values from hand-edited cards
+		json.Unmarshal(raw, targets[key])
+		delete(fields, key)
+	}
+
+	d.Extra = fields
+	return nil
+}
+
+// MarshalJSON writes the mapped fields, the preserved extras and defaults for required V2 fields
+func (d CharacterCardData) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]interface{}, len(d.Extra)+len(cardDataFields)+len(cardDataDefaults))
+	for key, raw := range cardDataDefaults {
+		fields[key] = json.RawMessage(raw)
+	}
+	for key, raw := range d.Extra {
+		fields[key] = raw
+	}
+
+	tags := d.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	fields["name"] = d.Name
+	fields["description"] = d.Description
+	fields["personality"] = d.Personality
+	fields["scenario"] = d.Scenario
+	fields["first_mes"] = d.FirstMes
+	fields["tags"] = tags
+
+	return json.Marshal(fields)
+}
+
+// Extension decodes data.extensions[key] into v, reporting whether it was present
+func (d *CharacterCardData) Extension(key string, v interface{}) bool {
+	var extensions map[string]json.RawMessage
+	if err := json.Unmarshal(d.Extra["extensions"], &extensions); err != nil {
+		return false
+	}
+	raw, ok := extensions[key]
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(raw, v) == nil
+}
+
+// SetExtension stores v under data.extensions[key], keeping other extensions
+func (d *CharacterCardData) SetExtension(key string, v interface{}) error {
+	extensions := map[string]json.RawMessage{}
+	if raw, ok := d.Extra["extensions"]; ok {
+		json.Unmarshal(raw, &extensions)
+	}
+
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	extensions[key] = value
+
+	merged, err := json.Marshal(extensions)
+	if err != nil {
+		return err
+	}
+	if d.Extra == nil {
+		d.Extra = map[string]json.RawMessage{}
+	}
+	d.Extra["extensions"] = merged
+	return nil
+}
+
+// NewCharacterCard wraps card data in a V2 envelope
+func NewCharacterCard(data CharacterCardData) *CharacterCard {
+	return &CharacterCard{Spec: CharacterCardSpec, SpecVersion: "2.0", Data: data}
+}
+
+// ParseCharacterCard reads a card from JSON (V2, or V1 with top-level fields) or from a PNG with a chara chunk
+func ParseCharacterCard(raw []byte) (*CharacterCard, error) {
+	if bytes.HasPrefix(raw, pngSignature) {
+		text, err := ExtractCardPNG(raw)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode chara chunk: %w", err)
+		}
+		raw = decoded
+	}
+
+	var envelope struct {
+		Spec string          `json:"spec"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to parse character card: %w", err)
+	}
+
+	// V1 cards keep the fields at the top level
+	body := raw
+	if envelope.Spec == CharacterCardSpec {
+		body = envelope.Data
+	}
+
+	var data CharacterCardData
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse character card: %w", err)
+	}
+	delete(data.Extra, "spec")
+	delete(data.Extra, "spec_version")
+
+	if data.Name == "" {
+		return nil, ErrNotCharacterCard
+	}
+
+	return NewCharacterCard(data), nil
+}
+
+// ExtractCardPNG returns the text of the chara tEXt chunk of a PNG
+func ExtractCardPNG(png []byte) ([]byte, error) {
+	var found []byte
+	err := walkPNGChunks(png, func(chunkType string, data []byte, _, _ int) bool {
+		if chunkType != "tEXt" {
+			return true
+		}
+		keyword, text, ok := bytes.Cut(data, []byte{0})
+		if ok && string(keyword) == CharacterCardPNGKeyword {
+			found = text
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrNoCardInPNG
+	}
+	return found, nil
+}
+
+// EmbedCardPNG writes the card into a PNG as a chara tEXt chunk, replacing any existing one
+func EmbedCardPNG(png []byte, card *CharacterCard) ([]byte, error) {
+	cardJSON, err := json.Marshal(card)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal character card: %w", err)
+	}
+
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	err = walkPNGChunks(png, func(chunkType string, data []byte, start, end int) bool {
+		if chunkType == "tEXt" {
+			if keyword, _, ok := bytes.Cut(data, []byte{0}); ok && string(keyword) == CharacterCardPNGKeyword {
+				return true
+			}
+		}
+		if chunkType == "IEND" {
+			text := append([]byte(CharacterCardPNGKeyword+"\x00"), base64.StdEncoding.EncodeToString(cardJSON)...)
+			writePNGChunk(&out, "tEXt", text)
+		}
+		out.Write(png[start:end])
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// walkPNGChunks calls fn for each chunk with its type, data and byte range until fn returns false
+func walkPNGChunks(png []byte, fn func(chunkType string, data []byte, start, end int) bool) error {
+	if !bytes.HasPrefix(png, pngSignature) {
+		return fmt.Errorf("not a PNG image")
+	}
+
+	for offset := len(pngSignature); offset+12 <= len(png); {
+		length := int(binary.BigEndian.Uint32(png[offset : offset+4]))
+		end := offset + 12 + length
+		if length < 0 || end > len(png) {
+			return fmt.Errorf("truncated PNG chunk")
+		}
+
+		chunkType := string(png[offset+4 : offset+8])
+		if !fn(chunkType, png[offset+8:offset+8+length], offset, end) || chunkType == "IEND" {
+			return nil
+		}
+		offset = end
+	}
+
+	return fmt.Errorf("PNG has no IEND chunk")
+}
+
+// writePNGChunk appends a chunk with its length and CRC
+func writePNGChunk(out *bytes.Buffer, chunkType string, data []byte) {
+	binary.Write(out, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(data)
+	out.WriteString(chunkType)
+	out.Write(data)
+	binary.Write(out, binary.BigEndian, crc.Sum32())
+}
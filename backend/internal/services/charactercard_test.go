@@ -0,0 +1,136 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"testing"
+)
+
+const testCardV2 = `{
+	"spec": "chara_card_v2",
+	"spec_version": "2.0",
+	"data": {
+		"name": "Seraphina",
+		"description": "A gentle forest guardian.",
+		"personality": "kind, protective",
+		"scenario": "You wake up in her glade.",
+		"first_mes": "*She smiles* You're safe now.",
+		"mes_example": "<START>",
+		"tags": ["fantasy", "female"],
+		"character_book": {"entries": [{"keys": ["glade"], "content": "A hidden clearing."}]},
+		"extensions": {"talkativeness": "0.5"}
+	}
+}`
+
+func TestParseCharacterCardV2KeepsUnknownFields(t *testing.T) {
+	card, err := ParseCharacterCard([]byte(testCardV2))
+	if err != nil {
+		t.Fatalf("ParseCharacterCard returned error: %v", err)
+	}
+
+	d := card.Data
+	if d.Name != "Seraphina" || d.Description != "A gentle forest guardian." || d.FirstMes != "*She smiles* You're safe now." {
+		t.Errorf("mapped fields not parsed: %+v", d)
+	}
+	if len(d.Tags) != 2 || d.Personality != "kind, protective" || d.Scenario != "You wake up in her glade." {
+		t.Errorf("mapped fields not parsed: %+v", d)
+	}
+	for _, key := range []string{"mes_example", "character_book", "extensions"} {
+		if _, ok := d.Extra[key]; !ok {
+			t.Errorf("unknown field %s was dropped", key)
+		}
+	}
+	if _, ok := d.Extra["name"]; ok {
+		t.Error("mapped field name should not be kept in Extra")
+	}
+
+	out, err := json.Marshal(card)
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+	var decoded struct {
+		Spec string                     `json:"spec"`
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	json.Unmarshal(out, &decoded)
+	if decoded.Spec != CharacterCardSpec {
+		t.Errorf("spec = %q, want %q", decoded.Spec, CharacterCardSpec)
+	}
+	for _, key := range []string{"character_book", "creator_notes", "alternate_greetings", "first_mes"} {
+		if _, ok := decoded.Data[key]; !ok {
+			t.Errorf("exported card is missing %s", key)
+		}
+	}
+}
+
+func TestParseCharacterCardV1(t *testing.T) {
+	card, err := ParseCharacterCard([]byte(`{"name": "Ren", "description": "Barista.", "first_mes": "Hey!", "mes_example": ""}`))
+	if err != nil {
+		t.Fatalf("ParseCharacterCard returned error: %v", err)
+	}
+	if card.Data.Name != "Ren" || card.Data.FirstMes != "Hey!" || card.Spec != CharacterCardSpec {
+		t.Errorf("unexpected card %+v", card)
+	}
+
+	if _, err := ParseCharacterCard([]byte(`{"description": "no name"}`)); err != ErrNotCharacterCard {
+		t.Errorf("expected ErrNotCharacterCard, got %v", err)
+	}
+}
+
+func TestCharacterCardExtensions(t *testing.T) {
+	card, _ := ParseCharacterCard([]byte(testCardV2))
+
+	if err := card.Data.SetExtension("nectar", map[string]int{"age": 24}); err != nil {
+		t.Fatalf("SetExtension returned error: %v", err)
+	}
+
+	var fields struct {
+		Age int `json:"age"`
+	}
+	if !card.Data.Extension("nectar", &fields) || fields.Age != 24 {
+		t.Errorf("extension not stored, got %+v", fields)
+	}
+	var talkativeness string
+	if !card.Data.Extension("talkativeness", &talkativeness) || talkativeness != "0.5" {
+		t.Error("existing extensions should be kept")
+	}
+}
+
+func TestCharacterCardPNGRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 6)))
+
+	card, _ := ParseCharacterCard([]byte(testCardV2))
+	withCard, err := EmbedCardPNG(buf.Bytes(), card)
+	if err != nil {
+		t.Fatalf("EmbedCardPNG returned error: %v", err)
+	}
+
+	// Embedding again replaces the chunk instead of adding a second one
+	card.Data.Name = "Seraphina II"
+	withCard, err = EmbedCardPNG(withCard, card)
+	if err != nil {
+		t.Fatalf("EmbedCardPNG returned error: %v", err)
+	}
+	if n := bytes.Count(withCard, []byte("chara\x00")); n != 1 {
+		t.Errorf("found %d chara chunks, want 1", n)
+	}
+
+	if _, err := png.Decode(bytes.NewReader(withCard)); err != nil {
+		t.Fatalf("PNG with card no longer decodes: %v", err)
+	}
+
+	parsed, err := ParseCharacterCard(withCard)
+	if err != nil {
+		t.Fatalf("ParseCharacterCard returned error: %v", err)
+	}
+	if parsed.Data.Name != "Seraphina II" {
+		t.Errorf("Name = %q, want Seraphina II", parsed.Data.Name)
+	}
+
+	if _, err := ParseCharacterCard(buf.Bytes()); err != ErrNoCardInPNG {
+		t.Errorf("expected ErrNoCardInPNG, got %v", err)
+	}
+}
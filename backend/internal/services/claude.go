@@ -2,6 +2,7 @@ package services
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,6 +11,10 @@ import (
 	"strings"
 )
 
+// PromptVersion identifies the system prompt built by BuildSystemPrompt. Bump it whenever the
+// prompt changes, so reply feedback can be compared across prompt versions.
+const PromptVersion = "1"
+
 // ClaudeService handles AI conversations using Anthropic Claude
 type ClaudeService struct {
 	apiKey     string
@@ -20,8 +25,86 @@ type ClaudeService struct {
 
 // ClaudeMessage represents a message in the Claude conversation
 type ClaudeMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string        `json:"role"`
+	Content string        `json:"content"`
+	Images  []ClaudeImage `json:"-"` // Photos sent with the message, encoded as image blocks
+}
+
+// ClaudeImage is a photo the user shared, sent to vision models as a base64 block
+type ClaudeImage struct {
+	MediaType string // image/jpeg, image/png, image/gif or image/webp
+	Data      []byte
+	Caption   string // Text description used by providers without vision support
+}
+
+// ClaudeContentBlock is one block of Anthropic's multi-block message content
+type ClaudeContentBlock struct {
+	Type   string             `json:"type"` // text or image
+	Text   string             `json:"text,omitempty"`
+	Source *ClaudeImageSource `json:"source,omitempty"`
+}
+
+// ClaudeImageSource holds the base64 payload of an image block
+type ClaudeImageSource struct {
+	Type      string `json:"type"` // base64
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+// MarshalJSON encodes plain messages with string content and messages with
+// images as a list of image blocks followed by the text block
+func (m ClaudeMessage) MarshalJSON() ([]byte, error) {
+	if len(m.Images) == 0 {
+		return json.Marshal(struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		}{m.Role, m.Content})
+	}
+
+	return json.Marshal(struct {
+		Role    string               `json:"role"`
+		Content []ClaudeContentBlock `json:"content"`
+	}{m.Role, m.ContentBlocks()})
+}
+
+// ContentBlocks returns the message as Anthropic content blocks
+func (m ClaudeMessage) ContentBlocks() []ClaudeContentBlock {
+	blocks := make([]ClaudeContentBlock, 0, len(m.Images)+1)
+	for _, img := range m.Images {
+		blocks = append(blocks, ClaudeContentBlock{
+			Type: "image",
+			Source: &ClaudeImageSource{
+				Type:      "base64",
+				MediaType: img.MediaType,
+				Data:      base64.StdEncoding.EncodeToString(img.Data),
+			},
+		})
+	}
+	if m.Content != "" {
+		blocks = append(blocks, ClaudeContentBlock{Type: "text", Text: m.Content})
+	}
+	return blocks
+}
+
+// TextContent returns the message as plain text, replacing images with their
+// captions for providers without vision support
+func (m ClaudeMessage) TextContent() string {
+	if len(m.Images) == 0 {
+		return m.Content
+	}
+
+	var parts []string
+	for _, img := range m.Images {
+		if img.Caption == "" {
+			parts = append(parts, "*sends a photo*")
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("*sends a photo: %s*", img.Caption))
+	}
+	if m.Content != "" {
+		parts = append(parts, m.Content)
+	}
+	return strings.Join(parts, "\n")
 }
 
 // ClaudeRequest represents the request body for Claude API
@@ -65,6 +148,17 @@ type CompanionContext struct {
 	Greeting           string
 	CommunicationStyle string
 	Interests          []string
+	Lore               []string // Lorebook entries selected for the conversation
+	Knowledge          []string // Knowledge base passages retrieved for the latest message
+	User               *UserContext
+}
+
+// UserContext holds the persona the user chats as, for prompt building
+type UserContext struct {
+	DisplayName string   `json:"displayName"`
+	Pronouns    string   `json:"pronouns,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Preferences []string `json:"preferences,omitempty"`
 }
 
 // NewClaudeService creates a new Claude AI service
@@ -88,6 +182,11 @@ func (s *ClaudeService) IsConfigured() bool {
 	return s.apiKey != ""
 }
 
+// Model returns the Claude model replies are generated with
+func (s *ClaudeService) Model() string {
+	return s.model
+}
+
 // BuildSystemPrompt creates a system prompt from companion context
 func (s *ClaudeService) BuildSystemPrompt(companion CompanionContext, mood string) string {
 	var sb strings.Builder
@@ -148,6 +247,9 @@ func (s *ClaudeService) BuildSystemPrompt(companion CompanionContext, mood strin
 				sb.WriteString("sweet but not flirty)\n")
 			}
 		}
+		if summary, ok := companion.Personality["summary"].(string); ok && summary != "" {
+			sb.WriteString(fmt.Sprintf("- In short: %s\n", summary))
+		}
 	}
 
 	// Interests
@@ -168,6 +270,39 @@ func (s *ClaudeService) BuildSystemPrompt(companion CompanionContext, mood strin
 		sb.WriteString(fmt.Sprintf("\nScenario context: %s\n", companion.Scenario))
 	}
 
+	// The persona the user chats as
+	if u := companion.User; u != nil {
+		sb.WriteString("\nAbout the user:\n")
+		if u.DisplayName != "" {
+			sb.WriteString(fmt.Sprintf("- Call them %s\n", u.DisplayName))
+		}
+		if u.Pronouns != "" {
+			sb.WriteString(fmt.Sprintf("- Pronouns: %s\n", u.Pronouns))
+		}
+		if u.Description != "" {
+			sb.WriteString(fmt.Sprintf("- About them: %s\n", strings.TrimSpace(u.Description)))
+		}
+		if len(u.Preferences) > 0 {
+			sb.WriteString(fmt.Sprintf("- Their preferences for your conversations: %s\n", strings.Join(u.Preferences, "; ")))
+		}
+	}
+
+	// World info from the lorebook
+	if len(companion.Lore) > 0 {
+		sb.WriteString("\nWorld info (facts about your world; use them when relevant):\n")
+		for _, lore := range companion.Lore {
+			sb.WriteString(fmt.Sprintf("- %s\n", strings.TrimSpace(lore)))
+		}
+	}
+
+	// Passages from the companion's knowledge base
+	if len(companion.Knowledge) > 0 {
+		sb.WriteString("\nReference notes about you and your world (draw on them when relevant, in your own words):\n")
+		for i, passage := range companion.Knowledge {
+			sb.WriteString(fmt.Sprintf("[%d] %s\n", i+1, strings.TrimSpace(passage)))
+		}
+	}
+
 	// Mood adaptation
 	sb.WriteString(fmt.Sprintf("\nThe user's current mood is: %s. Adapt your responses accordingly:\n", mood))
 	switch mood {
@@ -204,6 +339,11 @@ func (s *ClaudeService) BuildSystemPrompt(companion CompanionContext, mood strin
 	sb.WriteString("- Example format: 'Just took this for you! [Photo] I'm sitting by my window with golden hour light, wearing my cozy oversized sweater, giving you a soft smile with my chin resting on my hand. You can see my bookshelf in the background. 📸'\n")
 	sb.WriteString("- Keep the photo description tasteful but can be flirty/cute based on your personality\n")
 
+	// Photos shared by the user
+	sb.WriteString("\nPhotos From the User:\n")
+	sb.WriteString("- When the user shares a photo, react to what you actually see in it\n")
+	sb.WriteString("- Mention specific details and stay in character\n")
+
 	return sb.String()
 }
 
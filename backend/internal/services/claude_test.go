@@ -0,0 +1,110 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestClaudeMessageMarshalPlainText(t *testing.T) {
+	data, err := json.Marshal(ClaudeMessage{Role: "user", Content: "Hello"})
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+	if string(data) != `{"role":"user","content":"Hello"}` {
+		t.Errorf("unexpected JSON: %s", data)
+	}
+}
+
+func TestClaudeMessageMarshalWithImage(t *testing.T) {
+	msg := ClaudeMessage{
+		Role:    "user",
+		Content: "What do you think of my outfit?",
+		Images:  []ClaudeImage{{MediaType: "image/png", Data: []byte("png")}},
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+
+	var decoded struct {
+		Role    string               `json:"role"`
+		Content []ClaudeContentBlock `json:"content"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal returned error: %v", err)
+	}
+
+	if len(decoded.Content) != 2 {
+		t.Fatalf("expected 2 content blocks, got %d", len(decoded.Content))
+	}
+	image := decoded.Content[0]
+	if image.Type != "image" || image.Source == nil {
+		t.Fatalf("expected image block first, got %+v", image)
+	}
+	if image.Source.Type != "base64" || image.Source.MediaType != "image/png" || image.Source.Data != "cG5n" {
+		t.Errorf("unexpected image source: %+v", image.Source)
+	}
+	if decoded.Content[1].Type != "text" || decoded.Content[1].Text != msg.Content {
+		t.Errorf("unexpected text block: %+v", decoded.Content[1])
+	}
+}
+
+func TestClaudeMessageImageOnlyOmitsTextBlock(t *testing.T) {
+	msg := ClaudeMessage{Role: "user", Images: []ClaudeImage{{MediaType: "image/jpeg", Data: []byte("jpg")}}}
+	if blocks := msg.ContentBlocks(); len(blocks) != 1 || blocks[0].Type != "image" {
+		t.Errorf("expected a single image block, got %+v", blocks)
+	}
+}
+
+func TestClaudeMessageTextContent(t *testing.T) {
+	msg := ClaudeMessage{
+		Role:    "user",
+		Content: "Look where I am!",
+		Images:  []ClaudeImage{{MediaType: "image/jpeg", Caption: "a beach at sunset"}},
+	}
+	got := msg.TextContent()
+	if !strings.Contains(got, "a beach at sunset") || !strings.HasSuffix(got, "Look where I am!") {
+		t.Errorf("TextContent = %q", got)
+	}
+
+	uncaptioned := ClaudeMessage{Role: "user", Images: []ClaudeImage{{MediaType: "image/jpeg"}}}
+	if got := uncaptioned.TextContent(); got != "*sends a photo*" {
+		t.Errorf("TextContent without caption = %q", got)
+	}
+
+	plain := ClaudeMessage{Role: "user", Content: "Hi"}
+	if got := plain.TextContent(); got != "Hi" {
+		t.Errorf("TextContent for plain message = %q", got)
+	}
+}
+
+func TestBuildSystemPromptIncludesLore(t *testing.T) {
+	s := &ClaudeService{}
+	prompt := s.BuildSystemPrompt(CompanionContext{Name: "Mia", Age: 24, Lore: []string{"The glade is hidden."}}, "calm")
+	if !strings.Contains(prompt, "World info") || !strings.Contains(prompt, "- The glade is hidden.\n") {
+		t.Errorf("prompt is missing the lore:\n%s", prompt)
+	}
+
+	prompt = s.BuildSystemPrompt(CompanionContext{Name: "Mia", Age: 24}, "calm")
+	if strings.Contains(prompt, "World info") {
+		t.Error("prompt should have no world info section without lore")
+	}
+}
+
+func TestBuildSystemPromptIncludesUserPersona(t *testing.T) {
+	s := &ClaudeService{}
+	user := &UserContext{DisplayName: "Sam", Pronouns: "they/them", Description: "Night owl.", Preferences: []string{"slow burn", "no pet names"}}
+	prompt := s.BuildSystemPrompt(CompanionContext{Name: "Mia", Age: 24, User: user}, "calm")
+	for _, want := range []string{"About the user:", "- Call them Sam\n", "- Pronouns: they/them\n", "- About them: Night owl.\n", "slow burn; no pet names"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt is missing %q:\n%s", want, prompt)
+		}
+	}
+
+	prompt = s.BuildSystemPrompt(CompanionContext{Name: "Mia", Age: 24}, "calm")
+	if strings.Contains(prompt, "About the user") {
+		t.Error("prompt should have no user section without a persona")
+	}
+}
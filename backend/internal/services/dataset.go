@@ -0,0 +1,383 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"nectar-ai-companion/internal/models"
+)
+
+// Training data formats
+const (
+	DatasetFormatOpenAI    = "openai"    // {"messages": [system, user, assistant, ...]}
+	DatasetFormatAnthropic = "anthropic" // {"system": ..., "messages": [user, assistant, ...]}
+)
+
+// Dataset splits
+const (
+	DatasetSplitTrain      = "train"
+	DatasetSplitValidation = "validation"
+)
+
+// datasetHistoryMessages caps the messages of history before each rated reply
+const datasetHistoryMessages = 20
+
+// datasetPhotoPlaceholder stands in for image-only messages, as in the chat prompt
+const datasetPhotoPlaceholder = "*sends a photo*"
+
+// DatasetFilter selects the rated companion replies to export
+type DatasetFilter struct {
+	Rating      string    // up, down, or empty for both
+	CompanionID string    // Empty for every companion
+	From        time.Time // Replies created at or after From; zero leaves it open
+	To          time.Time // Replies created before To; zero leaves it open
+}
+
+// DatasetMessage is a chat message of a training example
+type DatasetMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// DatasetExample is a rated companion reply with the anonymized conversation that led to it
+// and the system prompt it was generated with
+type DatasetExample struct {
+	ConversationID string
+	MessageID      string
+	Rating         string
+	System         string
+	Messages       []DatasetMessage // Oldest first, ending with the rated reply
+}
+
+// ReplyPromptContext is what a companion reply's system prompt was built from besides the
+// companion. It is stored with the reply, as lore and knowledge are selected per message and
+// the user's persona can be edited or deleted later.
+type ReplyPromptContext struct {
+	Mood      string       `json:"mood"`
+	Lore      []string     `json:"lore,omitempty"`
+	Knowledge []string     `json:"knowledge,omitempty"`
+	User      *UserContext `json:"user,omitempty"` // Nil if the user chatted without a persona
+}
+
+// DatasetService builds fine-tuning examples from companion replies users rated
+type DatasetService struct {
+	db     *sql.DB
+	claude *ClaudeService
+}
+
+// NewDatasetService creates a dataset service
+func NewDatasetService(db *sql.DB) *DatasetService {
+	return &DatasetService{db: db, claude: NewClaudeService()}
+}
+
+// ParseDatasetTime reads a filter time given as a date (2006-01-02) or an RFC 3339 time
+func ParseDatasetTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use YYYY-MM-DD or RFC 3339", s)
+	}
+	return t, nil
+}
+
+// ValidDatasetFormat reports whether format is a known training data format
+func ValidDatasetFormat(format string) bool {
+	return format == DatasetFormatOpenAI || format == DatasetFormatAnthropic
+}
+
+// DatasetSplit assigns a conversation to the train or validation set, sending about
+// validationRatio of conversations to validation. Whole conversations go to one set, so
+// validation examples never share history with training ones, and the assignment is stable.
+func DatasetSplit(conversationID string, validationRatio float64) string {
+	h := fnv.New32a()
+	h.Write([]byte(conversationID))
+	if float64(h.Sum32()%10000) < validationRatio*10000 {
+		return DatasetSplitValidation
+	}
+	return DatasetSplitTrain
+}
+
+// ratedReply is a rated companion reply with what is needed to rebuild its example
+type ratedReply struct {
+	messageID      string
+	conversationID string
+	userID         string
+	companionID    string
+	revisionID     *string
+	rating         string
+	promptContext  ReplyPromptContext
+	createdAt      time.Time
+}
+
+// Export builds an example for every reply matching the filter, oldest first, and passes it to emit.
+// Feedback on replies that were since regenerated is skipped, as the rated text is gone, and so are
+// replies whose system prompt cannot be rebuilt as sent: those from another prompt version or
+// without a recorded prompt context.
+func (s *DatasetService) Export(filter DatasetFilter, emit func(DatasetExample) error) error {
+	where := []string{"f.revision_id IS NULL", "m.sender = 'ai'", "m.deleted_at IS NULL",
+		"m.metadata->>'promptVersion' = $1", "m.prompt_context->>'mood' IS NOT NULL"}
+	args := []interface{}{PromptVersion}
+	if filter.Rating != "" {
+		args = append(args, filter.Rating)
+		where = append(where, "f.rating = $"+strconv.Itoa(len(args)))
+	}
+	if filter.CompanionID != "" {
+		args = append(args, filter.CompanionID)
+		where = append(where, "conv.companion_id = $"+strconv.Itoa(len(args)))
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		where = append(where, "m.created_at >= $"+strconv.Itoa(len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		where = append(where, "m.created_at < $"+strconv.Itoa(len(args)))
+	}
+
+	rows, err := s.db.Query(
+		`SELECT m.id, m.conversation_id, conv.user_id, conv.companion_id, conv.companion_revision_id,
+			f.rating, m.prompt_context, m.created_at
+		FROM message_feedback f
+		JOIN messages m ON m.id = f.message_id
+		JOIN conversations conv ON conv.id = m.conversation_id
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY m.created_at ASC`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	// Examples are built as the replies are read, so exports of any size stream
+	userNames := map[string][]string{}
+	for rows.Next() {
+		var r ratedReply
+		var promptContext []byte
+		if err := rows.Scan(&r.messageID, &r.conversationID, &r.userID, &r.companionID, &r.revisionID,
+			&r.rating, &promptContext, &r.createdAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(promptContext, &r.promptContext); err != nil {
+			return err
+		}
+
+		names, ok := userNames[r.userID]
+		if !ok {
+			if names, err = s.userNames(r.userID); err != nil {
+				return err
+			}
+			userNames[r.userID] = names
+		}
+		// The persona of the time may have been renamed or deleted since
+		if r.promptContext.User != nil {
+			names = append(names[:len(names):len(names)], r.promptContext.User.DisplayName)
+		}
+		anon := NewAnonymizer(names...)
+
+		example, err := s.buildExample(r, anon)
+		if err != nil {
+			return err
+		}
+		if example == nil {
+			continue
+		}
+		if err := emit(*example); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// userNames loads the names a user goes by: their username and persona display names
+func (s *DatasetService) userNames(userID string) ([]string, error) {
+	var username string
+	if err := s.db.QueryRow(`SELECT username FROM users WHERE id = $1`, userID).Scan(&username); err != nil {
+		return nil, err
+	}
+	names := []string{username}
+
+	rows, err := s.db.Query(`SELECT display_name FROM user_personas WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// buildExample rebuilds the prompt a reply was generated from. It returns nil if the reply's
+// branch cannot be rebuilt.
+func (s *DatasetService) buildExample(r ratedReply, anon *Anonymizer) (*DatasetExample, error) {
+	history, err := s.replyHistory(r.messageID, anon)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 || history[len(history)-1].Role != "assistant" {
+		return nil, nil
+	}
+
+	companion, err := s.companionAt(r)
+	if err != nil {
+		return nil, err
+	}
+	companion.User = anon.User(r.promptContext.User)
+	companion.Lore = r.promptContext.Lore
+	companion.Knowledge = r.promptContext.Knowledge
+
+	return &DatasetExample{
+		ConversationID: r.conversationID,
+		MessageID:      r.messageID,
+		Rating:         r.rating,
+		System:         s.claude.BuildSystemPrompt(*companion, r.promptContext.Mood),
+		Messages:       history,
+	}, nil
+}
+
+// replyHistory loads the anonymized messages on a reply's branch, ending with the reply
+func (s *DatasetService) replyHistory(messageID string, anon *Anonymizer) ([]DatasetMessage, error) {
+	rows, err := s.db.Query(
+		`WITH RECURSIVE path AS (
+			SELECT id, parent_id, sender, content, deleted_at, 0 AS depth FROM messages WHERE id = $1
+			UNION ALL
+			SELECT m.id, m.parent_id, m.sender, m.content, m.deleted_at, path.depth + 1
+			FROM messages m JOIN path ON m.id = path.parent_id
+		)
+		SELECT sender, content FROM path WHERE deleted_at IS NULL ORDER BY depth ASC LIMIT $2`,
+		messageID, datasetHistoryMessages+1,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []DatasetMessage
+	for rows.Next() {
+		var sender, content string
+		if err := rows.Scan(&sender, &content); err != nil {
+			return nil, err
+		}
+		role := "user"
+		if sender == "ai" {
+			role = "assistant"
+		}
+		content = anon.Text(strings.TrimSpace(content))
+		if content == "" {
+			content = datasetPhotoPlaceholder
+		}
+		history = append([]DatasetMessage{{Role: role, Content: content}}, history...)
+	}
+	return mergeDatasetTurns(history), rows.Err()
+}
+
+// mergeDatasetTurns joins consecutive messages from the same side into one turn
+func mergeDatasetTurns(messages []DatasetMessage) []DatasetMessage {
+	var merged []DatasetMessage
+	for _, m := range messages {
+		if n := len(merged); n > 0 && merged[n-1].Role == m.Role {
+			merged[n-1].Content += "\n\n" + m.Content
+			continue
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+// companionAt loads the companion persona a reply was generated with: the revision its
+// conversation is pinned to, or else the latest revision made before the reply
+// (the first revision for replies older than revision history)
+func (s *DatasetService) companionAt(r ratedReply) (*CompanionContext, error) {
+	var raw []byte
+	var err error
+	if r.revisionID != nil {
+		err = s.db.QueryRow(`SELECT snapshot FROM companion_revisions WHERE id = $1`, *r.revisionID).Scan(&raw)
+	} else {
+		err = s.db.QueryRow(
+			`SELECT snapshot FROM companion_revisions WHERE companion_id = $1
+			ORDER BY created_at <= $2 DESC,
+				CASE WHEN created_at <= $2 THEN revision ELSE -revision END DESC
+			LIMIT 1`,
+			r.companionID, r.createdAt,
+		).Scan(&raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("companion revision for message %s: %w", r.messageID, err)
+	}
+
+	var snap models.CompanionSnapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return nil, err
+	}
+
+	companion := &CompanionContext{
+		Name:               snap.Name,
+		Age:                snap.Age,
+		Bio:                snap.Bio,
+		Personality:        snap.Personality,
+		Tags:               snap.Tags,
+		CommunicationStyle: snap.CommunicationStyle,
+		Interests:          snap.Interests,
+	}
+	if snap.Scenario != nil {
+		companion.Scenario = *snap.Scenario
+	}
+	if snap.Greeting != nil {
+		companion.Greeting = *snap.Greeting
+	}
+	return companion, nil
+}
+
+// openAIRecord is a training example in the OpenAI chat fine-tuning format
+type openAIRecord struct {
+	Messages []DatasetMessage `json:"messages"`
+}
+
+// anthropicRecord is a training example in the Anthropic messages format
+type anthropicRecord struct {
+	System   string           `json:"system"`
+	Messages []DatasetMessage `json:"messages"`
+}
+
+// WriteDatasetRecord writes an example as a JSONL line in the given format. It returns false
+// without writing if the format cannot represent the example.
+func WriteDatasetRecord(w io.Writer, format string, example DatasetExample) (bool, error) {
+	var record interface{}
+	switch format {
+	case DatasetFormatOpenAI:
+		messages := append([]DatasetMessage{{Role: "system", Content: example.System}}, example.Messages...)
+		record = openAIRecord{Messages: messages}
+	case DatasetFormatAnthropic:
+		// Anthropic conversations start with the user
+		messages := example.Messages
+		for len(messages) > 0 && messages[0].Role != "user" {
+			messages = messages[1:]
+		}
+		if len(messages) == 0 {
+			return false, nil
+		}
+		record = anthropicRecord{System: example.System, Messages: messages}
+	default:
+		return false, fmt.Errorf("unknown dataset format %q", format)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(record); err != nil {
+		return false, err
+	}
+	return true, nil
+}
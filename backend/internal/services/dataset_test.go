@@ -0,0 +1,110 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDatasetSplit(t *testing.T) {
+	validation := 0
+	for i := 0; i < 10000; i++ {
+		id := fmt.Sprintf("conversation-%d", i)
+		split := DatasetSplit(id, 0.1)
+		if split != DatasetSplit(id, 0.1) {
+			t.Fatalf("split of %s is not stable", id)
+		}
+		if split == DatasetSplitValidation {
+			validation++
+		}
+	}
+	if validation < 800 || validation > 1200 {
+		t.Errorf("expected about 1000 validation conversations, got %d", validation)
+	}
+
+	if DatasetSplit("any", 0) != DatasetSplitTrain || DatasetSplit("any", 1) != DatasetSplitValidation {
+		t.Error("ratios 0 and 1 should put everything in one set")
+	}
+}
+
+func TestMergeDatasetTurns(t *testing.T) {
+	merged := mergeDatasetTurns([]DatasetMessage{
+		{Role: "user", Content: "hi"},
+		{Role: "user", Content: "are you there?"},
+		{Role: "assistant", Content: "Hey!"},
+	})
+	if len(merged) != 2 || merged[0].Content != "hi\n\nare you there?" {
+		t.Errorf("unexpected turns %+v", merged)
+	}
+}
+
+func TestWriteDatasetRecord(t *testing.T) {
+	example := DatasetExample{
+		System: "You are Mia.",
+		Messages: []DatasetMessage{
+			{Role: "assistant", Content: "Welcome <3"},
+			{Role: "user", Content: "hi"},
+			{Role: "assistant", Content: "Hey!"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if ok, err := WriteDatasetRecord(&buf, DatasetFormatOpenAI, example); !ok || err != nil {
+		t.Fatalf("openai record not written: %v", err)
+	}
+	var openAI struct {
+		Messages []DatasetMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &openAI); err != nil {
+		t.Fatal(err)
+	}
+	if len(openAI.Messages) != 4 || openAI.Messages[0].Role != "system" || openAI.Messages[1].Content != "Welcome <3" {
+		t.Errorf("unexpected openai record %s", buf.String())
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("}\n")) || bytes.Contains(buf.Bytes(), []byte(`\u003c`)) {
+		t.Errorf("expected one unescaped JSON line, got %q", buf.String())
+	}
+
+	// Anthropic conversations start with the user, so the greeting is dropped
+	buf.Reset()
+	if ok, err := WriteDatasetRecord(&buf, DatasetFormatAnthropic, example); !ok || err != nil {
+		t.Fatalf("anthropic record not written: %v", err)
+	}
+	var anthropic struct {
+		System   string           `json:"system"`
+		Messages []DatasetMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &anthropic); err != nil {
+		t.Fatal(err)
+	}
+	if anthropic.System != "You are Mia." || len(anthropic.Messages) != 2 || anthropic.Messages[0].Role != "user" {
+		t.Errorf("unexpected anthropic record %s", buf.String())
+	}
+
+	// A greeting alone cannot be an Anthropic example
+	buf.Reset()
+	greeting := DatasetExample{Messages: []DatasetMessage{{Role: "assistant", Content: "Welcome"}}}
+	if ok, _ := WriteDatasetRecord(&buf, DatasetFormatAnthropic, greeting); ok || buf.Len() > 0 {
+		t.Error("expected the greeting-only example to be skipped")
+	}
+
+	if _, err := WriteDatasetRecord(&buf, "csv", example); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestParseDatasetTime(t *testing.T) {
+	got, err := ParseDatasetTime("2025-03-01")
+	if err != nil || !got.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("ParseDatasetTime(date) = %v, %v", got, err)
+	}
+	got, err = ParseDatasetTime("2025-03-01T12:30:00+01:00")
+	if err != nil || !got.Equal(time.Date(2025, 3, 1, 11, 30, 0, 0, time.UTC)) {
+		t.Errorf("ParseDatasetTime(RFC 3339) = %v, %v", got, err)
+	}
+	if _, err := ParseDatasetTime("yesterday"); err == nil {
+		t.Error("expected an error for an invalid time")
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// EmbeddingProvider turns text into vectors for semantic knowledge retrieval
+type EmbeddingProvider interface {
+	IsConfigured() bool
+	Embed(texts []string) ([][]float64, error)
+}
+
+// NewEmbeddingProvider creates the embedding backend; knowledge retrieval uses BM25 alone when it is not configured
+func NewEmbeddingProvider() EmbeddingProvider {
+	return NewHTTPEmbeddingProvider()
+}
+
+// HTTPEmbeddingProvider embeds text with an OpenAI-compatible /embeddings endpoint
+type HTTPEmbeddingProvider struct {
+	apiKey     string
+	baseURL    string
+	model      string
+	httpClient *http.Client
+}
+
+// HTTPEmbeddingRequest represents the request body for the embeddings API
+type HTTPEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// HTTPEmbeddingResponse represents the embeddings API response
+type HTTPEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+// NewHTTPEmbeddingProvider creates an embedding provider from EMBEDDING_API_URL, EMBEDDING_API_KEY and EMBEDDING_MODEL
+func NewHTTPEmbeddingProvider() *HTTPEmbeddingProvider {
+	model := os.Getenv("EMBEDDING_MODEL")
+	if model == "" {
+		model = "text-embedding-3-small"
+	}
+
+	return &HTTPEmbeddingProvider{
+		apiKey:  os.Getenv("EMBEDDING_API_KEY"),
+		baseURL: os.Getenv("EMBEDDING_API_URL"),
+		model:   model,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// IsConfigured checks if the embeddings endpoint is set
+func (s *HTTPEmbeddingProvider) IsConfigured() bool {
+	return s.baseURL != ""
+}
+
+// Embed returns one vector per text, in order
+func (s *HTTPEmbeddingProvider) Embed(texts []string) ([][]float64, error) {
+	if !s.IsConfigured() {
+		return nil, fmt.Errorf("embedding API URL not configured")
+	}
+
+	jsonBody, err := json.Marshal(HTTPEmbeddingRequest{Model: s.model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", s.baseURL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("embedding API error: status %d, body: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result HTTPEmbeddingResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	vectors := make([][]float64, len(texts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding API returned index %d for %d inputs", d.Index, len(texts))
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	for i, v := range vectors {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("embedding API returned no vector for input %d", i)
+		}
+	}
+	return vectors, nil
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPEmbeddingProviderEmbed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req HTTPEmbeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("failed to decode request: %v", err)
+		}
+		if req.Model != "text-embedding-3-small" || len(req.Input) != 2 {
+			t.Errorf("unexpected request %+v", req)
+		}
+		if r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		// Out of order, as the API allows
+		w.Write([]byte(`{"data": [{"index": 1, "embedding": [0, 1]}, {"index": 0, "embedding": [1, 0]}]}`))
+	}))
+	defer server.Close()
+
+	provider := &HTTPEmbeddingProvider{
+		apiKey:     "key",
+		baseURL:    server.URL,
+		model:      "text-embedding-3-small",
+		httpClient: server.Client(),
+	}
+
+	vectors, err := provider.Embed([]string{"first", "second"})
+	if err != nil {
+		t.Fatalf("Embed returned error: %v", err)
+	}
+	if len(vectors) != 2 || vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Errorf("vectors = %v, want them in input order", vectors)
+	}
+}
+
+func TestHTTPEmbeddingProviderMissingVector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": [{"index": 0, "embedding": [1, 0]}]}`))
+	}))
+	defer server.Close()
+
+	provider := &HTTPEmbeddingProvider{baseURL: server.URL, httpClient: server.Client()}
+	if _, err := provider.Embed([]string{"first", "second"}); err == nil {
+		t.Error("expected an error when a vector is missing")
+	}
+}
+
+func TestHTTPEmbeddingProviderNotConfigured(t *testing.T) {
+	provider := &HTTPEmbeddingProvider{}
+	if provider.IsConfigured() {
+		t.Error("provider without a URL should not be configured")
+	}
+	if _, err := provider.Embed([]string{"text"}); err == nil {
+		t.Error("expected an error from an unconfigured provider")
+	}
+}
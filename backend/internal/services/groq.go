@@ -77,6 +77,11 @@ func (s *GroqService) IsConfigured() bool {
 	return s.apiKey != ""
 }
 
+// Model returns the Groq model replies are generated with
+func (s *GroqService) Model() string {
+	return s.model
+}
+
 // GenerateResponse generates a response using Groq API
 func (s *GroqService) GenerateResponse(companion CompanionContext, messages []ClaudeMessage, mood string) (string, error) {
 	if !s.IsConfigured() {
@@ -92,9 +97,10 @@ func (s *GroqService) GenerateResponse(companion CompanionContext, messages []Cl
 		{Role: "system", Content: systemPrompt},
 	}
 	for _, msg := range messages {
+		// Groq text models have no vision support, so photos are sent as captions
 		groqMessages = append(groqMessages, GroqMessage{
 			Role:    msg.Role,
-			Content: msg.Content,
+			Content: msg.TextContent(),
 		})
 	}
 
@@ -14,10 +14,11 @@ import (
 
 // HuggingFaceService handles AI image generation using Hugging Face Inference API
 type HuggingFaceService struct {
-	apiKey     string
-	baseURL    string
-	model      string
-	httpClient *http.Client
+	apiKey       string
+	baseURL      string
+	model        string
+	captionModel string
+	httpClient   *http.Client
 }
 
 // HFImageRequest represents the request body for Hugging Face image generation
@@ -41,10 +42,16 @@ func NewHuggingFaceService() *HuggingFaceService {
 		model = "stabilityai/stable-diffusion-xl-base-1.0" // Free, high quality
 	}
 
+	captionModel := os.Getenv("HUGGINGFACE_CAPTION_MODEL")
+	if captionModel == "" {
+		captionModel = "Salesforce/blip-image-captioning-large"
+	}
+
 	return &HuggingFaceService{
-		apiKey:  apiKey,
-		baseURL: "https://router.huggingface.co/hf-inference/models/",
-		model:   model,
+		apiKey:       apiKey,
+		baseURL:      "https://router.huggingface.co/hf-inference/models/",
+		model:        model,
+		captionModel: captionModel,
 		httpClient: &http.Client{
 			Timeout: 120 * time.Second, // HF can be slow
 		},
@@ -228,6 +235,48 @@ func (s *HuggingFaceService) GenerateCompanionPhoto(appearance CompanionAppearan
 	return encoded, nil
 }
 
+// CaptionImage describes an image in a short sentence using an image-to-text model
+func (s *HuggingFaceService) CaptionImage(image []byte, mediaType string) (string, error) {
+	if !s.IsConfigured() {
+		return "", fmt.Errorf("Hugging Face API key not configured")
+	}
+
+	req, err := http.NewRequest("POST", s.baseURL+s.captionModel, bytes.NewReader(image))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", mediaType)
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("Hugging Face API error: status %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var captions []struct {
+		GeneratedText string `json:"generated_text"`
+	}
+	if err := json.Unmarshal(body, &captions); err != nil {
+		return "", fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if len(captions) == 0 || strings.TrimSpace(captions[0].GeneratedText) == "" {
+		return "", fmt.Errorf("no caption in response")
+	}
+
+	return strings.TrimSpace(captions[0].GeneratedText), nil
+}
+
 // base64Encode encodes bytes to base64 string
 func base64Encode(data []byte) string {
 	return base64.StdEncoding.EncodeToString(data)
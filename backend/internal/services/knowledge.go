@@ -0,0 +1,288 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// KnowledgeChunkSize is the target size of a knowledge chunk in characters
+const KnowledgeChunkSize = 1000
+
+// KnowledgeTopK is how many chunks are retrieved into the prompt for a message
+const KnowledgeTopK = 3
+
+// KnowledgeMinSimilarity is the cosine similarity an embedding match needs when it shares no terms with the query
+const KnowledgeMinSimilarity = 0.35
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// rrfK dampens rank fusion so the top ranks of either ranking don't dominate
+const rrfK = 60
+
+// knowledgeStopwords are common English words left out of the BM25 index
+var knowledgeStopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "but": true,
+	"by": true, "do": true, "for": true, "from": true, "has": true, "have": true, "he": true, "her": true,
+	"his": true, "i": true, "in": true, "is": true, "it": true, "its": true, "me": true, "my": true,
+	"of": true, "on": true, "or": true, "she": true, "so": true, "that": true, "the": true, "their": true,
+	"them": true, "they": true, "this": true, "to": true, "was": true, "we": true, "were": true, "what": true,
+	"when": true, "where": true, "which": true, "who": true, "will": true, "with": true, "you": true, "your": true,
+}
+
+// KnowledgeChunk is a passage of a knowledge document
+type KnowledgeChunk struct {
+	ID            string
+	DocumentID    string
+	DocumentTitle string
+	Position      int
+	Content       string
+	Embedding     []float64 // Empty when no embedding backend was configured at upload
+}
+
+// KnowledgeHit is a chunk retrieved for a query
+type KnowledgeHit struct {
+	Chunk KnowledgeChunk
+	Score float64
+}
+
+// ChunkDocument splits a text or markdown document into chunks of about KnowledgeChunkSize characters.
+// Chunks follow paragraph boundaries, and a markdown heading always starts a new chunk.
+// Paragraphs longer than a chunk are split between words.
+func ChunkDocument(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var chunks []string
+	var current strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			chunks = append(chunks, s)
+		}
+		current.Reset()
+	}
+
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		if strings.HasPrefix(paragraph, "#") || current.Len()+len(paragraph)+2 > KnowledgeChunkSize {
+			flush()
+		}
+		for len(paragraph) > KnowledgeChunkSize {
+			cut := strings.LastIndexAny(paragraph[:KnowledgeChunkSize], " \n\t")
+			if cut <= 0 {
+				// No space to break at (e.g. CJK text), so cut at a character boundary
+				cut = KnowledgeChunkSize
+				for cut > 0 && !utf8.RuneStart(paragraph[cut]) {
+					cut--
+				}
+			}
+			current.WriteString(paragraph[:cut])
+			flush()
+			paragraph = strings.TrimSpace(paragraph[cut:])
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(paragraph)
+	}
+	flush()
+
+	return chunks
+}
+
+// knowledgeTerms lowercases text and splits it into index terms, dropping stopwords
+func knowledgeTerms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := words[:0]
+	for _, w := range words {
+		if len([]rune(w)) > 1 && !knowledgeStopwords[w] {
+			terms = append(terms, w)
+		}
+	}
+	return terms
+}
+
+// KnowledgeIndex is an in-memory BM25 index over a companion's knowledge chunks,
+// fused with embedding similarity for chunks that have embeddings
+type KnowledgeIndex struct {
+	chunks    []KnowledgeChunk
+	termFreqs []map[string]int
+	lengths   []int
+	docFreq   map[string]int
+	avgLength float64
+}
+
+// NewKnowledgeIndex indexes chunks for retrieval
+func NewKnowledgeIndex(chunks []KnowledgeChunk) *KnowledgeIndex {
+	ix := &KnowledgeIndex{
+		chunks:    chunks,
+		termFreqs: make([]map[string]int, len(chunks)),
+		lengths:   make([]int, len(chunks)),
+		docFreq:   make(map[string]int),
+	}
+
+	total := 0
+	for i, chunk := range chunks {
+		terms := knowledgeTerms(chunk.DocumentTitle + "\n" + chunk.Content)
+		freqs := make(map[string]int, len(terms))
+		for _, term := range terms {
+			freqs[term]++
+		}
+		for term := range freqs {
+			ix.docFreq[term]++
+		}
+		ix.termFreqs[i] = freqs
+		ix.lengths[i] = len(terms)
+		total += len(terms)
+	}
+	if len(chunks) > 0 {
+		ix.avgLength = float64(total) / float64(len(chunks))
+	}
+	return ix
+}
+
+// Len returns the number of indexed chunks
+func (ix *KnowledgeIndex) Len() int {
+	return len(ix.chunks)
+}
+
+// bm25 scores every chunk against the query terms
+func (ix *KnowledgeIndex) bm25(query string) []float64 {
+	scores := make([]float64, len(ix.chunks))
+	n := float64(len(ix.chunks))
+
+	seen := make(map[string]bool)
+	for _, term := range knowledgeTerms(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		df := float64(ix.docFreq[term])
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for i, freqs := range ix.termFreqs {
+			tf := float64(freqs[term])
+			if tf == 0 {
+				continue
+			}
+			norm := 1 - bm25B + bm25B*float64(ix.lengths[i])/ix.avgLength
+			scores[i] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+	return scores
+}
+
+// Search returns up to k chunks relevant to the query, best first. Without a query embedding
+// chunks are ranked by BM25; with one, the BM25 and embedding rankings are fused by reciprocal rank.
+// Chunks that share no terms with the query and are not similar enough in embedding space are left out.
+func (ix *KnowledgeIndex) Search(query string, queryEmbedding []float64, k int) []KnowledgeHit {
+	if len(ix.chunks) == 0 || k <= 0 {
+		return nil
+	}
+
+	lexical := ix.bm25(query)
+	semantic := make([]float64, len(ix.chunks))
+	for i, chunk := range ix.chunks {
+		if len(queryEmbedding) > 0 && len(chunk.Embedding) == len(queryEmbedding) {
+			semantic[i] = cosineSimilarity(queryEmbedding, chunk.Embedding)
+		}
+	}
+
+	var candidates []int
+	for i := range ix.chunks {
+		if lexical[i] > 0 || semantic[i] >= KnowledgeMinSimilarity {
+			candidates = append(candidates, i)
+		}
+	}
+
+	scores := make(map[int]float64, len(candidates))
+	if len(queryEmbedding) == 0 {
+		for _, i := range candidates {
+			scores[i] = lexical[i]
+		}
+	} else {
+		for _, ranking := range [][]float64{lexical, semantic} {
+			ranked := append([]int(nil), candidates...)
+			sort.SliceStable(ranked, func(a, b int) bool { return ranking[ranked[a]] > ranking[ranked[b]] })
+			for rank, i := range ranked {
+				if ranking[i] > 0 {
+					scores[i] += 1 / float64(rrfK+rank+1)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool { return scores[candidates[a]] > scores[candidates[b]] })
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+
+	hits := make([]KnowledgeHit, 0, len(candidates))
+	for _, i := range candidates {
+		hits = append(hits, KnowledgeHit{Chunk: ix.chunks[i], Score: scores[i]})
+	}
+	return hits
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors of the same length
+func cosineSimilarity(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// KnowledgeIndexCache keeps each companion's knowledge index in memory.
+// Entries carry a version so a change to the companion's documents, made by
+// any server instance, is noticed and the index rebuilt.
+type KnowledgeIndexCache struct {
+	mu      sync.Mutex
+	entries map[string]knowledgeCacheEntry
+}
+
+type knowledgeCacheEntry struct {
+	version string
+	index   *KnowledgeIndex
+}
+
+// NewKnowledgeIndexCache creates an empty cache
+func NewKnowledgeIndexCache() *KnowledgeIndexCache {
+	return &KnowledgeIndexCache{entries: make(map[string]knowledgeCacheEntry)}
+}
+
+// Get returns the companion's index if it was built for this version of its documents
+func (c *KnowledgeIndexCache) Get(companionID, version string) (*KnowledgeIndex, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[companionID]
+	if !ok || entry.version != version {
+		return nil, false
+	}
+	return entry.index, true
+}
+
+// Put stores the companion's index for a version of its documents
+func (c *KnowledgeIndexCache) Put(companionID, version string, index *KnowledgeIndex) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[companionID] = knowledgeCacheEntry{version: version, index: index}
+}
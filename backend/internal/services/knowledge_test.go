@@ -0,0 +1,126 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkDocumentFollowsParagraphsAndHeadings(t *testing.T) {
+	doc := "# Childhood\n\nMia grew up in Taipei.\n\nShe loved painting.\n\n# Career\n\nShe moved to San Francisco."
+	chunks := ChunkDocument(doc)
+	if len(chunks) != 2 {
+		t.Fatalf("ChunkDocument returned %d chunks, want 2: %q", len(chunks), chunks)
+	}
+	if !strings.HasPrefix(chunks[0], "# Childhood") || !strings.Contains(chunks[0], "She loved painting.") {
+		t.Errorf("first chunk = %q", chunks[0])
+	}
+	if !strings.HasPrefix(chunks[1], "# Career") {
+		t.Errorf("second chunk = %q", chunks[1])
+	}
+}
+
+func TestChunkDocumentSplitsLongParagraphs(t *testing.T) {
+	paragraph := strings.Repeat("word ", KnowledgeChunkSize/2)
+	chunks := ChunkDocument(paragraph)
+	if len(chunks) < 3 {
+		t.Fatalf("ChunkDocument returned %d chunks, want at least 3", len(chunks))
+	}
+	for _, chunk := range chunks {
+		if len(chunk) > KnowledgeChunkSize {
+			t.Errorf("chunk of %d characters exceeds the chunk size", len(chunk))
+		}
+		if strings.HasPrefix(chunk, "ord") || strings.HasSuffix(chunk, "wor") {
+			t.Errorf("chunk splits a word: %q...", chunk[:10])
+		}
+	}
+
+	if got := ChunkDocument(" \n\n \r\n"); len(got) != 0 {
+		t.Errorf("blank document gave chunks %q", got)
+	}
+}
+
+func TestChunkDocumentKeepsCharactersWhole(t *testing.T) {
+	// CJK text has no spaces to split at
+	paragraph := strings.Repeat("東京の夜景", 160)
+	chunks := ChunkDocument(paragraph)
+	if len(chunks) < 2 {
+		t.Fatalf("ChunkDocument returned %d chunks, want at least 2", len(chunks))
+	}
+	for _, chunk := range chunks {
+		if !utf8.ValidString(chunk) {
+			t.Errorf("chunk is not valid UTF-8: %q", chunk)
+		}
+		if len(chunk) > KnowledgeChunkSize {
+			t.Errorf("chunk of %d bytes exceeds the chunk size", len(chunk))
+		}
+	}
+	if got := strings.Join(chunks, ""); got != paragraph {
+		t.Error("chunks do not add up to the paragraph")
+	}
+}
+
+func testKnowledgeChunks() []KnowledgeChunk {
+	return []KnowledgeChunk{
+		{ID: "1", DocumentTitle: "Backstory", Content: "Mia grew up in Taipei with her grandmother, who taught her calligraphy."},
+		{ID: "2", DocumentTitle: "Backstory", Content: "Her favourite food is beef noodle soup from the night market."},
+		{ID: "3", DocumentTitle: "Career", Content: "Mia works as a muralist in San Francisco and paints murals in the Mission."},
+	}
+}
+
+func TestKnowledgeIndexSearchBM25(t *testing.T) {
+	ix := NewKnowledgeIndex(testKnowledgeChunks())
+
+	hits := ix.Search("What is your favourite food?", nil, 3)
+	if len(hits) != 1 || hits[0].Chunk.ID != "2" {
+		t.Fatalf("Search(food) = %+v, want chunk 2 only", hits)
+	}
+
+	hits = ix.Search("Tell me about the murals you paint", nil, 3)
+	if len(hits) == 0 || hits[0].Chunk.ID != "3" {
+		t.Errorf("Search(murals) should rank chunk 3 first, got %+v", hits)
+	}
+
+	if hits := ix.Search("the and of", nil, 3); len(hits) != 0 {
+		t.Errorf("stopwords alone should match nothing, got %+v", hits)
+	}
+	if hits := ix.Search("Taipei Mia murals", nil, 1); len(hits) != 1 {
+		t.Errorf("Search should return at most k hits, got %d", len(hits))
+	}
+}
+
+func TestKnowledgeIndexSearchWithEmbeddings(t *testing.T) {
+	chunks := testKnowledgeChunks()
+	chunks[0].Embedding = []float64{1, 0, 0}
+	chunks[1].Embedding = []float64{0, 1, 0}
+	chunks[2].Embedding = []float64{0, 0, 1}
+	ix := NewKnowledgeIndex(chunks)
+
+	// No shared terms, but close in embedding space
+	hits := ix.Search("Who raised you?", []float64{0.9, 0.1, 0}, 3)
+	if len(hits) != 1 || hits[0].Chunk.ID != "1" {
+		t.Errorf("Search should find chunk 1 by embedding, got %+v", hits)
+	}
+
+	// Chunks found both ways outrank chunks found one way
+	hits = ix.Search("murals in Taipei", []float64{0, 0, 1}, 3)
+	if len(hits) != 2 || hits[0].Chunk.ID != "3" {
+		t.Errorf("Search should rank chunk 3 first, got %+v", hits)
+	}
+}
+
+func TestKnowledgeIndexCacheVersions(t *testing.T) {
+	cache := NewKnowledgeIndexCache()
+	ix := NewKnowledgeIndex(nil)
+	cache.Put("mia", "1/a", ix)
+
+	if got, ok := cache.Get("mia", "1/a"); !ok || got != ix {
+		t.Error("expected a cache hit for the same version")
+	}
+	if _, ok := cache.Get("mia", "2/b"); ok {
+		t.Error("a new version of the documents should miss the cache")
+	}
+	if _, ok := cache.Get("sofia", "1/a"); ok {
+		t.Error("other companions should miss the cache")
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LoreScanDepth is how many of the latest messages are scanned for lorebook keywords
+const LoreScanDepth = 4
+
+// LoreBudget caps the characters of lorebook content added to the system prompt
+const LoreBudget = 2000
+
+// LoreEntry is a piece of world info inserted into the system prompt when its keywords come up
+type LoreEntry struct {
+	Keywords []string
+	Content  string
+	Priority int
+	AlwaysOn bool
+}
+
+// SelectLore picks the entries to insert for the recent messages: always-on entries and entries
+// whose keywords appear in the messages, highest priority first, skipping any that would exceed budget characters.
+func SelectLore(entries []LoreEntry, recent []string, budget int) []LoreEntry {
+	text := strings.ToLower(strings.Join(recent, "\n"))
+
+	var matched []LoreEntry
+	for _, entry := range entries {
+		if strings.TrimSpace(entry.Content) == "" {
+			continue
+		}
+		if entry.AlwaysOn || matchesAnyKeyword(text, entry.Keywords) {
+			matched = append(matched, entry)
+		}
+	}
+
+	// Always-on entries first, then by priority; ties keep the given order
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].AlwaysOn != matched[j].AlwaysOn {
+			return matched[i].AlwaysOn
+		}
+		return matched[i].Priority > matched[j].Priority
+	})
+
+	var selected []LoreEntry
+	used := 0
+	for _, entry := range matched {
+		size := utf8.RuneCountInString(entry.Content)
+		if used+size > budget {
+			continue
+		}
+		selected = append(selected, entry)
+		used += size
+	}
+	return selected
+}
+
+// matchesAnyKeyword reports whether any keyword appears as a whole word or phrase in the lowercased text
+func matchesAnyKeyword(text string, keywords []string) bool {
+	for _, keyword := range keywords {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword != "" && containsWord(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsWord reports whether word occurs in text without letters or digits on either side
+func containsWord(text, word string) bool {
+	for offset := 0; offset < len(text); {
+		i := strings.Index(text[offset:], word)
+		if i < 0 {
+			return false
+		}
+		start := offset + i
+		end := start + len(word)
+
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(text[start:])
+		offset = start + size
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// CharacterBookEntry is an entry of a Character Card V2 character_book
+type CharacterBookEntry struct {
+	Keys           []string        `json:"keys"`
+	Content        string          `json:"content"`
+	Extensions     json.RawMessage `json:"extensions"`
+	Enabled        bool            `json:"enabled"`
+	InsertionOrder int             `json:"insertion_order"`
+	Priority       int             `json:"priority"`
+	Constant       bool            `json:"constant"`
+}
+
+// LoreFromCharacterBook reads the enabled entries of a character_book as lorebook entries
+func LoreFromCharacterBook(raw json.RawMessage) []LoreEntry {
+	var book struct {
+		Entries []struct {
+			Keys     []string `json:"keys"`
+			Content  string   `json:"content"`
+			Enabled  *bool    `json:"enabled"`
+			Priority *int     `json:"priority"`
+			Order    int      `json:"insertion_order"`
+			Constant bool     `json:"constant"`
+		} `json:"entries"`
+	}
+	// Tolerate mistyped books from hand-edited cards
+	if err := json.Unmarshal(raw, &book); err != nil {
+		return nil
+	}
+
+	var lore []LoreEntry
+	for _, e := range book.Entries {
+		if (e.Enabled != nil && !*e.Enabled) || strings.TrimSpace(e.Content) == "" {
+			continue
+		}
+		// Cards without priorities order entries by insertion_order instead
+		priority := e.Order
+		if e.Priority != nil {
+			priority = *e.Priority
+		}
+		lore = append(lore, LoreEntry{Keywords: e.Keys, Content: e.Content, Priority: priority, AlwaysOn: e.Constant})
+	}
+	return lore
+}
+
+// CharacterBookEntries converts lorebook entries to character_book entries
+func CharacterBookEntries(lore []LoreEntry) []CharacterBookEntry {
+	entries := make([]CharacterBookEntry, 0, len(lore))
+	for i, entry := range lore {
+		keys := entry.Keywords
+		if keys == nil {
+			keys = []string{}
+		}
+		entries = append(entries, CharacterBookEntry{
+			Keys:           keys,
+			Content:        entry.Content,
+			Extensions:     json.RawMessage(`{}`),
+			Enabled:        true,
+			InsertionOrder: i,
+			Priority:       entry.Priority,
+			Constant:       entry.AlwaysOn,
+		})
+	}
+	return entries
+}
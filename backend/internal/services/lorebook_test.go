@@ -0,0 +1,104 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func loreContents(entries []LoreEntry) []string {
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Content)
+	}
+	return out
+}
+
+func TestSelectLoreMatchesWholeKeywords(t *testing.T) {
+	entries := []LoreEntry{
+		{Keywords: []string{"Glade"}, Content: "The glade is hidden."},
+		{Keywords: []string{"old oak"}, Content: "The old oak speaks."},
+		{Keywords: []string{"sword"}, Content: "The sword is cursed."},
+	}
+
+	got := loreContents(SelectLore(entries, []string{"Have you seen the GLADE?", "Swordsmen came by the old  oak"}, LoreBudget))
+	if len(got) != 1 || got[0] != "The glade is hidden." {
+		t.Errorf("SelectLore = %v, want only the glade entry", got)
+	}
+
+	got = loreContents(SelectLore(entries, []string{"Meet me at the old oak, with your sword."}, LoreBudget))
+	if len(got) != 2 {
+		t.Errorf("SelectLore = %v, want the oak and sword entries", got)
+	}
+}
+
+func TestSelectLoreOrderAndBudget(t *testing.T) {
+	entries := []LoreEntry{
+		{Keywords: []string{"castle"}, Content: "low", Priority: 1},
+		{Keywords: []string{"castle"}, Content: "high-priority", Priority: 10},
+		{Content: "always", AlwaysOn: true},
+		{Keywords: []string{"castle"}, Content: "this entry is far too long to fit", Priority: 5},
+	}
+
+	got := loreContents(SelectLore(entries, []string{"the castle"}, 25))
+	want := []string{"always", "high-priority", "low"}
+	if len(got) != len(want) {
+		t.Fatalf("SelectLore = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("SelectLore = %v, want %v", got, want)
+			break
+		}
+	}
+
+	if got := SelectLore(entries, []string{"nothing relevant"}, 20); len(got) != 1 || !got[0].AlwaysOn {
+		t.Errorf("only the always-on entry should be selected, got %v", loreContents(got))
+	}
+}
+
+func TestSelectLoreBudgetCountsCharacters(t *testing.T) {
+	// 11 characters, 33 bytes
+	entries := []LoreEntry{{Content: "ひみつのもりのおくです", AlwaysOn: true}}
+	if got := SelectLore(entries, nil, 11); len(got) != 1 {
+		t.Errorf("SelectLore = %v, want the entry to fit a budget of 11 characters", loreContents(got))
+	}
+}
+
+func TestLoreFromCharacterBook(t *testing.T) {
+	raw := json.RawMessage(`{
+		"name": "World",
+		"entries": [
+			{"keys": ["glade"], "content": "A hidden clearing.", "enabled": true, "insertion_order": 3},
+			{"keys": ["river"], "content": "Off.", "enabled": false},
+			{"keys": [], "content": "Magic is real.", "constant": true, "priority": 7},
+			{"keys": ["empty"], "content": "  "}
+		]
+	}`)
+
+	lore := LoreFromCharacterBook(raw)
+	if len(lore) != 2 {
+		t.Fatalf("LoreFromCharacterBook returned %d entries, want 2: %+v", len(lore), lore)
+	}
+	if lore[0].Content != "A hidden clearing." || lore[0].Priority != 3 || lore[0].Keywords[0] != "glade" {
+		t.Errorf("first entry = %+v", lore[0])
+	}
+	if !lore[1].AlwaysOn || lore[1].Priority != 7 {
+		t.Errorf("second entry = %+v", lore[1])
+	}
+
+	if LoreFromCharacterBook(json.RawMessage(`"not a book"`)) != nil {
+		t.Error("a malformed book should give no entries")
+	}
+}
+
+func TestCharacterBookEntries(t *testing.T) {
+	entries := CharacterBookEntries([]LoreEntry{{Content: "Magic is real.", AlwaysOn: true, Priority: 2}})
+	out, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatalf("Marshal returned error: %v", err)
+	}
+	want := `[{"keys":[],"content":"Magic is real.","extensions":{},"enabled":true,"insertion_order":0,"priority":2,"constant":true}]`
+	if string(out) != want {
+		t.Errorf("entries = %s, want %s", out, want)
+	}
+}
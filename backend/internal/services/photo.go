@@ -0,0 +1,46 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+// PhotoMarker is the tag the system prompt asks companions to put in front of photo descriptions
+const PhotoMarker = "[Photo]"
+
+// photoMarkerPattern finds PhotoMarker in any case. It matches on the reply itself, as
+// lowercasing can change the byte length of text before the marker.
+var photoMarkerPattern = regexp.MustCompile(`(?i)` + regexp.QuoteMeta(PhotoMarker))
+
+// PhotoReply is an AI reply split around the photo marker
+type PhotoReply struct {
+	Caption     string // Short message sent alongside the photo
+	Description string // First-person description of the photo, used as the image prompt context
+}
+
+// ParsePhotoReply detects the [Photo] marker in a reply and splits the caption from the description.
+// It returns false if the reply does not contain a photo.
+func ParsePhotoReply(reply string) (*PhotoReply, bool) {
+	loc := photoMarkerPattern.FindStringIndex(reply)
+	if loc == nil {
+		return nil, false
+	}
+
+	description := strings.TrimSpace(reply[loc[1]:])
+	if description == "" {
+		return nil, false
+	}
+
+	return &PhotoReply{
+		Caption:     strings.TrimSpace(reply[:loc[0]]),
+		Description: description,
+	}, true
+}
+
+// FallbackText returns the reply as plain text without the marker, used when image generation fails
+func (p *PhotoReply) FallbackText() string {
+	if p.Caption == "" {
+		return p.Description
+	}
+	return p.Caption + " " + p.Description
+}
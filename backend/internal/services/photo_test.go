@@ -0,0 +1,96 @@
+package services
+
+import (
+	"testing"
+)
+
+func TestParsePhotoReply(t *testing.T) {
+	tests := []struct {
+		name            string
+		reply           string
+		wantOK          bool
+		wantCaption     string
+		wantDescription string
+	}{
+		{
+			name:            "Caption before marker",
+			reply:           "Just took this for you! [Photo] I'm sitting by my window with golden hour light.",
+			wantOK:          true,
+			wantCaption:     "Just took this for you!",
+			wantDescription: "I'm sitting by my window with golden hour light.",
+		},
+		{
+			name:            "Marker at start",
+			reply:           "[Photo] I'm lying on my bed with fairy lights behind me.",
+			wantOK:          true,
+			wantCaption:     "",
+			wantDescription: "I'm lying on my bed with fairy lights behind me.",
+		},
+		{
+			name:            "Lowercase marker",
+			reply:           "Here you go [photo] standing against a pretty wall",
+			wantOK:          true,
+			wantCaption:     "Here you go",
+			wantDescription: "standing against a pretty wall",
+		},
+		{
+			name:            "Text that grows when lowercased",
+			reply:           "İstanbul sunset! [Photo] me on the Galata bridge",
+			wantOK:          true,
+			wantCaption:     "İstanbul sunset!",
+			wantDescription: "me on the Galata bridge",
+		},
+		{
+			name:            "Text that shrinks when lowercased",
+			reply:           "ȺȺȺȺȺȺȺȺȺȺ[Photo] a sunny street",
+			wantOK:          true,
+			wantCaption:     "ȺȺȺȺȺȺȺȺȺȺ",
+			wantDescription: "a sunny street",
+		},
+		{
+			name:   "Non-ASCII text before a trailing marker",
+			reply:  "ȺȺȺȺȺȺȺȺȺȺ[Photo]",
+			wantOK: false,
+		},
+		{
+			name:   "No marker",
+			reply:  "That's really interesting! Tell me more about it.",
+			wantOK: false,
+		},
+		{
+			name:   "Marker without description",
+			reply:  "Sending you this! [Photo]",
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			photo, ok := ParsePhotoReply(tt.reply)
+			if ok != tt.wantOK {
+				t.Fatalf("ParsePhotoReply ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if photo.Caption != tt.wantCaption {
+				t.Errorf("Caption = %q, want %q", photo.Caption, tt.wantCaption)
+			}
+			if photo.Description != tt.wantDescription {
+				t.Errorf("Description = %q, want %q", photo.Description, tt.wantDescription)
+			}
+		})
+	}
+}
+
+func TestPhotoReplyFallbackText(t *testing.T) {
+	photo := &PhotoReply{Caption: "Just took this!", Description: "I'm at the beach."}
+	if got := photo.FallbackText(); got != "Just took this! I'm at the beach." {
+		t.Errorf("FallbackText = %q", got)
+	}
+
+	photo = &PhotoReply{Description: "I'm at the beach."}
+	if got := photo.FallbackText(); got != "I'm at the beach." {
+		t.Errorf("FallbackText without caption = %q", got)
+	}
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Recommendation reasons, returned to clients so they can label suggestions
+const (
+	ReasonSimilarCompanions = "similar_to_your_chats"
+	ReasonSimilarUsers      = "popular_with_similar_users"
+	ReasonTags              = "matches_your_tags"
+	ReasonMood              = "fits_your_mood"
+	// ReasonTrending marks trending companions used to fill in on cold start
+	ReasonTrending = "trending"
+)
+
+// moodTraits maps each mood to the personality sliders that suit it
+var moodTraits = map[string][]string{
+	"calm":     {"friendliness"},
+	"romantic": {"romantic", "flirty"},
+	"playful":  {"humor", "flirty"},
+	"deep":     {"intelligence"},
+}
+
+// Interaction is how much a user has chatted with a companion, e.g. their message count
+type Interaction struct {
+	UserID      string
+	CompanionID string
+	Weight      float64
+}
+
+// RecommendCandidate is a companion that may be recommended
+type RecommendCandidate struct {
+	ID          string
+	Tags        []string
+	Personality map[string]interface{}
+}
+
+// RecommendProfile is what is known about the user being recommended to
+type RecommendProfile struct {
+	UserID string
+	// Moods is the share of each mood in the user's mood history
+	Moods map[string]float64
+	// Tags weights the tags the user likes, from favourites and chatted companions
+	Tags map[string]float64
+}
+
+// Recommendation is a scored candidate with the signals that contributed most
+type Recommendation struct {
+	CompanionID string
+	Score       float64
+	Reasons     []string
+}
+
+// Recommender blends item-item co-occurrence, similar users, tag affinity and mood fit
+type Recommender struct {
+	ItemWeight float64
+	UserWeight float64
+	TagWeight  float64
+	MoodWeight float64
+	// Neighbours is how many of the most similar users are consulted
+	Neighbours int
+}
+
+// NewRecommender returns a recommender with the default signal weights
+func NewRecommender() *Recommender {
+	return &Recommender{
+		ItemWeight: 0.4,
+		UserWeight: 0.3,
+		TagWeight:  0.2,
+		MoodWeight: 0.1,
+		Neighbours: 20,
+	}
+}
+
+// Recommend ranks candidates the user has not chatted with yet.
+// It returns nothing on cold start, when the user has no chats and no liked tags.
+func (r *Recommender) Recommend(profile RecommendProfile, interactions []Interaction, candidates []RecommendCandidate, limit int) []Recommendation {
+	// Damp heavy chatters so one long conversation does not dominate
+	users := make(map[string]map[string]float64)
+	for _, in := range interactions {
+		if in.Weight <= 0 {
+			continue
+		}
+		if users[in.UserID] == nil {
+			users[in.UserID] = make(map[string]float64)
+		}
+		users[in.UserID][in.CompanionID] += math.Log1p(in.Weight)
+	}
+
+	mine := users[profile.UserID]
+	if len(mine) == 0 && len(profile.Tags) == 0 {
+		return nil
+	}
+
+	signals := map[string]map[string]float64{
+		ReasonSimilarCompanions: itemScores(users, mine),
+		ReasonSimilarUsers:      r.userScores(users, profile.UserID),
+		ReasonTags:              make(map[string]float64),
+		ReasonMood:              make(map[string]float64),
+	}
+	for _, cand := range candidates {
+		signals[ReasonTags][cand.ID] = tagScore(profile.Tags, cand.Tags)
+		signals[ReasonMood][cand.ID] = moodScore(profile.Moods, cand.Personality)
+	}
+	weights := map[string]float64{
+		ReasonSimilarCompanions: r.ItemWeight,
+		ReasonSimilarUsers:      r.UserWeight,
+		ReasonTags:              r.TagWeight,
+		ReasonMood:              r.MoodWeight,
+	}
+
+	// Scale each signal to [0, 1] across the candidates so the weights are comparable
+	for _, scores := range signals {
+		var max float64
+		for _, cand := range candidates {
+			max = math.Max(max, scores[cand.ID])
+		}
+		for id := range scores {
+			if max > 0 {
+				scores[id] /= max
+			} else {
+				scores[id] = 0
+			}
+		}
+	}
+
+	var recs []Recommendation
+	for _, cand := range candidates {
+		if _, chatted := mine[cand.ID]; chatted {
+			continue
+		}
+
+		rec := Recommendation{CompanionID: cand.ID}
+		for _, reason := range []string{ReasonSimilarCompanions, ReasonSimilarUsers, ReasonTags, ReasonMood} {
+			contribution := weights[reason] * signals[reason][cand.ID]
+			rec.Score += contribution
+			// Mention signals that carry at least half of their full weight
+			if contribution > 0 && contribution >= weights[reason]/2 {
+				rec.Reasons = append(rec.Reasons, reason)
+			}
+		}
+		// Mood alone says little about a companion, so require a behavioural or tag signal
+		if rec.Score-weights[ReasonMood]*signals[ReasonMood][cand.ID] <= 0 {
+			continue
+		}
+		recs = append(recs, rec)
+	}
+
+	sort.SliceStable(recs, func(i, j int) bool {
+		if recs[i].Score != recs[j].Score {
+			return recs[i].Score > recs[j].Score
+		}
+		return recs[i].CompanionID < recs[j].CompanionID
+	})
+	if limit > 0 && len(recs) > limit {
+		recs = recs[:limit]
+	}
+	return recs
+}
+
+// itemScores scores companions by cosine similarity of their chatter vectors to the ones the user chats with
+func itemScores(users map[string]map[string]float64, mine map[string]float64) map[string]float64 {
+	norms := make(map[string]float64)
+	// co[i][j] is the dot product of companion i's and j's chatter vectors
+	co := make(map[string]map[string]float64)
+	for _, items := range users {
+		for i, wi := range items {
+			norms[i] += wi * wi
+			if _, ok := mine[i]; !ok {
+				continue
+			}
+			if co[i] == nil {
+				co[i] = make(map[string]float64)
+			}
+			for j, wj := range items {
+				if i != j {
+					co[i][j] += wi * wj
+				}
+			}
+		}
+	}
+
+	scores := make(map[string]float64)
+	for i, wi := range mine {
+		for j, dot := range co[i] {
+			scores[j] += wi * dot / math.Sqrt(norms[i]*norms[j])
+		}
+	}
+	return scores
+}
+
+// userScores scores companions by how much the user's nearest neighbours chat with them
+func (r *Recommender) userScores(users map[string]map[string]float64, userID string) map[string]float64 {
+	mine := users[userID]
+	scores := make(map[string]float64)
+	if len(mine) == 0 {
+		return scores
+	}
+
+	type neighbour struct {
+		id  string
+		sim float64
+	}
+	var neighbours []neighbour
+	for id, items := range users {
+		if id == userID {
+			continue
+		}
+		if sim := cosine(mine, items); sim > 0 {
+			neighbours = append(neighbours, neighbour{id, sim})
+		}
+	}
+	sort.Slice(neighbours, func(i, j int) bool {
+		if neighbours[i].sim != neighbours[j].sim {
+			return neighbours[i].sim > neighbours[j].sim
+		}
+		return neighbours[i].id < neighbours[j].id
+	})
+	if len(neighbours) > r.Neighbours {
+		neighbours = neighbours[:r.Neighbours]
+	}
+
+	for _, n := range neighbours {
+		for item, w := range users[n.id] {
+			scores[item] += n.sim * w
+		}
+	}
+	return scores
+}
+
+// cosine is the cosine similarity of two sparse vectors
+func cosine(a, b map[string]float64) float64 {
+	var dot, na, nb float64
+	for k, v := range a {
+		na += v * v
+		dot += v * b[k]
+	}
+	for _, v := range b {
+		nb += v * v
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// tagScore sums the user's weights for the candidate's tags, damped by how many tags it has
+func tagScore(liked map[string]float64, tags []string) float64 {
+	if len(liked) == 0 || len(tags) == 0 {
+		return 0
+	}
+	var score float64
+	for _, tag := range tags {
+		score += liked[strings.ToLower(strings.TrimSpace(tag))]
+	}
+	return score / math.Sqrt(float64(len(tags)))
+}
+
+// moodScore rates how well a companion's personality sliders (0-100) fit the user's mood history
+func moodScore(moods map[string]float64, personality map[string]interface{}) float64 {
+	var score float64
+	for mood, share := range moods {
+		traits := moodTraits[mood]
+		for _, trait := range traits {
+			var v float64
+			switch n := personality[trait].(type) {
+			case float64:
+				v = n
+			case int:
+				v = float64(n)
+			}
+			score += share * v / 100 / float64(len(traits))
+		}
+	}
+	return score
+}
@@ -0,0 +1,80 @@
+package services
+
+import "testing"
+
+func recommendIDs(recs []Recommendation) []string {
+	ids := make([]string, len(recs))
+	for i, r := range recs {
+		ids[i] = r.CompanionID
+	}
+	return ids
+}
+
+func TestRecommendColdStart(t *testing.T) {
+	recs := NewRecommender().Recommend(
+		RecommendProfile{UserID: "new", Moods: map[string]float64{"calm": 1}},
+		[]Interaction{{UserID: "other", CompanionID: "a", Weight: 5}},
+		[]RecommendCandidate{{ID: "a"}, {ID: "b"}},
+		10,
+	)
+	if len(recs) != 0 {
+		t.Errorf("expected no recommendations on cold start, got %v", recommendIDs(recs))
+	}
+}
+
+func TestRecommendCoOccurrence(t *testing.T) {
+	// Everyone who chats with a also chats with b; c is only chatted with alone
+	interactions := []Interaction{
+		{UserID: "me", CompanionID: "a", Weight: 10},
+		{UserID: "u1", CompanionID: "a", Weight: 4},
+		{UserID: "u1", CompanionID: "b", Weight: 6},
+		{UserID: "u2", CompanionID: "a", Weight: 8},
+		{UserID: "u2", CompanionID: "b", Weight: 2},
+		{UserID: "u3", CompanionID: "c", Weight: 50},
+	}
+	candidates := []RecommendCandidate{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+
+	recs := NewRecommender().Recommend(RecommendProfile{UserID: "me"}, interactions, candidates, 10)
+	if len(recs) != 1 || recs[0].CompanionID != "b" {
+		t.Fatalf("expected only b, got %v", recommendIDs(recs))
+	}
+	reasons := map[string]bool{}
+	for _, r := range recs[0].Reasons {
+		reasons[r] = true
+	}
+	if !reasons[ReasonSimilarCompanions] || !reasons[ReasonSimilarUsers] {
+		t.Errorf("expected co-occurrence and similar user reasons, got %v", recs[0].Reasons)
+	}
+}
+
+func TestRecommendTagsAndMood(t *testing.T) {
+	profile := RecommendProfile{
+		UserID: "me",
+		Moods:  map[string]float64{"deep": 1},
+		Tags:   map[string]float64{"artist": 2, "bookworm": 1},
+	}
+	candidates := []RecommendCandidate{
+		{ID: "gamer", Tags: []string{"Gamer"}, Personality: map[string]interface{}{"intelligence": 100.0}},
+		{ID: "painter", Tags: []string{"Artist", "Creative"}, Personality: map[string]interface{}{"intelligence": 40.0}},
+		{ID: "reader", Tags: []string{"Bookworm"}, Personality: map[string]interface{}{"intelligence": 90.0}},
+	}
+
+	recs := NewRecommender().Recommend(profile, nil, candidates, 10)
+	got := recommendIDs(recs)
+	// gamer fits the mood but matches no liked tag, so it is left out
+	if len(got) != 2 || got[0] != "painter" || got[1] != "reader" {
+		t.Errorf("unexpected ranking %v", got)
+	}
+}
+
+func TestRecommendLimit(t *testing.T) {
+	profile := RecommendProfile{UserID: "me", Tags: map[string]float64{"cute": 1}}
+	candidates := []RecommendCandidate{
+		{ID: "a", Tags: []string{"cute"}},
+		{ID: "b", Tags: []string{"cute"}},
+		{ID: "c", Tags: []string{"cute"}},
+	}
+	if recs := NewRecommender().Recommend(profile, nil, candidates, 2); len(recs) != 2 {
+		t.Errorf("expected 2 recommendations, got %d", len(recs))
+	}
+}
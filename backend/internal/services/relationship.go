@@ -0,0 +1,29 @@
+package services
+
+// relationshipThresholds is how many messages a user needs to send a companion to reach each level, starting at level 1
+var relationshipThresholds = [...]int{0, 20, 100, 250, 500}
+
+// MaxRelationshipLevel is the highest relationship level
+const MaxRelationshipLevel = len(relationshipThresholds)
+
+// RelationshipLevel returns the level (1 to MaxRelationshipLevel) a user has reached with a companion after sending it messages
+func RelationshipLevel(messages int) int {
+	level := 0
+	for _, threshold := range relationshipThresholds {
+		if messages >= threshold {
+			level++
+		}
+	}
+	return level
+}
+
+// MessagesForLevel returns how many messages unlock a relationship level
+func MessagesForLevel(level int) int {
+	if level <= 1 {
+		return 0
+	}
+	if level > MaxRelationshipLevel {
+		level = MaxRelationshipLevel
+	}
+	return relationshipThresholds[level-1]
+}
@@ -0,0 +1,36 @@
+package services
+
+import "testing"
+
+func TestRelationshipLevel(t *testing.T) {
+	tests := []struct {
+		messages int
+		want     int
+	}{
+		{0, 1},
+		{19, 1},
+		{20, 2},
+		{99, 2},
+		{100, 3},
+		{499, 4},
+		{500, 5},
+		{10000, MaxRelationshipLevel},
+	}
+
+	for _, tt := range tests {
+		if got := RelationshipLevel(tt.messages); got != tt.want {
+			t.Errorf("RelationshipLevel(%d) = %d, want %d", tt.messages, got, tt.want)
+		}
+	}
+}
+
+func TestMessagesForLevel(t *testing.T) {
+	for level := 1; level <= MaxRelationshipLevel; level++ {
+		if got := RelationshipLevel(MessagesForLevel(level)); got != level {
+			t.Errorf("MessagesForLevel(%d) reaches level %d", level, got)
+		}
+	}
+	if MessagesForLevel(0) != 0 || MessagesForLevel(99) != MessagesForLevel(MaxRelationshipLevel) {
+		t.Error("MessagesForLevel should clamp out-of-range levels")
+	}
+}
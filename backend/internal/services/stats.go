@@ -0,0 +1,199 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"time"
+)
+
+// storyViewWeight is how much a story view counts towards trending compared to a message
+const storyViewWeight = 0.5
+
+// ActivityBucket is weighted activity on a companion during one hour
+type ActivityBucket struct {
+	At     time.Time
+	Weight float64
+}
+
+// TrendingScore sums activity with exponential time decay: activity loses half its weight every halfLife
+func TrendingScore(buckets []ActivityBucket, now time.Time, halfLife time.Duration) float64 {
+	var score float64
+	for _, b := range buckets {
+		age := now.Sub(b.At)
+		if age < 0 {
+			age = 0
+		}
+		score += b.Weight * math.Pow(0.5, age.Hours()/halfLife.Hours())
+	}
+	return score
+}
+
+// StatsService aggregates per-companion popularity metrics into companion_stats, and how many
+// messages each user sent each companion into chat_interactions
+type StatsService struct {
+	db       *sql.DB
+	interval time.Duration
+	halfLife time.Duration
+	window   time.Duration
+}
+
+// NewStatsService creates the aggregator from STATS_REFRESH_INTERVAL and STATS_TRENDING_HALF_LIFE
+func NewStatsService(db *sql.DB) *StatsService {
+	interval, err := time.ParseDuration(os.Getenv("STATS_REFRESH_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	halfLife, err := time.ParseDuration(os.Getenv("STATS_TRENDING_HALF_LIFE"))
+	if err != nil || halfLife <= 0 {
+		halfLife = 48 * time.Hour
+	}
+
+	return &StatsService{
+		db:       db,
+		interval: interval,
+		halfLife: halfLife,
+		// Older activity adds less than 1/128 of its weight, so it is skipped
+		window: 7 * halfLife,
+	}
+}
+
+// Run refreshes the stats now and then every interval until stop is closed
+func (s *StatsService) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(); err != nil {
+			log.Printf("Failed to refresh companion stats: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Refresh recomputes every companion's totals and trending score, and the chat interactions,
+// in one transaction
+func (s *StatsService) Refresh() error {
+	now := time.Now()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Totals across signed-in and public (anonymous) chats. Only messages users sent count,
+	// so regenerated replies and deleted messages do not inflate them.
+	_, err = tx.Exec(`
+		INSERT INTO companion_stats (companion_id, messages_total, unique_chatters, story_views, trending_score, computed_at)
+		SELECT c.id,
+			COALESCE(m.total, 0) + COALESCE(pm.total, 0),
+			COALESCE(m.chatters, 0) + COALESCE(pm.chatters, 0),
+			COALESCE(v.total, 0),
+			0, $1
+		FROM companions c
+		LEFT JOIN (
+			SELECT conv.companion_id, COUNT(*) AS total, COUNT(DISTINCT conv.user_id) AS chatters
+			FROM messages msg JOIN conversations conv ON conv.id = msg.conversation_id
+			WHERE msg.sender = 'user' AND msg.deleted_at IS NULL
+			GROUP BY conv.companion_id
+		) m ON m.companion_id = c.id
+		LEFT JOIN (
+			SELECT pc.companion_id, COUNT(*) AS total, COUNT(DISTINCT pc.session_id) AS chatters
+			FROM public_messages msg JOIN public_conversations pc ON pc.id = msg.conversation_id
+			WHERE msg.sender = 'user'
+			GROUP BY pc.companion_id
+		) pm ON pm.companion_id = c.id::text
+		LEFT JOIN (
+			SELECT st.companion_id, COUNT(*) AS total
+			FROM story_views sv JOIN stories st ON st.id = sv.story_id
+			GROUP BY st.companion_id
+		) v ON v.companion_id = c.id
+		ON CONFLICT (companion_id) DO UPDATE SET
+			messages_total = EXCLUDED.messages_total,
+			unique_chatters = EXCLUDED.unique_chatters,
+			story_views = EXCLUDED.story_views,
+			trending_score = 0,
+			computed_at = EXCLUDED.computed_at`,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update totals: %w", err)
+	}
+
+	// Messages per user and companion, read by recommendations
+	if _, err := tx.Exec(`DELETE FROM chat_interactions`); err != nil {
+		return fmt.Errorf("failed to clear chat interactions: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO chat_interactions (user_id, companion_id, messages)
+		SELECT conv.user_id, conv.companion_id, COUNT(*)
+		FROM messages msg JOIN conversations conv ON conv.id = msg.conversation_id
+		WHERE msg.sender = 'user' AND msg.deleted_at IS NULL
+		GROUP BY conv.user_id, conv.companion_id`)
+	if err != nil {
+		return fmt.Errorf("failed to update chat interactions: %w", err)
+	}
+
+	// Hourly activity inside the trending window
+	rows, err := tx.Query(`
+		SELECT companion_id, bucket, SUM(weight) FROM (
+			SELECT conv.companion_id::text AS companion_id, date_trunc('hour', msg.created_at) AS bucket, 1.0::float8 AS weight
+			FROM messages msg JOIN conversations conv ON conv.id = msg.conversation_id
+			WHERE msg.created_at > $1 AND msg.sender = 'user' AND msg.deleted_at IS NULL
+			UNION ALL
+			SELECT pc.companion_id, date_trunc('hour', msg.created_at), 1.0::float8
+			FROM public_messages msg JOIN public_conversations pc ON pc.id = msg.conversation_id
+			WHERE msg.created_at > $1 AND msg.sender = 'user'
+			UNION ALL
+			SELECT st.companion_id::text, date_trunc('hour', sv.viewed_at), $2::float8
+			FROM story_views sv JOIN stories st ON st.id = sv.story_id
+			WHERE sv.viewed_at > $1
+		) activity
+		GROUP BY companion_id, bucket`,
+		now.Add(-s.window), storyViewWeight,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to load activity: %w", err)
+	}
+
+	activity := make(map[string][]ActivityBucket)
+	for rows.Next() {
+		var companionID string
+		var b ActivityBucket
+		if err := rows.Scan(&companionID, &b.At, &b.Weight); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read activity: %w", err)
+		}
+		activity[companionID] = append(activity[companionID], b)
+	}
+	rows.Close()
+
+	for companionID, buckets := range activity {
+		_, err := tx.Exec(
+			`UPDATE companion_stats SET trending_score = $2 WHERE companion_id::text = $1`,
+			companionID, TrendingScore(buckets, now, s.halfLife),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update trending score: %w", err)
+		}
+	}
+
+	// companions.message_count mirrors the aggregate for existing readers
+	_, err = tx.Exec(`
+		UPDATE companions c SET message_count = s.messages_total
+		FROM companion_stats s
+		WHERE s.companion_id = c.id AND c.message_count IS DISTINCT FROM s.messages_total`)
+	if err != nil {
+		return fmt.Errorf("failed to update message counts: %w", err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTrendingScoreDecays(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	halfLife := 48 * time.Hour
+
+	tests := []struct {
+		name    string
+		buckets []ActivityBucket
+		want    float64
+	}{
+		{"no activity", nil, 0},
+		{"just now", []ActivityBucket{{At: now, Weight: 10}}, 10},
+		{"one half-life ago", []ActivityBucket{{At: now.Add(-halfLife), Weight: 10}}, 5},
+		{"two half-lives ago", []ActivityBucket{{At: now.Add(-2 * halfLife), Weight: 10}}, 2.5},
+		{"future is not boosted", []ActivityBucket{{At: now.Add(time.Hour), Weight: 10}}, 10},
+		{"buckets add up", []ActivityBucket{{At: now, Weight: 4}, {At: now.Add(-halfLife), Weight: 4}}, 6},
+	}
+
+	for _, tt := range tests {
+		got := TrendingScore(tt.buckets, now, halfLife)
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: TrendingScore = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTrendingScoreFavoursRecentActivity(t *testing.T) {
+	now := time.Now()
+	halfLife := 24 * time.Hour
+
+	// Ten messages last week lose to four messages this hour
+	old := TrendingScore([]ActivityBucket{{At: now.Add(-7 * 24 * time.Hour), Weight: 10}}, now, halfLife)
+	recent := TrendingScore([]ActivityBucket{{At: now, Weight: 4}}, now, halfLife)
+	if recent <= old {
+		t.Errorf("recent score %v should beat old score %v", recent, old)
+	}
+}
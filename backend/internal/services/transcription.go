@@ -0,0 +1,202 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Transcript is the text recognized in a voice note
+type Transcript struct {
+	Text       string
+	Language   string
+	DurationMs int // 0 when the provider does not report a duration
+}
+
+// TranscriptionProvider turns user voice notes into text
+type TranscriptionProvider interface {
+	IsConfigured() bool
+	Transcribe(audio []byte, mimeType string) (*Transcript, error)
+}
+
+// NewTranscriptionProvider creates the provider selected by STT_PROVIDER ("http" or "local")
+func NewTranscriptionProvider() TranscriptionProvider {
+	if os.Getenv("STT_PROVIDER") == "local" {
+		return NewLocalTranscriptionProvider()
+	}
+	return NewHTTPTranscriptionProvider()
+}
+
+// HTTPTranscriptionProvider transcribes speech with an OpenAI Whisper-compatible /audio/transcriptions endpoint
+type HTTPTranscriptionProvider struct {
+	apiKey     string
+	baseURL    string
+	model      string
+	httpClient *http.Client
+}
+
+// HTTPTranscriptionResponse represents the verbose_json transcription response
+type HTTPTranscriptionResponse struct {
+	Text     string  `json:"text"`
+	Language string  `json:"language"`
+	Duration float64 `json:"duration"`
+}
+
+// NewHTTPTranscriptionProvider creates a transcription provider from STT_API_URL, STT_API_KEY and STT_MODEL
+func NewHTTPTranscriptionProvider() *HTTPTranscriptionProvider {
+	model := os.Getenv("STT_MODEL")
+	if model == "" {
+		model = "whisper-1"
+	}
+
+	return &HTTPTranscriptionProvider{
+		apiKey:  os.Getenv("STT_API_KEY"),
+		baseURL: os.Getenv("STT_API_URL"),
+		model:   model,
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// IsConfigured checks if the transcription endpoint is set
+func (s *HTTPTranscriptionProvider) IsConfigured() bool {
+	return s.baseURL != ""
+}
+
+// Transcribe uploads the audio and returns the recognized text
+func (s *HTTPTranscriptionProvider) Transcribe(audio []byte, mimeType string) (*Transcript, error) {
+	if !s.IsConfigured() {
+		return nil, fmt.Errorf("STT API URL not configured")
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("model", s.model)
+	writer.WriteField("response_format", "verbose_json")
+
+	part, err := writer.CreateFormFile("file", "voice-note"+audioFileExtension(mimeType))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create form file: %w", err)
+	}
+	if _, err := part.Write(audio); err != nil {
+		return nil, fmt.Errorf("failed to write audio: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close form: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", s.baseURL, &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("STT API error: status %d, body: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result HTTPTranscriptionResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &Transcript{
+		Text:       result.Text,
+		Language:   result.Language,
+		DurationMs: int(result.Duration * 1000),
+	}, nil
+}
+
+// audioFileExtension picks a file name extension the transcription API can use to detect the format
+func audioFileExtension(mimeType string) string {
+	switch mimeType {
+	case "audio/mpeg":
+		return ".mp3"
+	case "audio/wav":
+		return ".wav"
+	case "audio/ogg":
+		return ".ogg"
+	case "audio/mp4":
+		return ".m4a"
+	default:
+		return ".webm"
+	}
+}
+
+// LocalTranscriptionProvider is a stub that returns a fixed transcript, for tests and local development
+type LocalTranscriptionProvider struct {
+	text string
+}
+
+// NewLocalTranscriptionProvider creates the stub, using STT_LOCAL_TEXT as the transcript if set
+func NewLocalTranscriptionProvider() *LocalTranscriptionProvider {
+	text := os.Getenv("STT_LOCAL_TEXT")
+	if text == "" {
+		text = "Hey, I just sent you a voice note."
+	}
+	return &LocalTranscriptionProvider{text: text}
+}
+
+// IsConfigured always returns true, the stub needs no credentials
+func (s *LocalTranscriptionProvider) IsConfigured() bool {
+	return true
+}
+
+// Transcribe returns the fixed transcript, reading the duration from WAV audio
+func (s *LocalTranscriptionProvider) Transcribe(audio []byte, mimeType string) (*Transcript, error) {
+	if len(audio) == 0 {
+		return nil, fmt.Errorf("no audio to transcribe")
+	}
+
+	transcript := &Transcript{Text: s.text, Language: "en"}
+	if duration, ok := WAVDuration(audio); ok {
+		transcript.DurationMs = int(duration.Milliseconds())
+	}
+	return transcript, nil
+}
+
+// WAVDuration reads the length of a PCM WAV file from its header
+func WAVDuration(data []byte) (time.Duration, bool) {
+	if len(data) < 44 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return 0, false
+	}
+
+	byteRate := binary.LittleEndian.Uint32(data[28:32])
+	if byteRate == 0 {
+		return 0, false
+	}
+
+	// Walk the chunks after the RIFF header to find the data chunk
+	for offset := 12; offset+8 <= len(data); {
+		id := string(data[offset : offset+4])
+		size := binary.LittleEndian.Uint32(data[offset+4 : offset+8])
+		if id == "data" {
+			return time.Duration(float64(size) / float64(byteRate) * float64(time.Second)), true
+		}
+		offset += 8 + int(size) + int(size%2)
+	}
+
+	return 0, false
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLocalTranscriptionProviderReadsWAVDuration(t *testing.T) {
+	provider := &LocalTranscriptionProvider{text: "hello there"}
+	audio := SineWAV(440, 1500*time.Millisecond, 16000)
+
+	transcript, err := provider.Transcribe(audio, "audio/wav")
+	if err != nil {
+		t.Fatalf("Transcribe returned error: %v", err)
+	}
+	if transcript.Text != "hello there" {
+		t.Errorf("Text = %q, want %q", transcript.Text, "hello there")
+	}
+	if transcript.DurationMs != 1500 {
+		t.Errorf("DurationMs = %d, want 1500", transcript.DurationMs)
+	}
+
+	if _, err := provider.Transcribe(nil, "audio/wav"); err == nil {
+		t.Error("expected error for empty audio")
+	}
+}
+
+func TestWAVDurationRejectsOtherFormats(t *testing.T) {
+	if _, ok := WAVDuration([]byte("ID3\x04\x00not a wav file at all, just some mp3 bytes")); ok {
+		t.Error("expected non-WAV data to be rejected")
+	}
+}
+
+func TestHTTPTranscriptionProviderTranscribe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("failed to parse form: %v", err)
+		}
+		if r.FormValue("model") != "whisper-1" {
+			t.Errorf("model = %q, want whisper-1", r.FormValue("model"))
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Fatalf("missing file: %v", err)
+		}
+		data, _ := io.ReadAll(file)
+		if header.Filename != "voice-note.ogg" || string(data) != "ogg-bytes" {
+			t.Errorf("unexpected upload %s (%q)", header.Filename, data)
+		}
+
+		w.Write([]byte(`{"text": " Miss you already ", "language": "english", "duration": 2.5}`))
+	}))
+	defer server.Close()
+
+	provider := &HTTPTranscriptionProvider{
+		baseURL:    server.URL,
+		model:      "whisper-1",
+		httpClient: server.Client(),
+	}
+
+	transcript, err := provider.Transcribe([]byte("ogg-bytes"), "audio/ogg")
+	if err != nil {
+		t.Fatalf("Transcribe returned error: %v", err)
+	}
+	if transcript.Text != " Miss you already " || transcript.DurationMs != 2500 {
+		t.Errorf("unexpected transcript %+v", transcript)
+	}
+}
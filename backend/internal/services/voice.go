@@ -0,0 +1,232 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// VoiceProfile describes how a companion sounds
+type VoiceProfile struct {
+	VoiceID string  `json:"voiceId,omitempty"` // Provider voice name, e.g. "nova"
+	Pitch   float64 `json:"pitch,omitempty"`   // Relative pitch, 1.0 is neutral
+	Speed   float64 `json:"speed,omitempty"`   // Speaking rate, 1.0 is neutral
+}
+
+// SpeechAudio is synthesized speech ready to be stored as a voice note
+type SpeechAudio struct {
+	Data       []byte
+	MimeType   string
+	DurationMs int // 0 when the provider does not report a duration
+}
+
+// VoiceProvider renders companion messages as speech
+type VoiceProvider interface {
+	IsConfigured() bool
+	Synthesize(text string, voice VoiceProfile) (*SpeechAudio, error)
+}
+
+// NewVoiceProvider creates the voice provider selected by TTS_PROVIDER ("http" or "local")
+func NewVoiceProvider() VoiceProvider {
+	if os.Getenv("TTS_PROVIDER") == "local" {
+		return NewLocalVoiceProvider()
+	}
+	return NewHTTPVoiceProvider()
+}
+
+// HTTPVoiceProvider synthesizes speech with an OpenAI-compatible /audio/speech endpoint
+type HTTPVoiceProvider struct {
+	apiKey       string
+	baseURL      string
+	model        string
+	defaultVoice string
+	httpClient   *http.Client
+}
+
+// HTTPSpeechRequest represents the request body for the speech endpoint
+type HTTPSpeechRequest struct {
+	Model          string  `json:"model"`
+	Input          string  `json:"input"`
+	Voice          string  `json:"voice"`
+	Speed          float64 `json:"speed,omitempty"`
+	ResponseFormat string  `json:"response_format"`
+}
+
+// NewHTTPVoiceProvider creates a speech provider from TTS_API_URL, TTS_API_KEY and TTS_MODEL
+func NewHTTPVoiceProvider() *HTTPVoiceProvider {
+	model := os.Getenv("TTS_MODEL")
+	if model == "" {
+		model = "tts-1"
+	}
+	defaultVoice := os.Getenv("TTS_DEFAULT_VOICE")
+	if defaultVoice == "" {
+		defaultVoice = "nova"
+	}
+
+	return &HTTPVoiceProvider{
+		apiKey:       os.Getenv("TTS_API_KEY"),
+		baseURL:      os.Getenv("TTS_API_URL"),
+		model:        model,
+		defaultVoice: defaultVoice,
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}
+}
+
+// IsConfigured checks if the speech endpoint is set
+func (s *HTTPVoiceProvider) IsConfigured() bool {
+	return s.baseURL != ""
+}
+
+// Synthesize renders text as MP3 audio
+func (s *HTTPVoiceProvider) Synthesize(text string, voice VoiceProfile) (*SpeechAudio, error) {
+	if !s.IsConfigured() {
+		return nil, fmt.Errorf("TTS API URL not configured")
+	}
+
+	voiceID := voice.VoiceID
+	if voiceID == "" {
+		voiceID = s.defaultVoice
+	}
+
+	reqBody := HTTPSpeechRequest{
+		Model:          s.model,
+		Input:          text,
+		Voice:          voiceID,
+		Speed:          voice.Speed,
+		ResponseFormat: "mp3",
+	}
+
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", s.baseURL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("TTS API error: status %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	return &SpeechAudio{Data: body, MimeType: "audio/mpeg"}, nil
+}
+
+// LocalVoiceProvider is a stub that renders a WAV tone instead of speech, for tests and local development
+type LocalVoiceProvider struct {
+	sampleRate int
+}
+
+// NewLocalVoiceProvider creates the local tone provider
+func NewLocalVoiceProvider() *LocalVoiceProvider {
+	return &LocalVoiceProvider{sampleRate: 16000}
+}
+
+// IsConfigured always returns true, the stub needs no credentials
+func (s *LocalVoiceProvider) IsConfigured() bool {
+	return true
+}
+
+// Synthesize writes a sine tone whose length follows the number of words and whose pitch follows the voice
+func (s *LocalVoiceProvider) Synthesize(text string, voice VoiceProfile) (*SpeechAudio, error) {
+	words := len(strings.Fields(text))
+	if words == 0 {
+		return nil, fmt.Errorf("no text to synthesize")
+	}
+
+	speed := voice.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+	pitch := voice.Pitch
+	if pitch <= 0 {
+		pitch = 1
+	}
+
+	// Roughly 350ms per word, between 1 and 30 seconds
+	duration := time.Duration(float64(words)*350/speed) * time.Millisecond
+	if duration < time.Second {
+		duration = time.Second
+	}
+	if duration > 30*time.Second {
+		duration = 30 * time.Second
+	}
+
+	data := SineWAV(220*pitch, duration, s.sampleRate)
+	return &SpeechAudio{Data: data, MimeType: "audio/wav", DurationMs: int(duration.Milliseconds())}, nil
+}
+
+// SineWAV encodes a mono 16-bit PCM WAV file containing a sine tone
+func SineWAV(frequency float64, duration time.Duration, sampleRate int) []byte {
+	samples := int(duration.Seconds() * float64(sampleRate))
+	dataSize := samples * 2
+
+	var buf bytes.Buffer
+	buf.Grow(44 + dataSize)
+
+	// RIFF header
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVE")
+
+	// fmt chunk: PCM, mono, 16-bit
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(1))
+	binary.Write(&buf, binary.LittleEndian, uint16(1))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*2))
+	binary.Write(&buf, binary.LittleEndian, uint16(2))
+	binary.Write(&buf, binary.LittleEndian, uint16(16))
+
+	// data chunk
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	for i := 0; i < samples; i++ {
+		sample := 0.3 * math.Sin(2*math.Pi*frequency*float64(i)/float64(sampleRate))
+		binary.Write(&buf, binary.LittleEndian, int16(sample*math.MaxInt16))
+	}
+
+	return buf.Bytes()
+}
+
+var (
+	roleplayActionPattern = regexp.MustCompile(`\*[^*]*\*`)
+	whitespacePattern     = regexp.MustCompile(`\s+`)
+)
+
+// SpeakableText strips roleplay actions (*smiles*) and photo markers from a reply before it is spoken
+func SpeakableText(text string) string {
+	if photo, ok := ParsePhotoReply(text); ok {
+		text = photo.Caption
+	}
+	text = roleplayActionPattern.ReplaceAllString(text, " ")
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(text, " "))
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocalVoiceProviderWritesWAV(t *testing.T) {
+	provider := NewLocalVoiceProvider()
+
+	audio, err := provider.Synthesize("Hey you, I missed you today", VoiceProfile{})
+	if err != nil {
+		t.Fatalf("Synthesize returned error: %v", err)
+	}
+
+	if audio.MimeType != "audio/wav" {
+		t.Errorf("MimeType = %q, want audio/wav", audio.MimeType)
+	}
+	if string(audio.Data[0:4]) != "RIFF" || string(audio.Data[8:12]) != "WAVE" {
+		t.Fatal("audio is not a RIFF/WAVE file")
+	}
+
+	dataSize := binary.LittleEndian.Uint32(audio.Data[40:44])
+	if int(dataSize) != len(audio.Data)-44 {
+		t.Errorf("data chunk size %d does not match payload %d", dataSize, len(audio.Data)-44)
+	}
+
+	// 6 words at 350ms each
+	if audio.DurationMs != 2100 {
+		t.Errorf("DurationMs = %d, want 2100", audio.DurationMs)
+	}
+}
+
+func TestLocalVoiceProviderSpeedAndLimits(t *testing.T) {
+	provider := NewLocalVoiceProvider()
+
+	short, err := provider.Synthesize("Hi", VoiceProfile{})
+	if err != nil {
+		t.Fatalf("Synthesize returned error: %v", err)
+	}
+	if short.DurationMs != 1000 {
+		t.Errorf("short message DurationMs = %d, want minimum 1000", short.DurationMs)
+	}
+
+	fast, err := provider.Synthesize("one two three four five six", VoiceProfile{Speed: 2})
+	if err != nil {
+		t.Fatalf("Synthesize returned error: %v", err)
+	}
+	if fast.DurationMs != 1050 {
+		t.Errorf("fast DurationMs = %d, want 1050", fast.DurationMs)
+	}
+
+	if _, err := provider.Synthesize("   ", VoiceProfile{}); err == nil {
+		t.Error("expected error for empty text")
+	}
+}
+
+func TestHTTPVoiceProviderSynthesize(t *testing.T) {
+	var received HTTPSpeechRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			t.Errorf("unexpected Authorization header %q", r.Header.Get("Authorization"))
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte("mp3-bytes"))
+	}))
+	defer server.Close()
+
+	provider := &HTTPVoiceProvider{
+		apiKey:       "test-key",
+		baseURL:      server.URL,
+		model:        "tts-1",
+		defaultVoice: "nova",
+		httpClient:   server.Client(),
+	}
+
+	audio, err := provider.Synthesize("Hello there", VoiceProfile{Speed: 1.1})
+	if err != nil {
+		t.Fatalf("Synthesize returned error: %v", err)
+	}
+	if string(audio.Data) != "mp3-bytes" || audio.MimeType != "audio/mpeg" {
+		t.Errorf("unexpected audio %q (%s)", audio.Data, audio.MimeType)
+	}
+	if received.Voice != "nova" || received.Input != "Hello there" || received.Speed != 1.1 {
+		t.Errorf("unexpected request %+v", received)
+	}
+}
+
+func TestSpeakableText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"*smiles softly* I missed you", "I missed you"},
+		{"Just took this! [Photo] I'm on the beach", "Just took this!"},
+		{"Hey   there\nstranger", "Hey there stranger"},
+	}
+
+	for _, tt := range tests {
+		if got := SpeakableText(tt.in); got != tt.want {
+			t.Errorf("SpeakableText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+)
+
+// Storage persists uploaded and generated media and resolves public URLs for it
+type Storage interface {
+	// Put stores the content under key and returns its public URL
+	Put(key string, contentType string, r io.Reader) (string, error)
+	// Open returns a reader for the content stored under key
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes the content stored under key
+	Delete(key string) error
+	// URL returns the public URL for key
+	URL(key string) string
+}
+
+// LocalStorage stores media on the local filesystem, served by the API under its base path
+type LocalStorage struct {
+	dir      string
+	basePath string
+}
+
+// NewLocalStorage creates a filesystem storage rooted at dir and served at basePath
+func NewLocalStorage(dir, basePath string) *LocalStorage {
+	return &LocalStorage{
+		dir:      dir,
+		basePath: "/" + strings.Trim(basePath, "/"),
+	}
+}
+
+// NewFromEnv creates the storage configured by MEDIA_DIR and MEDIA_BASE_PATH
+func NewFromEnv() *LocalStorage {
+	dir := os.Getenv("MEDIA_DIR")
+	if dir == "" {
+		dir = "./uploads"
+	}
+	basePath := os.Getenv("MEDIA_BASE_PATH")
+	if basePath == "" {
+		basePath = "/media"
+	}
+	return NewLocalStorage(dir, basePath)
+}
+
+// Dir returns the directory media is stored in
+func (s *LocalStorage) Dir() string {
+	return s.dir
+}
+
+// BasePath returns the URL path media is served from
+func (s *LocalStorage) BasePath() string {
+	return s.basePath
+}
+
+// Put writes the content to disk under key. The returned URL points at the cleaned key, which is
+// where the content was actually written.
+func (s *LocalStorage) Put(key string, contentType string, r io.Reader) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create media directory: %w", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create media file: %w", err)
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write media file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write media file: %w", err)
+	}
+
+	return s.URL(key), nil
+}
+
+// Open opens the file stored under key
+func (s *LocalStorage) Open(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open media file: %w", err)
+	}
+	return f, nil
+}
+
+// Delete removes the file stored under key
+func (s *LocalStorage) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete media file: %w", err)
+	}
+	return nil
+}
+
+// URL returns the public URL path for key
+func (s *LocalStorage) URL(key string) string {
+	return s.basePath + "/" + strings.TrimPrefix(key, "/")
+}
+
+// path resolves key inside the storage directory, rejecting keys that escape it
+func (s *LocalStorage) path(key string) (string, error) {
+	clean, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(clean)), nil
+}
+
+// cleanKey resolves ".." and duplicate slashes in key without letting it climb above the root
+func cleanKey(key string) (string, error) {
+	clean := strings.TrimPrefix(pathpkg.Clean("/"+key), "/")
+	if clean == "" {
+		return "", fmt.Errorf("invalid storage key: %q", key)
+	}
+	return clean, nil
+}
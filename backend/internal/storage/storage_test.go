@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStoragePutAndDelete(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocalStorage(dir, "media/")
+
+	url, err := store.Put("attachments/user-1/photo.png", "image/png", strings.NewReader("png-bytes"))
+	if err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+	if url != "/media/attachments/user-1/photo.png" {
+		t.Errorf("Put returned URL %q", url)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "attachments", "user-1", "photo.png"))
+	if err != nil {
+		t.Fatalf("stored file not found: %v", err)
+	}
+	if string(data) != "png-bytes" {
+		t.Errorf("stored content = %q", string(data))
+	}
+
+	rc, err := store.Open("attachments/user-1/photo.png")
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	rc.Close()
+
+	if err := store.Delete("attachments/user-1/photo.png"); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "attachments", "user-1", "photo.png")); !os.IsNotExist(err) {
+		t.Error("file still exists after Delete")
+	}
+
+	// Deleting a missing key is not an error
+	if err := store.Delete("attachments/user-1/photo.png"); err != nil {
+		t.Errorf("Delete of missing key returned error: %v", err)
+	}
+}
+
+func TestLocalStorageKeysStayInsideDir(t *testing.T) {
+	dir := t.TempDir()
+	store := NewLocalStorage(filepath.Join(dir, "media"), "/media")
+
+	url, err := store.Put("../../escape.txt", "text/plain", strings.NewReader("x"))
+	if err != nil {
+		t.Fatalf("Put returned error: %v", err)
+	}
+	if url != "/media/escape.txt" {
+		t.Errorf("Put returned URL %q, want the cleaned key", url)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); !os.IsNotExist(err) {
+		t.Error("key escaped the storage directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "media", "escape.txt")); err != nil {
+		t.Errorf("expected file inside storage directory: %v", err)
+	}
+
+	if _, err := store.Put("/", "text/plain", strings.NewReader("x")); err == nil {
+		t.Error("expected error for empty key")
+	}
+}
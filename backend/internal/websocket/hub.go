@@ -49,12 +49,31 @@ type Hub struct {
 	mu sync.RWMutex
 }
 
-// BroadcastMessage contains a message and the target conversation
+// BroadcastMessage contains a message or event and the target conversation
 type BroadcastMessage struct {
 	ConversationID string
 	Message        *models.Message
+	Event          *Event
 }
 
+// Event is a change to a conversation other than a new message. New messages are
+// sent as bare message objects; events are wrapped so clients can tell them apart.
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// Event types
+const (
+	EventMessageDelivered = "message.delivered"
+	EventMessageRead      = "message.read"
+	EventMessageUpdated   = "message.updated"
+	EventMessageDeleted   = "message.deleted"
+	EventBranchSwitched   = "conversation.branch"
+	EventReactionAdded    = "reaction.added"
+	EventReactionRemoved  = "reaction.removed"
+)
+
 // NewHub creates a new Hub instance
 func NewHub() *Hub {
 	return &Hub{
@@ -97,7 +116,11 @@ func (h *Hub) Run() {
 			clients := h.clients[message.ConversationID]
 			h.mu.RUnlock()
 
-			data, err := json.Marshal(message.Message)
+			var payload interface{} = message.Message
+			if message.Event != nil {
+				payload = message.Event
+			}
+			data, err := json.Marshal(payload)
 			if err != nil {
 				log.Printf("Error marshaling message: %v", err)
 				continue
@@ -125,6 +148,14 @@ func (h *Hub) BroadcastToConversation(conversationID string, message *models.Mes
 	}
 }
 
+// BroadcastEvent sends an event to all clients in a conversation
+func (h *Hub) BroadcastEvent(conversationID string, eventType string, data interface{}) {
+	h.broadcast <- &BroadcastMessage{
+		ConversationID: conversationID,
+		Event:          &Event{Type: eventType, Data: data},
+	}
+}
+
 // HandleWebSocket handles WebSocket upgrade and client management
 func HandleWebSocket(hub *Hub, c *gin.Context) {
 	conversationID := c.Param("conversationId")
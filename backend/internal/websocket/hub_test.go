@@ -0,0 +1,54 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"nectar-ai-companion/internal/models"
+)
+
+func receive(t *testing.T, client *Client) map[string]interface{} {
+	t.Helper()
+	select {
+	case data := <-client.send:
+		var payload map[string]interface{}
+		if err := json.Unmarshal(data, &payload); err != nil {
+			t.Fatalf("invalid payload %s: %v", data, err)
+		}
+		return payload
+	case <-time.After(time.Second):
+		t.Fatal("no payload broadcast")
+		return nil
+	}
+}
+
+func TestHubBroadcastsMessagesBareAndEventsWrapped(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	client := &Client{hub: hub, send: make(chan []byte, 4), conversationID: "conv-1"}
+	other := &Client{hub: hub, send: make(chan []byte, 4), conversationID: "conv-2"}
+	hub.register <- client
+	hub.register <- other
+
+	hub.BroadcastToConversation("conv-1", &models.Message{ID: "msg-1", Sender: "ai", Content: "Hi"})
+	if payload := receive(t, client); payload["id"] != "msg-1" || payload["type"] != nil {
+		t.Errorf("message payload = %v, want the bare message", payload)
+	}
+
+	hub.BroadcastEvent("conv-1", EventMessageRead, models.MessageReceipt{ConversationID: "conv-1", MessageIDs: []string{"msg-1"}})
+	payload := receive(t, client)
+	if payload["type"] != EventMessageRead {
+		t.Errorf("event type = %v, want %s", payload["type"], EventMessageRead)
+	}
+	if data, ok := payload["data"].(map[string]interface{}); !ok || data["conversationId"] != "conv-1" {
+		t.Errorf("event data = %v", payload["data"])
+	}
+
+	select {
+	case data := <-other.send:
+		t.Errorf("other conversation received %s", data)
+	default:
+	}
+}